@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/speedwagon-io/asutp/internal/collector"
+	"github.com/speedwagon-io/asutp/internal/collector/adapters"
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/lib/sshtunnel"
+	"github.com/speedwagon-io/asutp/internal/lib/tlsutil"
+)
+
+// adapterFactories builds the adapter for each supported
+// ConnectionConfig.Adapter value.
+var adapterFactories = map[string]func(log *slog.Logger, conn *config.ConnectionConfig, transport *http.Transport) (collector.Collector, error){
+	"energy_api": func(log *slog.Logger, conn *config.ConnectionConfig, transport *http.Transport) (collector.Collector, error) {
+		return adapters.NewEnergyAPIAdapter(log, conn, transport), nil
+	},
+	"file": func(log *slog.Logger, conn *config.ConnectionConfig, _ *http.Transport) (collector.Collector, error) {
+		coll, err := adapters.NewFileAdapter(log, conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file adapter: %w", err)
+		}
+		return coll, nil
+	},
+	"modbus_rtu": func(log *slog.Logger, conn *config.ConnectionConfig, _ *http.Transport) (collector.Collector, error) {
+		coll, err := adapters.NewModbusRTUAdapter(log, conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create modbus_rtu adapter: %w", err)
+		}
+		return coll, nil
+	},
+}
+
+// adapterNames lists the adapters built into this binary.
+func adapterNames() []string {
+	names := make([]string, 0, len(adapterFactories))
+	for name := range adapterFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// enabledAdapters lists the adapters used by the station's connections.
+func enabledAdapters(stationCfg *config.StationConfig) []string {
+	seen := map[string]bool{stationCfg.Connection.Adapter: true}
+	names := []string{stationCfg.Connection.Adapter}
+	for _, conn := range stationCfg.Connections {
+		if !seen[conn.Adapter] {
+			seen[conn.Adapter] = true
+			names = append(names, conn.Adapter)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newCollector builds the adapter for a connection. The returned tunnel is
+// non-nil when the connection goes through an SSH jump host and must be
+// closed on shutdown.
+func newCollector(log *slog.Logger, conn *config.ConnectionConfig) (collector.Collector, *sshtunnel.Tunnel, error) {
+	connTLS, err := tlsutil.ClientConfig(conn.TLS.CAFile, conn.TLS.ReplaceSystemRoots)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load connection CA bundle: %w", err)
+	}
+
+	connTransport := tlsutil.NewTransport(connTLS)
+
+	var tunnel *sshtunnel.Tunnel
+	if sshCfg := conn.SSH; sshCfg.Enabled {
+		tunnel, err = sshtunnel.New(log, sshtunnel.Config{
+			Host:                  sshCfg.Host,
+			User:                  sshCfg.User,
+			KeyFile:               sshCfg.KeyFile,
+			KnownHostsFile:        sshCfg.KnownHostsFile,
+			InsecureIgnoreHostKey: sshCfg.InsecureIgnoreHostKey,
+			Timeout:               sshCfg.Timeout,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to configure ssh tunnel: %w", err)
+		}
+		connTransport.DialContext = tunnel.DialContext
+		log.Info("adapter connections use ssh tunnel", slog.String("jump_host", sshCfg.Host))
+	}
+
+	factory, ok := adapterFactories[conn.Adapter]
+	if !ok {
+		return nil, tunnel, fmt.Errorf("unknown adapter: %s", conn.Adapter)
+	}
+	coll, err := factory(log, conn, connTransport)
+	if err != nil {
+		return nil, tunnel, err
+	}
+	return coll, tunnel, nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/buffer"
+	"github.com/speedwagon-io/asutp/internal/collector"
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/lib/tlsutil"
+	"github.com/speedwagon-io/asutp/internal/sender"
+)
+
+const bufferUsage = `usage: collector buffer <command> -config <path> [flags]
+
+commands:
+  stats                       pending and sent counts, oldest pending age, size
+  list [-limit N]             buffered envelope IDs, devices and timestamps
+  show <id>                   full envelope JSON
+  flush [-target url]         send pending envelopes; refused while the collector runs
+  purge -older-than <dur>     delete envelopes buffered longer than dur
+  export|import [-file path]  dump or load the buffer as NDJSON`
+
+// runBufferCommand implements "collector buffer", which inspects and manages
+// the configured buffer without sqlite3 on the box. Export and import move
+// unsent data between machines; the file defaults to stdout for export and
+// stdin for import. All commands but flush are safe while the collector is
+// running, since SQLite serializes access to the WAL database.
+func runBufferCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, bufferUsage)
+		return 2
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("buffer "+action, flag.ExitOnError)
+	configPath := fs.String("config", "", "config file, directory or comma-separated list of files")
+	filePath := fs.String("file", "", "export/import file (default stdout/stdin)")
+	limit := fs.Int("limit", 50, "maximum envelopes to list")
+	target := fs.String("target", "", "flush target URL (default sender url)")
+	olderThan := fs.Duration("older-than", 0, "purge envelopes buffered longer than this")
+	fs.Parse(args[1:])
+
+	cfg := config.MustLoad(*configPath)
+	// Log to stderr so an export written to stdout stays valid NDJSON.
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	if action != "import" {
+		if _, err := os.Stat(cfg.Buffer.Path); err != nil {
+			log.Error("buffer not found", slog.String("path", cfg.Buffer.Path), sl.Err(err))
+			return 1
+		}
+	}
+
+	buf, err := buffer.NewSQLiteBuffer(log, cfg.Buffer.Path)
+	if err != nil {
+		log.Error("failed to open buffer", sl.Err(err))
+		return 1
+	}
+	defer buf.Close()
+
+	ctx := context.Background()
+
+	switch action {
+	case "export":
+		var w io.Writer = os.Stdout
+		if *filePath != "" {
+			f, err := os.Create(*filePath)
+			if err != nil {
+				log.Error("failed to create export file", sl.Err(err))
+				return 1
+			}
+			defer f.Close()
+			w = f
+		}
+
+		n, skipped, err := buf.Export(ctx, w)
+		if err != nil {
+			log.Error("buffer export failed", slog.Int("exported", n), slog.Int("skipped", skipped), sl.Err(err))
+			return 1
+		}
+		if skipped > 0 {
+			log.Warn("buffer export skipped unreadable rows", slog.Int("skipped", skipped))
+		}
+		log.Info("buffer exported", slog.Int("envelopes", n), slog.String("path", cfg.Buffer.Path))
+	case "import":
+		var r io.Reader = os.Stdin
+		if *filePath != "" {
+			f, err := os.Open(*filePath)
+			if err != nil {
+				log.Error("failed to open import file", sl.Err(err))
+				return 1
+			}
+			defer f.Close()
+			r = f
+		}
+
+		n, err := buf.Import(ctx, r)
+		if err != nil {
+			log.Error("buffer import failed", sl.Err(err))
+			return 1
+		}
+		log.Info("buffer imported", slog.Int("envelopes", n), slog.String("path", cfg.Buffer.Path))
+	case "stats":
+		stats, err := buf.Stats(ctx)
+		if err != nil {
+			log.Error("failed to read buffer stats", sl.Err(err))
+			return 1
+		}
+		fmt.Printf("path:           %s\n", cfg.Buffer.Path)
+		fmt.Printf("pending:        %d\n", stats.Pending)
+		fmt.Printf("sent:           %d\n", stats.Sent)
+		fmt.Printf("oldest pending: %s\n", stats.OldestPending.Round(time.Second))
+		fmt.Printf("size:           %d bytes\n", stats.Bytes)
+	case "list":
+		entries, err := buf.List(ctx, *limit)
+		if err != nil {
+			log.Error("failed to list buffer", sl.Err(err))
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDEVICE\tTIMESTAMP\tCREATED\tPRIORITY\tSENT")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%t\n",
+				e.ID, e.DeviceID, e.Timestamp.Format(time.RFC3339), e.CreatedAt.Format(time.RFC3339), e.Priority, e.Sent)
+		}
+		w.Flush()
+	case "show":
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, bufferUsage)
+			return 2
+		}
+		envelope, err := buf.Get(ctx, fs.Arg(0))
+		if err != nil {
+			log.Error("failed to read envelope", sl.Err(err))
+			return 1
+		}
+		if envelope == nil {
+			log.Error("envelope not found", slog.String("id", fs.Arg(0)))
+			return 1
+		}
+		out, err := json.MarshalIndent(envelope, "", "  ")
+		if err != nil {
+			log.Error("failed to encode envelope", sl.Err(err))
+			return 1
+		}
+		fmt.Println(string(out))
+	case "flush":
+		return flushBuffer(ctx, log, cfg, buf, *target)
+	case "purge":
+		if *olderThan <= 0 {
+			fmt.Fprintln(os.Stderr, "purge requires a positive -older-than")
+			return 2
+		}
+		deleted, err := buf.Purge(ctx, *olderThan)
+		if err != nil {
+			log.Error("buffer purge failed", slog.Int64("deleted", deleted), sl.Err(err))
+			return 1
+		}
+		log.Info("buffer purged", slog.Int64("deleted", deleted), slog.Duration("older_than", *olderThan))
+	default:
+		fmt.Fprintln(os.Stderr, bufferUsage)
+		return 2
+	}
+
+	return 0
+}
+
+// flushBuffer sends pending envelopes through an HTTPSender to target, or
+// the configured sender URL, until the buffer is empty or a send fails. It
+// holds the buffer lock so it never races a running collector's drain loop.
+func flushBuffer(ctx context.Context, log *slog.Logger, cfg *config.Config, buf *buffer.SQLiteBuffer, target string) int {
+	lock, err := buffer.Lock(cfg.Buffer.Path)
+	if errors.Is(err, buffer.ErrLocked) {
+		log.Error("buffer is in use by a running collector, flush it with SIGUSR1 or POST /flush instead")
+		return 1
+	}
+	if err != nil {
+		log.Error("failed to lock buffer", sl.Err(err))
+		return 1
+	}
+	defer lock.Unlock()
+
+	senderCfg := cfg.Sender
+	if target != "" {
+		senderCfg.URL = target
+		senderCfg.GroupURLs = nil
+	}
+	if senderCfg.URL == "" {
+		log.Error("flush needs -target or a sender url")
+		return 2
+	}
+
+	senderTLS, err := tlsutil.ClientConfig(senderCfg.TLS.CAFile, senderCfg.TLS.ReplaceSystemRoots)
+	if err != nil {
+		log.Error("failed to load sender CA bundle", sl.Err(err))
+		return 1
+	}
+	httpSender := sender.NewHTTPSender(log, &senderCfg, cfg.Station.DBID, senderTLS)
+	if senderCfg.TokenFile != "" {
+		tokens, err := sender.NewFileTokenProvider(senderCfg.TokenFile)
+		if err != nil {
+			log.Error("failed to load sender token", sl.Err(err))
+			return 1
+		}
+		httpSender.SetTokenProvider(tokens)
+	}
+
+	flushed := 0
+	for {
+		pending, err := buf.GetPending(ctx, 100)
+		if err != nil {
+			log.Error("failed to read pending envelopes", sl.Err(err))
+			return 1
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		for _, envelope := range pending {
+			envelope.SetMeta(collector.MetaReplay, "true")
+			if err := httpSender.Send(ctx, envelope); err != nil {
+				log.Error("buffer flush failed",
+					slog.Int("flushed", flushed),
+					slog.String("id", envelope.ID),
+					sl.Err(err),
+				)
+				return 1
+			}
+			if err := buf.MarkSent(ctx, []string{envelope.ID}); err != nil {
+				log.Error("failed to mark envelope as sent", slog.String("id", envelope.ID), sl.Err(err))
+				return 1
+			}
+			flushed++
+		}
+	}
+
+	log.Info("buffer flushed", slog.Int("envelopes", flushed), slog.String("target", senderCfg.URL))
+	return 0
+}
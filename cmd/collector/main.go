@@ -2,93 +2,375 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/speedwagon-io/asutp/internal/buffer"
 	"github.com/speedwagon-io/asutp/internal/collector"
-	"github.com/speedwagon-io/asutp/internal/collector/adapters"
 	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/events"
 	"github.com/speedwagon-io/asutp/internal/health"
 	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/lib/tlsutil"
+	"github.com/speedwagon-io/asutp/internal/model"
 	"github.com/speedwagon-io/asutp/internal/sender"
+	"github.com/speedwagon-io/asutp/internal/version"
 )
 
 func main() {
-	configPath := flag.String("config", "", "path to config file")
+	if len(os.Args) > 1 && os.Args[1] == "buffer" {
+		os.Exit(runBufferCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "test-device" {
+		os.Exit(runTestDeviceCommand(os.Args[2:]))
+	}
+
+	configPath := flag.String("config", "", "config file, directory or comma-separated list of files")
 	dryRun := flag.Bool("dry-run", false, "log data instead of sending")
+	once := flag.Bool("once", false, "run a single collection cycle, print a summary and exit")
+	deviceFilter := flag.String("device", "", "comma-separated device ids collected with -once (default all)")
 	flag.Parse()
 
 	cfg := config.MustLoad(*configPath)
 
 	log := sl.SetupLogger(cfg.Log.Level, cfg.Log.Format)
 
+	startedAt := time.Now().UTC()
+	build := version.Get()
+
 	log.Info("starting ASUTP collector",
 		slog.String("env", cfg.Env),
 		slog.String("station_id", cfg.Station.ID),
 		slog.Bool("dry_run", *dryRun),
+		slog.Bool("once", *once),
 	)
 
 	stationCfg := config.MustLoadStation(cfg.Station.ConfigPath)
 
+	for _, warning := range stationCfg.UnitWarnings() {
+		log.Warn("implausible field unit", slog.String("detail", warning))
+	}
+
+	if len(stationCfg.Devices) == 0 {
+		if cfg.Station.EmptyDevices == "fail" {
+			log.Error("station config has no devices", slog.String("path", cfg.Station.ConfigPath))
+			os.Exit(1)
+		}
+		log.Warn("station config has no devices, nothing will be collected",
+			slog.String("path", cfg.Station.ConfigPath),
+		)
+	}
+
+	if cfg.Status.Enabled {
+		for _, d := range stationCfg.Devices {
+			if d.ID == cfg.Status.DeviceID {
+				log.Error("station status device id collides with a configured device", slog.String("device_id", d.ID))
+				os.Exit(1)
+			}
+		}
+	}
+
+	checksums := make(map[string]string)
+	for _, path := range slices.Concat(cfg.Paths, []string{cfg.Station.ConfigPath}) {
+		sum, err := config.FileChecksum(path)
+		if err != nil {
+			log.Warn("failed to checksum config file", slog.String("path", path), sl.Err(err))
+			continue
+		}
+		checksums[path] = sum
+	}
+
+	log.Info("build info",
+		slog.String("version", build.Version),
+		slog.String("commit", build.Commit),
+		slog.String("build_date", build.BuildDate),
+		slog.String("go_version", build.GoVersion),
+		slog.String("station_id", stationCfg.StationID),
+		slog.String("station_name", stationCfg.StationName),
+		slog.String("adapter", stationCfg.Connection.Adapter),
+		slog.Any("enabled_adapters", enabledAdapters(stationCfg)),
+		slog.Any("available_adapters", adapterNames()),
+		slog.Any("config_checksums", checksums),
+		slog.Time("started_at", startedAt),
+	)
+
 	log.Info("loaded station config",
 		slog.String("station_id", stationCfg.StationID),
 		slog.String("station_name", stationCfg.StationName),
 		slog.Int("devices", len(stationCfg.Devices)),
 	)
 
-	var coll collector.Collector
-	switch stationCfg.Connection.Adapter {
-	case "energy_api":
-		coll = adapters.NewEnergyAPIAdapter(
-			log,
-			stationCfg.Connection.BaseURL,
-			stationCfg.Connection.Timeout,
-		)
-	default:
-		log.Error("unknown adapter", slog.String("adapter", stationCfg.Connection.Adapter))
+	coll, adapters, tunnels, err := newStationCollector(log, stationCfg)
+	if err != nil {
+		log.Error("failed to create collector", sl.Err(err))
 		os.Exit(1)
 	}
 
+	adapterCheckers := make([]health.HealthChecker, 0, len(adapters))
+	unprobed := false
+	for _, name := range slices.Sorted(maps.Keys(adapters)) {
+		prober, ok := adapters[name].(collector.Prober)
+		if !ok {
+			unprobed = true
+			continue
+		}
+		adapterCheckers = append(adapterCheckers, health.NewAdapterHealthChecker(name, prober.Probe))
+	}
+
+	eventBus := events.NewBus(cfg.Health.EventLogSize)
+
 	// Use LogSender for dry-run mode, HTTPSender otherwise
 	var dataSender sender.Sender
+	groupSenders := make(map[string]sender.Sender)
+	var eventSender sender.Sender
+	reportToken := func() string { return cfg.Sender.Token }
 	if *dryRun {
-		dataSender = sender.NewLogSender(log)
+		logSender := sender.NewLogSender(log)
+		logSender.SetLogDiffs(cfg.Sender.LogDiffs, cfg.Sender.DiffEpsilon)
+		dataSender = logSender
 		log.Info("dry-run mode: data will be logged instead of sent")
 	} else {
-		dataSender = sender.NewHTTPSender(log, &cfg.Sender, cfg.Station.DBID)
+		switch cfg.Sender.Type {
+		case "http":
+			senderTLS, err := tlsutil.ClientConfig(cfg.Sender.TLS.CAFile, cfg.Sender.TLS.ReplaceSystemRoots)
+			if err != nil {
+				log.Error("failed to load sender CA bundle", sl.Err(err))
+				os.Exit(1)
+			}
+			httpSender := sender.NewHTTPSender(log, &cfg.Sender, cfg.Station.DBID, senderTLS)
+			var tokens *sender.FileTokenProvider
+			if cfg.Sender.TokenFile != "" {
+				tokens, err = sender.NewFileTokenProvider(cfg.Sender.TokenFile)
+				if err != nil {
+					log.Error("failed to load sender token", sl.Err(err))
+					os.Exit(1)
+				}
+				httpSender.SetTokenProvider(tokens)
+				reportToken = tokens.Token
+			}
+			dataSender = httpSender
+
+			for group, groupCfg := range cfg.Sender.Groups {
+				senderCfg := cfg.Sender
+				senderCfg.URL = groupCfg.URL
+				if groupCfg.Token != "" {
+					senderCfg.Token = groupCfg.Token
+				}
+				senderCfg.GroupURLs = nil
+				groupSender := sender.NewHTTPSender(log, &senderCfg, cfg.Station.DBID, senderTLS)
+				if tokens != nil && groupCfg.Token == "" {
+					groupSender.SetTokenProvider(tokens)
+				}
+				groupSenders[group] = groupSender
+				log.Info("group sender configured", slog.String("group", group))
+			}
+
+			if cfg.Sender.Events.URL != "" {
+				senderCfg := cfg.Sender
+				senderCfg.URL = cfg.Sender.Events.URL
+				if cfg.Sender.Events.Token != "" {
+					senderCfg.Token = cfg.Sender.Events.Token
+				}
+				senderCfg.GroupURLs = nil
+				httpEventSender := sender.NewHTTPSender(log, &senderCfg, cfg.Station.DBID, senderTLS)
+				if tokens != nil && cfg.Sender.Events.Token == "" {
+					httpEventSender.SetTokenProvider(tokens)
+				}
+				eventSender = httpEventSender
+				log.Info("event sender configured", slog.String("url", senderCfg.URL))
+			}
+		case "kafka":
+			senderTLS, err := tlsutil.ClientConfig(cfg.Sender.TLS.CAFile, cfg.Sender.TLS.ReplaceSystemRoots)
+			if err != nil {
+				log.Error("failed to load sender CA bundle", sl.Err(err))
+				os.Exit(1)
+			}
+			dataSender, err = sender.NewKafkaSender(log, &cfg.Sender, senderTLS)
+			if err != nil {
+				log.Error("failed to create kafka sender", sl.Err(err))
+				os.Exit(1)
+			}
+		case "influx":
+			senderTLS, err := tlsutil.ClientConfig(cfg.Sender.TLS.CAFile, cfg.Sender.TLS.ReplaceSystemRoots)
+			if err != nil {
+				log.Error("failed to load sender CA bundle", sl.Err(err))
+				os.Exit(1)
+			}
+			dataSender, err = sender.NewInfluxSender(log, &cfg.Sender, senderTLS)
+			if err != nil {
+				log.Error("failed to create influx sender", sl.Err(err))
+				os.Exit(1)
+			}
+		case "s3":
+			senderTLS, err := tlsutil.ClientConfig(cfg.Sender.TLS.CAFile, cfg.Sender.TLS.ReplaceSystemRoots)
+			if err != nil {
+				log.Error("failed to load sender CA bundle", sl.Err(err))
+				os.Exit(1)
+			}
+			dataSender, err = sender.NewS3Sender(log, &cfg.Sender, senderTLS)
+			if err != nil {
+				log.Error("failed to create s3 sender", sl.Err(err))
+				os.Exit(1)
+			}
+		default:
+			log.Error("unknown sender type", slog.String("type", cfg.Sender.Type))
+			os.Exit(1)
+		}
 	}
 
 	var buf buffer.Buffer
+	var bufLock *buffer.FileLock
 	if cfg.Buffer.Enabled && !*dryRun {
-		var err error
-		buf, err = buffer.NewSQLiteBuffer(log, cfg.Buffer.Path)
+		sqliteBuf, err := buffer.NewSQLiteBuffer(log, cfg.Buffer.Path)
 		if err != nil {
 			log.Error("failed to create buffer", sl.Err(err))
 			os.Exit(1)
 		}
+		// Held until exit so offline tools like "buffer flush" can tell the
+		// buffer is in use. The lock is advisory: collectors may share a
+		// buffer, and only the first of them holds it.
+		bufLock, err = buffer.Lock(cfg.Buffer.Path)
+		if errors.Is(err, buffer.ErrLocked) {
+			log.Warn("buffer is shared with another running collector", slog.String("path", cfg.Buffer.Path))
+		} else if err != nil {
+			log.Warn("failed to lock buffer", slog.String("path", cfg.Buffer.Path), sl.Err(err))
+		}
+		sqliteBuf.SetEventBus(eventBus)
+		sqliteBuf.SetCleanupBatchSize(cfg.Buffer.CleanupBatchSize)
+		sqliteBuf.SetDrainOrder(cfg.Buffer.DrainOrder)
+		buf = sqliteBuf
 		log.Info("buffer enabled", slog.String("path", cfg.Buffer.Path))
 	}
 
-	healthServer := health.NewServer(log, cfg.Health.Address)
+	healthServer := health.NewServer(log, &cfg.Health)
+	healthServer.SetEventBus(eventBus)
+	healthServer.SetInfo(map[string]any{
+		"build":              build,
+		"station_id":         stationCfg.StationID,
+		"station_name":       stationCfg.StationName,
+		"adapter":            stationCfg.Connection.Adapter,
+		"enabled_adapters":   enabledAdapters(stationCfg),
+		"available_adapters": adapterNames(),
+		"config_checksums":   checksums,
+		"started_at":         startedAt,
+	})
 
-	healthServer.AddChecker(health.NewSenderHealthChecker(dataSender.Health))
+	readiness := health.NewReadiness(cfg.Health.Readiness)
+	readiness.Mark(health.ReadinessConfig)
+	healthServer.SetReadiness(readiness)
 
-	if buf != nil {
-		if sqliteBuf, ok := buf.(*buffer.SQLiteBuffer); ok {
-			healthServer.AddChecker(health.NewBufferHealthChecker(sqliteBuf.Count))
+	// Extra senders are health-checked and closed alongside the default one.
+	extraSenders := make(map[string]sender.Sender, len(groupSenders)+1)
+	for group, groupSender := range groupSenders {
+		extraSenders["sender_"+group] = groupSender
+	}
+	if eventSender != nil {
+		extraSenders["sender_events"] = eventSender
+	}
+
+	healthServer.AddChecker(health.NewSenderHealthChecker("sender", senderHealthFunc(dataSender)))
+	for _, name := range slices.Sorted(maps.Keys(extraSenders)) {
+		healthServer.AddChecker(health.NewSenderHealthChecker(name, senderHealthFunc(extraSenders[name])))
+	}
+
+	for _, checker := range adapterCheckers {
+		healthServer.AddChecker(checker)
+	}
+
+	if cfg.Health.MaxGoroutines > 0 {
+		healthServer.AddChecker(health.NewGoroutineHealthChecker(cfg.Health.MaxGoroutines))
+	}
+
+	switch {
+	case cfg.Health.System.Enabled && !health.SystemStatsSupported:
+		log.Warn("system health check is not supported on this OS, skipping", slog.String("os", runtime.GOOS))
+	case cfg.Health.System.Enabled:
+		diskPath := "/"
+		if cfg.Buffer.Enabled {
+			diskPath = filepath.Dir(cfg.Buffer.Path)
 		}
+		healthServer.AddChecker(health.NewSystemHealthChecker(diskPath, &cfg.Health.System))
 	}
 
-	if err := healthServer.Start(); err != nil {
-		log.Error("failed to start health server", sl.Err(err))
-		os.Exit(1)
+	if buf != nil {
+		healthServer.AddChecker(health.NewBufferHealthChecker(buf.Count, buf.OldestPendingAge, &cfg.Buffer))
+	}
+
+	// A single -once cycle is over before anything could probe it.
+	if !*once {
+		if err := healthServer.Start(); err != nil {
+			if !errors.Is(err, health.ErrBind) || cfg.Health.BindError == "fail" {
+				log.Error("failed to start health server", sl.Err(err))
+				os.Exit(1)
+			}
+			log.Warn("health server unavailable, collecting without it", sl.Err(err))
+		}
 	}
 
 	manager := collector.NewManager(log, cfg, stationCfg, coll, dataSender, buf)
+	manager.SetReadiness(readiness)
+	manager.SetGroupSenders(groupSenders)
+	if eventSender != nil {
+		manager.SetEventSender(eventSender)
+	}
+	manager.SetEventBus(eventBus)
+	if store, ok := buf.(collector.SequenceStore); ok {
+		manager.SetSequenceStore(store)
+	} else if cfg.Envelope.IDStrategy == model.IDSequence {
+		log.Warn("sequence envelope ids are not persisted without the buffer and repeat after a restart")
+	}
+	if store, ok := buf.(collector.WatermarkStore); ok {
+		manager.SetWatermarkStore(store)
+	}
+	if sum, ok := checksums[cfg.Station.ConfigPath]; ok {
+		manager.SetEnvelopeMeta(map[string]string{collector.MetaConfigChecksum: sum})
+	}
+	if unprobed {
+		healthServer.AddChecker(health.NewCollectRatioHealthChecker(manager.CollectRatio))
+	}
+	if cfg.Watchdog.Enabled {
+		healthServer.AddChecker(health.NewWatchdogHealthChecker(func() (time.Time, time.Duration, int64) {
+			status := manager.WatchdogStatus()
+			return status.LastSuccess, status.Threshold, status.Resets
+		}))
+	}
+	healthServer.SetStatsFunc(func() any {
+		stats := map[string]any{
+			"drain":   manager.DrainStats(),
+			"devices": manager.DeviceStats(),
+		}
+		if httpSender, ok := dataSender.(*sender.HTTPSender); ok {
+			stats["sender"] = httpSender.Throughput()
+		}
+		return stats
+	})
+	healthServer.SetFlushFunc(manager.Flush)
+	healthServer.SetDrainFunc(manager.Drain)
+	healthServer.SetCollectFunc(func(ctx context.Context, deviceID string) (any, bool, error) {
+		return manager.CollectDevice(ctx, deviceID)
+	})
+	healthServer.SetSelfTestFunc(func(ctx context.Context, deviceIDs []string, checkBuffer bool) (any, bool, error) {
+		report, err := manager.SelfTest(ctx, deviceIDs, checkBuffer)
+		if err != nil {
+			return nil, false, err
+		}
+		return report, report.OK, nil
+	})
+	healthServer.SetHeartbeatFunc(func() []health.Heartbeat {
+		return manager.Heartbeats(cfg.Health.LivenessThreshold)
+	})
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -101,22 +383,130 @@ func main() {
 		cancel()
 	}()
 
-	manager.Start(ctx)
+	var reporter *health.Reporter
+	if cfg.Health.Report.Enabled && !*once {
+		if cfg.Health.Report.URL == "" {
+			log.Error("health report url is required when reporting is enabled")
+			os.Exit(1)
+		}
+		reportTLS, err := tlsutil.ClientConfig(cfg.Sender.TLS.CAFile, cfg.Sender.TLS.ReplaceSystemRoots)
+		if err != nil {
+			log.Error("failed to load health report CA bundle", sl.Err(err))
+			os.Exit(1)
+		}
+		reporter = health.NewReporter(log, healthServer, &cfg.Health.Report, reportTLS, reportToken, stationCfg.StationID,
+			func() any { return manager.DeviceStats() },
+		)
+		reporter.Start()
+	}
+
+	flushCh := make(chan os.Signal, 1)
+	signal.Notify(flushCh, syscall.SIGUSR1)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-flushCh:
+				drained, err := manager.Flush(ctx)
+				if err != nil {
+					log.Error("buffer flush failed", slog.Int("drained", drained), sl.Err(err))
+					continue
+				}
+				log.Info("buffer flushed on signal", slog.Int("drained", drained))
+			}
+		}
+	}()
+
+	exitCode := 0
+	if *once {
+		exitCode = runOnce(ctx, log, manager, *deviceFilter)
+	} else {
+		manager.Start(ctx)
+	}
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10)
 	defer shutdownCancel()
 
+	healthServer.SetDraining()
 	manager.Stop()
 
+	if reporter != nil {
+		reporter.Stop()
+	}
+
+	for _, tunnel := range tunnels {
+		if err := tunnel.Close(); err != nil {
+			log.Error("failed to close ssh tunnel", sl.Err(err))
+		}
+	}
+
 	if err := healthServer.Stop(shutdownCtx); err != nil {
 		log.Error("failed to stop health server", sl.Err(err))
 	}
 
+	if closer, ok := dataSender.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Error("failed to close sender", sl.Err(err))
+		}
+	}
+	for name, extra := range extraSenders {
+		if closer, ok := extra.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Error("failed to close sender", slog.String("sender", name), sl.Err(err))
+			}
+		}
+	}
+
 	if buf != nil {
 		if err := buf.Close(); err != nil {
 			log.Error("failed to close buffer", sl.Err(err))
 		}
 	}
 
+	if bufLock != nil {
+		bufLock.Unlock()
+	}
+
 	log.Info("collector stopped")
+	os.Exit(exitCode)
+}
+
+// senderHealthFunc returns the health probe of s for a SenderHealthChecker,
+// reusing the cached probe of an HTTPSender.
+func senderHealthFunc(s sender.Sender) func(ctx context.Context) (time.Duration, error) {
+	if httpSender, ok := s.(*sender.HTTPSender); ok {
+		return httpSender.CachedHealth
+	}
+	return func(ctx context.Context) (time.Duration, error) {
+		return 0, s.Health(ctx)
+	}
+}
+
+// runOnce runs a single collection cycle for -once, prints a one-line
+// summary to stdout and returns the exit code: 1 when a device failed or an
+// envelope was neither sent nor buffered.
+func runOnce(ctx context.Context, log *slog.Logger, manager *collector.Manager, deviceFilter string) int {
+	var deviceIDs []string
+	for _, id := range strings.Split(deviceFilter, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			deviceIDs = append(deviceIDs, id)
+		}
+	}
+
+	result, err := manager.RunOnce(ctx, deviceIDs)
+	if err != nil {
+		log.Error("single cycle failed", sl.Err(err))
+		return 1
+	}
+
+	fmt.Printf("devices ok=%d failed=%d envelopes sent=%d buffered=%d failed=%d\n",
+		result.DevicesOK, result.DevicesFailed,
+		result.EnvelopesSent, result.EnvelopesBuffered, result.EnvelopesFailed)
+
+	if result.DevicesFailed > 0 || result.EnvelopesFailed > 0 {
+		return 1
+	}
+	return 0
 }
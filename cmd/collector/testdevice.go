@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/collector"
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/lib/sshtunnel"
+	"github.com/speedwagon-io/asutp/internal/model"
+	"github.com/speedwagon-io/asutp/internal/sender"
+)
+
+const testDeviceUsage = "usage: collector test-device -config <path> -device <id> | -device-file <path> [-raw] [-max-bad <fraction>]"
+
+// runTestDeviceCommand implements "collector test-device", which collects a
+// single device once and prints its data points and envelope, for
+// commissioning a device without restarting the collector. It exits non-zero
+// when the collect fails or the share of bad points exceeds -max-bad.
+func runTestDeviceCommand(args []string) int {
+	fs := flag.NewFlagSet("test-device", flag.ExitOnError)
+	configPath := fs.String("config", "", "config file, directory or comma-separated list of files")
+	deviceID := fs.String("device", "", "id of a device in the station config")
+	deviceFile := fs.String("device-file", "", "YAML file with an ad-hoc device definition")
+	showRaw := fs.Bool("raw", false, "show the raw source response and values")
+	maxBad := fs.Float64("max-bad", 0, "fraction of bad points tolerated before failing")
+	fs.Parse(args)
+
+	if (*deviceID == "") == (*deviceFile == "") {
+		fmt.Fprintln(os.Stderr, testDeviceUsage)
+		return 2
+	}
+
+	cfg := config.MustLoad(*configPath)
+	// Log to stderr so stdout holds only the table and envelope.
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	stationCfg, err := config.LoadStation(cfg.Station.ConfigPath)
+	if err != nil {
+		log.Error("failed to load station config", sl.Err(err))
+		return 1
+	}
+
+	if *deviceFile != "" {
+		device, err := stationCfg.AddDeviceFile(*deviceFile)
+		if err != nil {
+			log.Error("failed to load device", slog.String("path", *deviceFile), sl.Err(err))
+			return 1
+		}
+		*deviceID = device.ID
+	}
+
+	if *showRaw {
+		for i := range stationCfg.Devices {
+			stationCfg.Devices[i].RawPassthrough = true
+			for j := range stationCfg.Devices[i].Fields {
+				stationCfg.Devices[i].Fields[j].KeepRaw = true
+			}
+		}
+	}
+
+	coll, _, tunnels, err := newStationCollector(log, stationCfg)
+	defer func() {
+		for _, tunnel := range tunnels {
+			tunnel.Close()
+		}
+	}()
+	if err != nil {
+		log.Error("failed to create collector", sl.Err(err))
+		return 1
+	}
+	defer coll.Close()
+
+	manager := collector.NewManager(log, cfg, stationCfg, coll, sender.NewLogSender(log), nil)
+
+	ctx := context.Background()
+	started := time.Now()
+	data, found, err := manager.CollectDevice(ctx, *deviceID)
+	elapsed := time.Since(started)
+	if !found {
+		log.Error("device not found in station config", slog.String("device_id", *deviceID))
+		return 1
+	}
+	if err != nil {
+		log.Error("collect failed",
+			slog.String("device_id", *deviceID),
+			slog.Duration("elapsed", elapsed),
+			sl.Err(err),
+		)
+		return 1
+	}
+
+	bad := printDataPoints(data.DataPoints, *showRaw)
+	fmt.Println()
+
+	if *showRaw && len(data.Raw) > 0 {
+		fmt.Printf("raw response:\n%s\n\n", data.Raw)
+	}
+
+	envelope, err := manager.PreviewEnvelope(ctx, data)
+	if err != nil {
+		log.Error("failed to build envelope", sl.Err(err))
+		return 1
+	}
+	out, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		log.Error("failed to encode envelope", sl.Err(err))
+		return 1
+	}
+	fmt.Printf("%s\n\n", out)
+
+	fmt.Printf("collected %d points (%d bad) from %s in %s\n",
+		len(data.DataPoints), bad, *deviceID, elapsed.Round(time.Millisecond))
+
+	if len(data.DataPoints) > 0 && float64(bad)/float64(len(data.DataPoints)) > *maxBad {
+		log.Error("too many bad points",
+			slog.Int("bad", bad),
+			slog.Int("total", len(data.DataPoints)),
+			slog.Float64("max_bad", *maxBad),
+		)
+		return 1
+	}
+
+	return 0
+}
+
+// printDataPoints writes the points as a table to stdout and returns the
+// number of bad points.
+func printDataPoints(points []model.DataPoint, showRaw bool) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "NAME\tVALUE\tUNIT\tQUALITY\tREASON\tSEVERITY"
+	if showRaw {
+		header += "\tRAW"
+	}
+	fmt.Fprintln(w, header)
+
+	bad := 0
+	for _, dp := range points {
+		if dp.Quality == model.QualityBad {
+			bad++
+		}
+		row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s", dp.Name, dp.Value, dp.Unit, dp.Quality, dp.QualityReason, dp.Severity)
+		if showRaw {
+			raw := ""
+			if dp.Raw != nil {
+				raw = fmt.Sprintf("%v", dp.Raw)
+			}
+			row += "\t" + raw
+		}
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
+
+	return bad
+}
+
+// newStationCollector builds the station's default collector, wrapped in a
+// MultiCollector when named connections are configured. adapters holds each
+// underlying collector by health checker name: "adapter" for the default
+// connection and "adapter_<name>" for named ones. The returned tunnels must
+// be closed by the caller, also on error.
+func newStationCollector(log *slog.Logger, stationCfg *config.StationConfig) (coll collector.Collector, adapters map[string]collector.Collector, tunnels []*sshtunnel.Tunnel, err error) {
+	coll, tunnel, err := newCollector(log, &stationCfg.Connection)
+	if tunnel != nil {
+		tunnels = append(tunnels, tunnel)
+	}
+	if err != nil {
+		return nil, nil, tunnels, err
+	}
+	adapters = map[string]collector.Collector{"adapter": coll}
+
+	if len(stationCfg.Connections) == 0 {
+		return coll, adapters, tunnels, nil
+	}
+
+	named := make(map[string]collector.Collector, len(stationCfg.Connections))
+	for name := range stationCfg.Connections {
+		conn := stationCfg.Connections[name]
+		namedColl, tunnel, err := newCollector(log, &conn)
+		if tunnel != nil {
+			tunnels = append(tunnels, tunnel)
+		}
+		if err != nil {
+			return nil, nil, tunnels, fmt.Errorf("connection %s: %w", name, err)
+		}
+		named[name] = namedColl
+		adapters["adapter_"+name] = namedColl
+	}
+	return collector.NewMultiCollector(log, coll, named), adapters, tunnels, nil
+}
@@ -0,0 +1,184 @@
+package buffer
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// exportRecord is one NDJSON line of a buffer export.
+type exportRecord struct {
+	Envelope  *model.Envelope `json:"envelope"`
+	Sent      bool            `json:"sent"`
+	CreatedAt time.Time       `json:"created_at"`
+	Priority  int             `json:"priority,omitempty"`
+
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// Export writes every buffered envelope with its sent state to w as NDJSON,
+// oldest first. Rows that cannot be decoded are logged and skipped, so one
+// corrupt row does not block rescuing the rest. It returns the number of
+// envelopes written and of rows skipped.
+func (b *SQLiteBuffer) Export(ctx context.Context, w io.Writer) (exported, skipped int, err error) {
+	rows, err := b.db.QueryContext(ctx,
+		"SELECT "+envelopeColumns+", sent, created_at, rowid FROM buffer ORDER BY created_at ASC")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query envelopes: %w", err)
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		rec, rowID, err := b.scanExportRecord(rows)
+		if err != nil {
+			skipped++
+			b.log.Warn("skipping unreadable buffer row", slog.Int64("rowid", rowID), sl.Err(err))
+			continue
+		}
+		if err := enc.Encode(rec); err != nil {
+			return exported, skipped, fmt.Errorf("failed to write envelope: %w", err)
+		}
+		exported++
+	}
+
+	return exported, skipped, rows.Err()
+}
+
+// scanExportRecord decodes a row selected by Export. The rowid is returned
+// also on error, as far as it could be read, to identify the bad row.
+func (b *SQLiteBuffer) scanExportRecord(rows *sql.Rows) (exportRecord, int64, error) {
+	var (
+		sent      int
+		createdAt string
+		rowID     int64
+	)
+	envelope, err := b.scanEnvelope(rows, &sent, &createdAt, &rowID)
+	if err != nil {
+		return exportRecord{}, rowID, err
+	}
+
+	created, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return exportRecord{}, rowID, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+
+	return exportRecord{
+		Envelope:      envelope,
+		Sent:          sent != 0,
+		CreatedAt:     created,
+		Priority:      envelope.Priority,
+		CorrelationID: envelope.CorrelationID,
+	}, rowID, nil
+}
+
+// Import reads an NDJSON export from r and stores its envelopes, keeping
+// their sent state and creation time. Envelopes already present are skipped.
+// It returns the number of envelopes imported.
+func (b *SQLiteBuffer) Import(ctx context.Context, r io.Reader) (int, error) {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT OR IGNORE INTO buffer (id, station_id, station_name, device_id, device_name, device_group, timestamp, values_json, created_at, collector_version, metadata_json, schema_version, meta_json, sequence, timestamp_unix_nano, priority, raw_json, correlation_id, sent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	count, line := 0, 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec exportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return 0, fmt.Errorf("failed to decode line %d: %w", line, err)
+		}
+		if rec.Envelope == nil {
+			return 0, fmt.Errorf("line %d has no envelope", line)
+		}
+
+		envelope := rec.Envelope
+		valuesJSON, err := json.Marshal(envelope.Values)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal values: %w", err)
+		}
+
+		metadataJSON, err := marshalStringMap(envelope.Metadata)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+
+		metaJSON, err := marshalStringMap(envelope.Meta)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal meta: %w", err)
+		}
+
+		createdAt := rec.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+
+		sent := 0
+		if rec.Sent {
+			sent = 1
+		}
+
+		result, err := stmt.ExecContext(ctx,
+			envelope.ID,
+			envelope.StationID,
+			envelope.StationName,
+			envelope.DeviceID,
+			envelope.DeviceName,
+			envelope.DeviceGroup,
+			envelope.Timestamp.Format(time.RFC3339Nano),
+			string(valuesJSON),
+			createdAt.UTC().Format(time.RFC3339),
+			envelope.CollectorVersion,
+			metadataJSON,
+			envelope.SchemaVersion,
+			metaJSON,
+			envelope.Sequence,
+			envelope.Timestamp.UnixNano(),
+			rec.Priority,
+			string(envelope.Raw),
+			rec.CorrelationID,
+			sent,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to import envelope %s: %w", envelope.ID, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read import: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	b.log.Info("imported buffer envelopes", slog.Int("imported", count), slog.Int("lines", line))
+	return count, nil
+}
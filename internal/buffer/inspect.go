@@ -0,0 +1,88 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Stats summarizes the buffer contents. Sent counts rows kept with the sent
+// flag, e.g. from an import; sent envelopes are normally deleted. Bytes is
+// the size of the database file and its WAL.
+type Stats struct {
+	Pending       int64         `json:"pending"`
+	Sent          int64         `json:"sent"`
+	OldestPending time.Duration `json:"oldest_pending"`
+	Bytes         int64         `json:"bytes"`
+}
+
+// Entry is the summary of one buffered envelope.
+type Entry struct {
+	ID        string    `json:"id"`
+	DeviceID  string    `json:"device_id"`
+	Timestamp time.Time `json:"timestamp"`
+	CreatedAt time.Time `json:"created_at"`
+	Priority  int       `json:"priority,omitempty"`
+	Sent      bool      `json:"sent"`
+}
+
+// Stats returns counts, the oldest pending age and the on-disk size.
+func (b *SQLiteBuffer) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	err := b.db.QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(sent = 0), 0), COALESCE(SUM(sent != 0), 0) FROM buffer",
+	).Scan(&stats.Pending, &stats.Sent)
+	if err != nil {
+		return stats, fmt.Errorf("failed to count envelopes: %w", err)
+	}
+
+	stats.OldestPending, err = b.OldestPendingAge(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, path := range []string{b.path, b.path + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			stats.Bytes += info.Size()
+		}
+	}
+
+	return stats, nil
+}
+
+// List returns up to limit buffered envelopes, oldest first.
+func (b *SQLiteBuffer) List(ctx context.Context, limit int) ([]Entry, error) {
+	rows, err := b.db.QueryContext(ctx, `
+		SELECT id, device_id, timestamp, created_at, priority, sent
+		FROM buffer
+		ORDER BY created_at ASC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query envelopes: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var (
+			entry                Entry
+			timestamp, createdAt string
+			sent                 int
+		)
+		if err := rows.Scan(&entry.ID, &entry.DeviceID, &timestamp, &createdAt, &entry.Priority, &sent); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if entry.Timestamp, err = time.Parse(time.RFC3339, timestamp); err != nil {
+			return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+		if entry.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, fmt.Errorf("failed to parse created_at: %w", err)
+		}
+		entry.Sent = sent != 0
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
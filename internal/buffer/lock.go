@@ -0,0 +1,37 @@
+package buffer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLocked is returned by Lock when another process, normally a running
+// collector, holds the buffer.
+var ErrLocked = errors.New("buffer is locked by another process")
+
+// FileLock is an exclusive advisory lock on a buffer.
+type FileLock struct {
+	f *os.File
+}
+
+// Lock takes an exclusive lock on dbPath+".lock" without waiting. The
+// collector holds it while running, so tools that must not race its drain
+// loop, such as an offline flush, can refuse instead. SQLite's own WAL
+// locking already makes plain reads and deletes safe alongside it.
+func Lock(dbPath string) (*FileLock, error) {
+	f, err := os.OpenFile(dbPath+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open buffer lock: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileLock{f: f}, nil
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	return l.f.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package buffer
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable; the lock then does not
+// detect a running collector.
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,71 @@
+package buffer
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestNextSequenceSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.db")
+	ctx := context.Background()
+
+	buf, err := NewSQLiteBuffer(discardLogger(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(1); want <= 3; want++ {
+		got, err := buf.NextSequence(ctx, "meter1")
+		if err != nil || got != want {
+			t.Fatalf("NextSequence = %d, %v, want %d", got, err, want)
+		}
+	}
+	buf.Close()
+
+	buf = openTestBuffer(t, path)
+	if got, err := buf.NextSequence(ctx, "meter1"); err != nil || got != 4 {
+		t.Fatalf("NextSequence after restart = %d, %v, want 4", got, err)
+	}
+	if got, err := buf.NextSequence(ctx, "meter2"); err != nil || got != 1 {
+		t.Fatalf("NextSequence of a new device = %d, %v, want 1", got, err)
+	}
+}
+
+func TestNextSequenceConcurrent(t *testing.T) {
+	buf := newTestBuffer(t)
+	ctx := context.Background()
+
+	const workers, perWorker = 8, 25
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = make(map[uint64]bool)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				seq, err := buf.NextSequence(ctx, "meter1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if seen[seq] {
+					t.Errorf("sequence %d assigned twice", seq)
+				}
+				seen[seq] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for seq := uint64(1); seq <= workers*perWorker; seq++ {
+		if !seen[seq] {
+			t.Fatalf("sequence %d never assigned", seq)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/speedwagon-io/asutp/internal/events"
 	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
 	"github.com/speedwagon-io/asutp/internal/model"
 )
@@ -18,14 +20,33 @@ import (
 type Buffer interface {
 	Store(ctx context.Context, envelope *model.Envelope) error
 	GetPending(ctx context.Context, limit int) ([]*model.Envelope, error)
+	Get(ctx context.Context, id string) (*model.Envelope, error)
 	MarkSent(ctx context.Context, ids []string) error
 	Cleanup(ctx context.Context, maxAge time.Duration) error
+	Count(ctx context.Context) (int64, error)
+	// OldestPendingAge returns the age of the oldest pending envelope, or 0
+	// when the buffer is empty.
+	OldestPendingAge(ctx context.Context) (time.Duration, error)
+	// Probe stores and re-reads envelope without it ever becoming pending.
+	Probe(ctx context.Context, envelope *model.Envelope) error
 	Close() error
 }
 
+const defaultCleanupBatchSize = 500
+
+// Drain orders for GetPending.
+const (
+	OrderCreatedAt = "created_at"
+	OrderTimestamp = "timestamp"
+)
+
 type SQLiteBuffer struct {
-	log *slog.Logger
-	db  *sql.DB
+	log              *slog.Logger
+	path             string
+	db               *sql.DB
+	events           *events.Bus
+	cleanupBatchSize int
+	orderColumn      string
 }
 
 func NewSQLiteBuffer(log *slog.Logger, dbPath string) (*SQLiteBuffer, error) {
@@ -44,8 +65,11 @@ func NewSQLiteBuffer(log *slog.Logger, dbPath string) (*SQLiteBuffer, error) {
 	}
 
 	buf := &SQLiteBuffer{
-		log: log,
-		db:  db,
+		log:              log,
+		path:             dbPath,
+		db:               db,
+		cleanupBatchSize: defaultCleanupBatchSize,
+		orderColumn:      "created_at",
 	}
 
 	if err := buf.migrate(); err != nil {
@@ -55,6 +79,30 @@ func NewSQLiteBuffer(log *slog.Logger, dbPath string) (*SQLiteBuffer, error) {
 	return buf, nil
 }
 
+// SetCleanupBatchSize limits how many rows a single cleanup DELETE removes,
+// so cleanup never holds the write lock for long.
+func (b *SQLiteBuffer) SetCleanupBatchSize(size int) {
+	if size > 0 {
+		b.cleanupBatchSize = size
+	}
+}
+
+// SetDrainOrder selects whether GetPending returns envelopes of equal
+// priority in insertion order (OrderCreatedAt) or by measurement time
+// (OrderTimestamp).
+func (b *SQLiteBuffer) SetDrainOrder(order string) {
+	if order == OrderTimestamp {
+		b.orderColumn = "timestamp_unix_nano"
+	} else {
+		b.orderColumn = "created_at"
+	}
+}
+
+// SetEventBus registers the bus that buffer evictions are published to.
+func (b *SQLiteBuffer) SetEventBus(bus *events.Bus) {
+	b.events = bus
+}
+
 func (b *SQLiteBuffer) migrate() error {
 	query := `
 		CREATE TABLE IF NOT EXISTS buffer (
@@ -72,47 +120,250 @@ func (b *SQLiteBuffer) migrate() error {
 		CREATE INDEX IF NOT EXISTS idx_buffer_sent ON buffer(sent);
 		CREATE INDEX IF NOT EXISTS idx_buffer_created_at ON buffer(created_at);
 	`
-	_, err := b.db.Exec(query)
-	return err
+	if _, err := b.db.Exec(query); err != nil {
+		return err
+	}
+
+	if err := b.addColumn("collector_version", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := b.addColumn("metadata_json", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := b.addColumn("schema_version", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := b.addColumn("meta_json", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := b.addColumn("sequence", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// The text timestamp column does not sort chronologically, since
+	// RFC3339Nano drops trailing zeros of the fraction.
+	if err := b.addColumn("timestamp_unix_nano", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := b.addColumn("priority", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := b.addColumn("raw_json", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := b.addColumn("correlation_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	_, err := b.db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_buffer_timestamp ON buffer(timestamp_unix_nano);
+		CREATE TABLE IF NOT EXISTS sequences (
+			device_id TEXT PRIMARY KEY,
+			last INTEGER NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS watermarks (
+			device_id TEXT PRIMARY KEY,
+			unix_nano INTEGER NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	return b.backfillTimestamps()
+}
+
+// backfillTimestamps fills timestamp_unix_nano for rows written before the
+// column existed, so they sort correctly under OrderTimestamp instead of
+// all coming first.
+func (b *SQLiteBuffer) backfillTimestamps() error {
+	rows, err := b.db.Query("SELECT id, timestamp FROM buffer WHERE timestamp_unix_nano = 0")
+	if err != nil {
+		return fmt.Errorf("failed to query rows without unix timestamp: %w", err)
+	}
+
+	backfill := make(map[string]int64)
+	for rows.Next() {
+		var id, timestamp string
+		if err := rows.Scan(&id, &timestamp); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		ts, err := time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			b.log.Warn("cannot backfill unix timestamp", slog.String("id", id), sl.Err(err))
+			continue
+		}
+		backfill[id] = ts.UnixNano()
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(backfill) == 0 {
+		return nil
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for id, unixNano := range backfill {
+		if _, err := tx.Exec("UPDATE buffer SET timestamp_unix_nano = ? WHERE id = ?", unixNano, id); err != nil {
+			return fmt.Errorf("failed to backfill unix timestamp: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	b.log.Info("backfilled unix timestamps of buffered envelopes", slog.Int("count", len(backfill)))
+	return nil
+}
+
+// addColumn adds a column to the buffer table if it does not exist yet, so
+// databases created by older versions keep working.
+func (b *SQLiteBuffer) addColumn(name, definition string) error {
+	rows, err := b.db.Query("PRAGMA table_info(buffer)")
+	if err != nil {
+		return fmt.Errorf("failed to read table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid                 int
+			colName, colType    string
+			notNull, primaryKey int
+			defaultValue        sql.NullString
+		)
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if colName == name {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := b.db.Exec("ALTER TABLE buffer ADD COLUMN " + name + " " + definition); err != nil {
+		return fmt.Errorf("failed to add column %s: %w", name, err)
+	}
+	return nil
+}
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 }
 
 func (b *SQLiteBuffer) Store(ctx context.Context, envelope *model.Envelope) error {
+	if err := b.insert(ctx, b.db, envelope); err != nil {
+		return err
+	}
+	b.log.Debug("envelope stored in buffer", slog.String("id", envelope.ID))
+	return nil
+}
+
+// Probe stores envelope and reads it back inside a transaction that is rolled
+// back, so it exercises the write path without a drain ever seeing the
+// envelope.
+func (b *SQLiteBuffer) Probe(ctx context.Context, envelope *model.Envelope) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := b.insert(ctx, tx, envelope); err != nil {
+		return err
+	}
+
+	stored, err := b.get(ctx, tx, envelope.ID)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return errors.New("stored envelope not found on re-read")
+	}
+	if len(stored.Values) != len(envelope.Values) {
+		return fmt.Errorf("re-read envelope has %d values, want %d", len(stored.Values), len(envelope.Values))
+	}
+	return nil
+}
+
+func (b *SQLiteBuffer) insert(ctx context.Context, db dbtx, envelope *model.Envelope) error {
 	valuesJSON, err := json.Marshal(envelope.Values)
 	if err != nil {
 		return fmt.Errorf("failed to marshal values: %w", err)
 	}
 
+	metadataJSON, err := marshalStringMap(envelope.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	metaJSON, err := marshalStringMap(envelope.Meta)
+	if err != nil {
+		return fmt.Errorf("failed to marshal meta: %w", err)
+	}
+
+	// Hash IDs are derived from the reading, so an envelope already in the
+	// buffer under the same ID is the same reading and is kept as is.
 	query := `
-		INSERT INTO buffer (id, station_id, station_name, device_id, device_name, device_group, timestamp, values_json, created_at, sent)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
+		INSERT INTO buffer (id, station_id, station_name, device_id, device_name, device_group, timestamp, values_json, created_at, collector_version, metadata_json, schema_version, meta_json, sequence, timestamp_unix_nano, priority, raw_json, correlation_id, sent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
+		ON CONFLICT(id) DO NOTHING
 	`
 
-	_, err = b.db.ExecContext(ctx, query,
+	res, err := db.ExecContext(ctx, query,
 		envelope.ID,
 		envelope.StationID,
 		envelope.StationName,
 		envelope.DeviceID,
 		envelope.DeviceName,
 		envelope.DeviceGroup,
-		envelope.Timestamp.Format(time.RFC3339),
+		envelope.Timestamp.Format(time.RFC3339Nano),
 		string(valuesJSON),
 		time.Now().UTC().Format(time.RFC3339),
+		envelope.CollectorVersion,
+		metadataJSON,
+		envelope.SchemaVersion,
+		metaJSON,
+		envelope.Sequence,
+		envelope.Timestamp.UnixNano(),
+		envelope.Priority,
+		string(envelope.Raw),
+		envelope.CorrelationID,
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to store envelope: %w", err)
 	}
-
-	b.log.Debug("envelope stored in buffer", slog.String("id", envelope.ID))
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		b.log.Debug("envelope already buffered", slog.String("id", envelope.ID))
+	}
 	return nil
 }
 
 func (b *SQLiteBuffer) GetPending(ctx context.Context, limit int) ([]*model.Envelope, error) {
 	query := `
-		SELECT id, station_id, station_name, device_id, device_name, device_group, timestamp, values_json
+		SELECT ` + envelopeColumns + `
 		FROM buffer
 		WHERE sent = 0
-		ORDER BY created_at ASC
+		ORDER BY priority DESC, ` + b.orderColumn + ` ASC
 		LIMIT ?
 	`
 
@@ -124,40 +375,157 @@ func (b *SQLiteBuffer) GetPending(ctx context.Context, limit int) ([]*model.Enve
 
 	var envelopes []*model.Envelope
 	for rows.Next() {
-		var (
-			id, stationID, stationName, deviceID, deviceName, deviceGroup, timestampStr, valuesJSON string
-		)
-
-		if err := rows.Scan(&id, &stationID, &stationName, &deviceID, &deviceName, &deviceGroup, &timestampStr, &valuesJSON); err != nil {
-			b.log.Error("failed to scan row", sl.Err(err))
+		envelope, err := b.scanEnvelope(rows)
+		if err != nil {
+			b.log.Error("failed to read buffered envelope", sl.Err(err))
 			continue
 		}
+		envelopes = append(envelopes, envelope)
+	}
 
-		timestamp, err := time.Parse(time.RFC3339, timestampStr)
-		if err != nil {
-			b.log.Error("failed to parse timestamp", sl.Err(err))
-			continue
+	return envelopes, rows.Err()
+}
+
+// Get returns the buffered envelope with the given id, or nil if there is none.
+func (b *SQLiteBuffer) Get(ctx context.Context, id string) (*model.Envelope, error) {
+	return b.get(ctx, b.db, id)
+}
+
+func (b *SQLiteBuffer) get(ctx context.Context, db dbtx, id string) (*model.Envelope, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+envelopeColumns+" FROM buffer WHERE id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query envelope: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return b.scanEnvelope(rows)
+}
+
+const envelopeColumns = "id, station_id, station_name, device_id, device_name, device_group, timestamp, values_json, collector_version, metadata_json, schema_version, meta_json, sequence, priority, raw_json, correlation_id"
+
+// scanEnvelope decodes a row selected with envelopeColumns, followed by any
+// extra destinations.
+func (b *SQLiteBuffer) scanEnvelope(rows *sql.Rows, extra ...any) (*model.Envelope, error) {
+	var (
+		id, stationID, stationName, deviceID, deviceName, deviceGroup, timestampStr, valuesJSON, collectorVersion, metadataJSON, schemaVersion, metaJSON, rawJSON, correlationID string
+	)
+	var (
+		sequence uint64
+		priority int
+	)
+
+	dest := append([]any{&id, &stationID, &stationName, &deviceID, &deviceName, &deviceGroup, &timestampStr, &valuesJSON, &collectorVersion, &metadataJSON, &schemaVersion, &metaJSON, &sequence, &priority, &rawJSON, &correlationID}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, timestampStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+	}
+
+	var values []model.DataPoint
+	if err := json.Unmarshal([]byte(valuesJSON), &values); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal values: %w", err)
+	}
+	model.InternPoints(values)
+
+	var metadata map[string]string
+	if metadataJSON != "" {
+		if err := json.Unmarshal([]byte(metadataJSON), &metadata); err != nil {
+			b.log.Error("failed to unmarshal metadata", sl.Err(err))
 		}
+	}
 
-		var values []model.DataPoint
-		if err := json.Unmarshal([]byte(valuesJSON), &values); err != nil {
-			b.log.Error("failed to unmarshal values", sl.Err(err))
-			continue
+	var meta map[string]string
+	if metaJSON != "" {
+		if err := json.Unmarshal([]byte(metaJSON), &meta); err != nil {
+			b.log.Error("failed to unmarshal meta", sl.Err(err))
 		}
+	}
+
+	envelope := &model.Envelope{
+		ID:          id,
+		StationID:   stationID,
+		StationName: stationName,
+		DeviceID:    deviceID,
+		DeviceName:  deviceName,
+		DeviceGroup: deviceGroup,
+		Timestamp:   timestamp,
+		Values:      values,
+
+		CollectorVersion: collectorVersion,
+		Metadata:         metadata,
+		SchemaVersion:    schemaVersion,
+		Meta:             meta,
+		Sequence:         sequence,
+		Priority:         priority,
+		CorrelationID:    correlationID,
+	}
+	if rawJSON != "" {
+		envelope.Raw = json.RawMessage(rawJSON)
+	}
+	return envelope, nil
+}
 
-		envelopes = append(envelopes, &model.Envelope{
-			ID:          id,
-			StationID:   stationID,
-			StationName: stationName,
-			DeviceID:    deviceID,
-			DeviceName:  deviceName,
-			DeviceGroup: deviceGroup,
-			Timestamp:   timestamp,
-			Values:      values,
-		})
+// NextSequence increments and returns the persisted sequence number of a
+// device. The increment is a single statement, so concurrent callers never
+// get the same number.
+func (b *SQLiteBuffer) NextSequence(ctx context.Context, deviceID string) (uint64, error) {
+	var next uint64
+	err := b.db.QueryRowContext(ctx, `
+		INSERT INTO sequences (device_id, last) VALUES (?, 1)
+		ON CONFLICT(device_id) DO UPDATE SET last = last + 1
+		RETURNING last
+	`, deviceID).Scan(&next)
+	if err != nil {
+		return 0, fmt.Errorf("failed to assign sequence: %w", err)
 	}
+	return next, nil
+}
 
-	return envelopes, rows.Err()
+// Watermark returns the newest timestamp recorded for a device with
+// SetWatermark, or the zero time when there is none.
+func (b *SQLiteBuffer) Watermark(ctx context.Context, deviceID string) (time.Time, error) {
+	var unixNano int64
+	err := b.db.QueryRowContext(ctx,
+		"SELECT unix_nano FROM watermarks WHERE device_id = ?", deviceID,
+	).Scan(&unixNano)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read watermark: %w", err)
+	}
+	return time.Unix(0, unixNano).UTC(), nil
+}
+
+// SetWatermark persists t as the device watermark unless a newer one is
+// already recorded.
+func (b *SQLiteBuffer) SetWatermark(ctx context.Context, deviceID string, t time.Time) error {
+	_, err := b.db.ExecContext(ctx, `
+		INSERT INTO watermarks (device_id, unix_nano) VALUES (?, ?)
+		ON CONFLICT(device_id) DO UPDATE SET unix_nano = MAX(unix_nano, excluded.unix_nano)
+	`, deviceID, t.UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to store watermark: %w", err)
+	}
+	return nil
+}
+
+// marshalStringMap encodes m as JSON, or as an empty string when m is empty.
+func marshalStringMap(m map[string]string) (string, error) {
+	if len(m) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
 
 func (b *SQLiteBuffer) MarkSent(ctx context.Context, ids []string) error {
@@ -192,21 +560,45 @@ func (b *SQLiteBuffer) MarkSent(ctx context.Context, ids []string) error {
 }
 
 func (b *SQLiteBuffer) Cleanup(ctx context.Context, maxAge time.Duration) error {
-	cutoff := time.Now().UTC().Add(-maxAge).Format(time.RFC3339)
-
-	result, err := b.db.ExecContext(ctx, "DELETE FROM buffer WHERE created_at < ?", cutoff)
+	deleted, err := b.Purge(ctx, maxAge)
 	if err != nil {
-		return fmt.Errorf("failed to cleanup old envelopes: %w", err)
+		return err
 	}
 
-	deleted, _ := result.RowsAffected()
 	if deleted > 0 {
 		b.log.Info("cleaned up old buffer entries", slog.Int64("deleted", deleted))
+		b.events.Publish(events.LevelWarn, events.KindBufferEvicted, "",
+			fmt.Sprintf("evicted %d entries older than %s", deleted, maxAge))
 	}
 
 	return nil
 }
 
+// Purge deletes envelopes buffered more than maxAge ago, in batches of the
+// cleanup batch size, and returns how many were deleted.
+func (b *SQLiteBuffer) Purge(ctx context.Context, maxAge time.Duration) (int64, error) {
+	cutoff := time.Now().UTC().Add(-maxAge).Format(time.RFC3339)
+
+	var deleted int64
+	for {
+		result, err := b.db.ExecContext(ctx,
+			"DELETE FROM buffer WHERE rowid IN (SELECT rowid FROM buffer WHERE created_at < ? LIMIT ?)",
+			cutoff, b.cleanupBatchSize,
+		)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to cleanup old envelopes: %w", err)
+		}
+
+		n, _ := result.RowsAffected()
+		deleted += n
+		if n < int64(b.cleanupBatchSize) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return deleted, nil
+}
+
 func (b *SQLiteBuffer) Close() error {
 	return b.db.Close()
 }
@@ -216,3 +608,20 @@ func (b *SQLiteBuffer) Count(ctx context.Context) (int64, error) {
 	err := b.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM buffer WHERE sent = 0").Scan(&count)
 	return count, err
 }
+
+func (b *SQLiteBuffer) OldestPendingAge(ctx context.Context) (time.Duration, error) {
+	var oldest sql.NullString
+	err := b.db.QueryRowContext(ctx, "SELECT MIN(created_at) FROM buffer WHERE sent = 0").Scan(&oldest)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query oldest pending envelope: %w", err)
+	}
+	if !oldest.Valid {
+		return 0, nil
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, oldest.String)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+	return time.Since(createdAt), nil
+}
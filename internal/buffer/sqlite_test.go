@@ -0,0 +1,186 @@
+package buffer
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func newTestBuffer(t *testing.T) *SQLiteBuffer {
+	t.Helper()
+	return openTestBuffer(t, filepath.Join(t.TempDir(), "buffer.db"))
+}
+
+func openTestBuffer(t *testing.T, path string) *SQLiteBuffer {
+	t.Helper()
+	buf, err := NewSQLiteBuffer(discardLogger(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { buf.Close() })
+	return buf
+}
+
+// createLegacyBuffer writes a database with the original buffer schema and
+// one unversioned row, as written before schema versioning.
+func createLegacyBuffer(t *testing.T, path string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE buffer (
+			id TEXT PRIMARY KEY,
+			station_id TEXT NOT NULL,
+			station_name TEXT,
+			device_id TEXT NOT NULL,
+			device_name TEXT,
+			device_group TEXT,
+			timestamp TEXT NOT NULL,
+			values_json TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			sent INTEGER DEFAULT 0
+		);
+		INSERT INTO buffer (id, station_id, station_name, device_id, device_name, device_group, timestamp, values_json, created_at)
+		VALUES ('old', 'st1', 'Station 1', 'meter1', 'Meter 1', 'meters', '2024-03-01T12:00:00.5Z',
+			'[{"name":"counter","value":9007199254740993,"quality":"good"}]', '2024-03-01T12:00:01Z');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyRowsDecode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.db")
+	createLegacyBuffer(t, path)
+	buf := openTestBuffer(t, path)
+	ctx := context.Background()
+
+	stored := model.NewEnvelope("st1", "Station 1", "meter1", "Meter 1", "meters",
+		[]model.DataPoint{{Name: "counter", Value: model.IntValue(9007199254740994), Quality: model.QualityGood}},
+		model.WithMeta(map[string]string{"config_checksum": "abc"}), model.WithSequence(7))
+	if err := buf.Store(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := buf.Get(ctx, "old")
+	if err != nil || old == nil {
+		t.Fatalf("get legacy row: %v, %v", old, err)
+	}
+	if old.SchemaVersion != "" || old.Meta != nil || old.Sequence != 0 {
+		t.Fatalf("legacy row = version %q, meta %v, sequence %d", old.SchemaVersion, old.Meta, old.Sequence)
+	}
+	if len(old.Values) != 1 || old.Values[0].Value != model.IntValue(9007199254740993) {
+		t.Fatalf("legacy values = %+v", old.Values)
+	}
+
+	current, err := buf.Get(ctx, stored.ID)
+	if err != nil || current == nil {
+		t.Fatalf("get current row: %v, %v", current, err)
+	}
+	if current.SchemaVersion != model.SchemaVersion || current.Meta["config_checksum"] != "abc" || current.Sequence != 7 {
+		t.Fatalf("current row = version %q, meta %v, sequence %d", current.SchemaVersion, current.Meta, current.Sequence)
+	}
+}
+
+func TestProbeLeavesNothingPending(t *testing.T) {
+	buf := newTestBuffer(t)
+	ctx := context.Background()
+
+	probe := model.NewEnvelope("st1", "", "meter1", "", "",
+		[]model.DataPoint{{Name: "p", Value: model.FloatValue(1), Quality: model.QualityGood}}, model.WithTest())
+	if err := buf.Probe(ctx, probe); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := buf.Count(ctx); err != nil || n != 0 {
+		t.Fatalf("Count after probe = %d, %v, want 0", n, err)
+	}
+	if got, err := buf.Get(ctx, probe.ID); err != nil || got != nil {
+		t.Fatalf("Get after probe = %v, %v, want nothing", got, err)
+	}
+}
+
+func TestStoreSameHashIDTwice(t *testing.T) {
+	buf := newTestBuffer(t)
+	ctx := context.Background()
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	reading := func() *model.Envelope {
+		return model.NewEnvelope("st1", "", "meter1", "", "",
+			[]model.DataPoint{{Name: "p", Value: model.FloatValue(1), Quality: model.QualityGood}},
+			model.WithTimestamp(ts), model.WithIDStrategy(model.IDHash))
+	}
+	first, second := reading(), reading()
+	if first.ID != second.ID {
+		t.Fatalf("hash IDs differ: %s, %s", first.ID, second.ID)
+	}
+
+	for _, envelope := range []*model.Envelope{first, second} {
+		if err := buf.Store(ctx, envelope); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := buf.Count(ctx); err != nil || n != 1 {
+		t.Fatalf("Count = %d, %v, want 1", n, err)
+	}
+}
+
+func TestExportSkipsUnreadableRows(t *testing.T) {
+	buf := newTestBuffer(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"good", "bad"} {
+		envelope := model.NewEnvelope("st1", "", "meter1", "", "",
+			[]model.DataPoint{{Name: "p", Value: model.FloatValue(1), Quality: model.QualityGood}})
+		envelope.ID = id
+		if err := buf.Store(ctx, envelope); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buf.db.Exec(`UPDATE buffer SET values_json = 'not json' WHERE id = 'bad'`); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	exported, skipped, err := buf.Export(ctx, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported != 1 || skipped != 1 {
+		t.Fatalf("Export = %d exported, %d skipped, want 1 and 1", exported, skipped)
+	}
+	if !strings.Contains(out.String(), `"id":"good"`) {
+		t.Fatalf("export lost the readable row:\n%s", out.String())
+	}
+}
+
+func TestLegacyRowsGetUnixTimestamp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.db")
+	createLegacyBuffer(t, path)
+	buf := openTestBuffer(t, path)
+
+	var unixNano int64
+	if err := buf.db.QueryRow("SELECT timestamp_unix_nano FROM buffer WHERE id = 'old'").Scan(&unixNano); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2024, 3, 1, 12, 0, 0, 5e8, time.UTC).UnixNano()
+	if unixNano != want {
+		t.Fatalf("timestamp_unix_nano = %d, want %d", unixNano, want)
+	}
+}
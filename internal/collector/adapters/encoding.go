@@ -0,0 +1,72 @@
+package adapters
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxBodySize caps a response body, before and after decompression.
+const maxBodySize = 32 << 20
+
+var errBodyTooLarge = errors.New("response body too large")
+
+// readBody reads the response body, decompressing it according to
+// Content-Encoding. The transport only decodes gzip it asked for itself, so
+// servers that compress unprompted or use deflate are handled here. A gzip
+// body without the header is detected by its magic bytes. Bodies over limit
+// bytes, compressed or not, are rejected.
+func readBody(resp *http.Response, limit int64) ([]byte, error) {
+	body, err := readLimited(resp.Body, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "" && bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		encoding = "gzip"
+	}
+
+	var reader io.ReadCloser
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		// Servers disagree on whether deflate means zlib-wrapped or raw.
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			reader, err = flate.NewReader(bytes.NewReader(body)), nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s response: %w", encoding, err)
+	}
+	defer reader.Close()
+
+	decoded, err := readLimited(reader, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s response: %w", encoding, err)
+	}
+	return decoded, nil
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: over %d bytes", errBodyTooLarge, limit)
+	}
+	return data, nil
+}
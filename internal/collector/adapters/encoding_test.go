@@ -0,0 +1,105 @@
+package adapters
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zlibbed(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadBody(t *testing.T) {
+	const payload = `{"p":1.5}`
+	compressed := gzipped(t, payload)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		limit    int64
+		want     string
+		wantErr  error
+	}{
+		{name: "plain", body: []byte(payload), limit: 1024, want: payload},
+		{name: "gzip", encoding: "gzip", body: compressed, limit: 1024, want: payload},
+		{name: "gzip without header", body: compressed, limit: 1024, want: payload},
+		{name: "deflate", encoding: "deflate", body: zlibbed(t, payload), limit: 1024, want: payload},
+		{name: "corrupt gzip", encoding: "gzip", body: []byte("not gzip at all"), limit: 1024},
+		{name: "truncated gzip", encoding: "gzip", body: compressed[:len(compressed)-6], limit: 1024},
+		{name: "unsupported", encoding: "br", body: []byte(payload), limit: 1024},
+		{name: "over limit", body: []byte(payload), limit: 4, wantErr: errBodyTooLarge},
+		{
+			name:     "over limit decompressed",
+			encoding: "gzip",
+			body:     gzipped(t, strings.Repeat("0", 4096)),
+			limit:    1024,
+			wantErr:  errBodyTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer srv.Close()
+
+			// Keep the transport from decoding gzip itself.
+			client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			got, err := readBody(resp, tt.limit)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("readBody = %q, want error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("readBody error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readBody: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("readBody = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
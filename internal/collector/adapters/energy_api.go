@@ -4,32 +4,38 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
-	"strconv"
-	"strings"
+	"net/url"
 	"time"
 
 	"github.com/speedwagon-io/asutp/internal/collector"
 	"github.com/speedwagon-io/asutp/internal/config"
 	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
-	"github.com/speedwagon-io/asutp/internal/model"
+	"github.com/speedwagon-io/asutp/internal/lib/redirect"
 )
 
 type EnergyAPIAdapter struct {
-	log     *slog.Logger
-	baseURL string
-	client  *http.Client
+	fieldMapper
+	log         *slog.Logger
+	baseURL     string
+	lenientJSON bool
+	client      *http.Client
 }
 
-func NewEnergyAPIAdapter(log *slog.Logger, baseURL string, timeout time.Duration) *EnergyAPIAdapter {
+func NewEnergyAPIAdapter(log *slog.Logger, cfg *config.ConnectionConfig, transport *http.Transport) *EnergyAPIAdapter {
 	return &EnergyAPIAdapter{
-		log:     log,
-		baseURL: baseURL,
+		fieldMapper: fieldMapper{log: log},
+		log:         log,
+		baseURL:     cfg.BaseURL,
+		lenientJSON: cfg.LenientJSON,
 		client: &http.Client{
-			Timeout: timeout,
+			Timeout:       cfg.Timeout,
+			Transport:     transport,
+			CheckRedirect: redirect.CheckRedirect(cfg.Redirects),
 		},
 	}
 }
@@ -43,23 +49,92 @@ func (a *EnergyAPIAdapter) Close() error {
 	return nil
 }
 
-func (a *EnergyAPIAdapter) Collect(ctx context.Context, device *config.DeviceConfig) (*collector.CollectedData, error) {
-	url := fmt.Sprintf("%s/%s", a.baseURL, device.Endpoint)
+// Probe checks that the gateway answers at its base URL. Any response below
+// 500 counts as reachable.
+func (a *EnergyAPIAdapter) Probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create probe request: %w", err)
+	}
 
-	// Build request body: {"parameter": "telemex"} or {"parameter": "telemetry"}
-	requestBody := map[string]string{
-		"parameter": device.RequestParam,
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gateway unreachable: %w", err)
 	}
-	bodyBytes, err := json.Marshal(requestBody)
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("gateway unhealthy: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// requestBody encodes the request parameter as {"parameter": "telemetry"} or,
+// for form devices, as parameter=telemetry. extra adds further parameters.
+func requestBody(device *config.DeviceConfig, extra map[string]string) ([]byte, string, error) {
+	params := map[string]string{"parameter": device.RequestParam}
+	for k, v := range extra {
+		params[k] = v
+	}
+
+	if device.BodyEncoding == config.BodyForm {
+		form := url.Values{}
+		for k, v := range params {
+			form.Set(k, v)
+		}
+		return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+	}
+
+	bodyBytes, err := json.Marshal(params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		return nil, "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	return bodyBytes, "application/json", nil
+}
+
+// fetch sends the device request to endpoint and returns the response body.
+// RequestParam and extra go in the body, or in the URL for devices with
+// ParamIn path or query.
+func (a *EnergyAPIAdapter) fetch(ctx context.Context, endpoint string, device *config.DeviceConfig, extra map[string]string) ([]byte, error) {
+	target := fmt.Sprintf("%s/%s", a.baseURL, endpoint)
+
+	method := device.Method
+	if method == "" {
+		method = http.MethodPost
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyBytes))
+	var (
+		body        io.Reader
+		contentType string
+	)
+	query := url.Values{}
+	for k, v := range extra {
+		query.Set(k, v)
+	}
+	switch device.ParamIn {
+	case config.ParamPath:
+		target += "/" + url.PathEscape(device.RequestParam)
+	case config.ParamQuery:
+		query.Set("parameter", device.RequestParam)
+	default:
+		bodyBytes, ct, err := requestBody(device, extra)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = bytes.NewReader(bodyBytes), ct
+		query = nil
+	}
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
 
 	resp, err := a.client.Do(req)
 	if err != nil {
@@ -71,36 +146,36 @@ func (a *EnergyAPIAdapter) Collect(ctx context.Context, device *config.DeviceCon
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	return readBody(resp, maxBodySize)
+}
+
+func (a *EnergyAPIAdapter) Collect(ctx context.Context, device *config.DeviceConfig) (*collector.CollectedData, error) {
+	body, err := a.fetch(ctx, device.Endpoint, device, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
+	}
+
+	var raw json.RawMessage
+	if device.RawPassthrough {
+		raw = rawPayload(body)
 	}
 
-	// Some endpoints return plain "True"/"False" instead of JSON
-	// when there's no data or everything is OK
-	bodyStr := string(bytes.TrimSpace(body))
-	if bodyStr == "True" || bodyStr == "False" || bodyStr == "true" || bodyStr == "false" {
-		a.log.Debug("endpoint returned boolean, no data to collect",
+	rawData, err := decodePayload(body, a.lenientJSON)
+	if errors.Is(err, errBooleanPayload) {
+		a.log.Debug("endpoint returned boolean",
 			slog.String("endpoint", device.Endpoint),
-			slog.String("response", bodyStr),
+			slog.String("response", string(bytes.TrimSpace(body))),
 		)
 		return &collector.CollectedData{
 			DeviceID:    device.ID,
 			DeviceName:  device.Name,
 			DeviceGroup: device.Group,
-			DataPoints:  []model.DataPoint{},
+			DataPoints:  a.booleanStatus(body, device.BooleanTarget),
+			Raw:         raw,
 		}, nil
 	}
-
-	// Fix Python-style booleans (True/False -> true/false)
-	bodyStr = strings.ReplaceAll(bodyStr, ":True,", ":true,")
-	bodyStr = strings.ReplaceAll(bodyStr, ":True}", ":true}")
-	bodyStr = strings.ReplaceAll(bodyStr, ":False,", ":false,")
-	bodyStr = strings.ReplaceAll(bodyStr, ":False}", ":false}")
-
-	var rawData map[string]any
-	if err := json.Unmarshal([]byte(bodyStr), &rawData); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	if err != nil {
+		return nil, err
 	}
 
 	dataPoints := a.transformData(rawData, device.Fields)
@@ -110,122 +185,78 @@ func (a *EnergyAPIAdapter) Collect(ctx context.Context, device *config.DeviceCon
 		DeviceName:  device.Name,
 		DeviceGroup: device.Group,
 		DataPoints:  dataPoints,
+		Metadata:    a.extractMetadata(rawData, device.MetadataFields),
+		Raw:         raw,
 	}, nil
 }
 
-func (a *EnergyAPIAdapter) transformData(rawData map[string]any, fields []config.FieldConfig) []model.DataPoint {
-	dataPoints := make([]model.DataPoint, 0, len(fields))
-
-	for _, field := range fields {
-		rawValue, exists := rawData[field.Source]
-		if !exists {
-			a.log.Debug("field not found in response",
-				slog.String("source", field.Source),
-			)
-			dataPoints = append(dataPoints, model.DataPoint{
-				Name:    field.Target,
-				Value:   nil,
-				Unit:    field.Unit,
-				Quality: model.QualityBad,
-			})
-			continue
-		}
-
-		value, quality := a.convertValue(rawValue, field.Type)
-
-		dp := model.DataPoint{
-			Name:    field.Target,
-			Value:   value,
-			Unit:    field.Unit,
-			Quality: quality,
-		}
-
-		if field.Severity != "" {
-			dp.Severity = field.Severity
-		}
-
-		dataPoints = append(dataPoints, dp)
+// CollectRange reads past values from the device's HistoryEndpoint, sending
+// from and to as RFC 3339 parameters alongside the request parameter. The
+// endpoint answers with an array of records, each timed by HistoryTimeField
+// as RFC 3339 text or Unix seconds.
+func (a *EnergyAPIAdapter) CollectRange(ctx context.Context, device *config.DeviceConfig, from, to time.Time) ([]*collector.CollectedData, error) {
+	if device.HistoryEndpoint == "" {
+		return nil, collector.ErrRangeUnsupported
 	}
 
-	return dataPoints
-}
-
-func (a *EnergyAPIAdapter) convertValue(rawValue any, fieldType string) (any, string) {
-	if rawValue == nil {
-		return nil, model.QualityBad
+	body, err := a.fetch(ctx, device.HistoryEndpoint, device, map[string]string{
+		"from": from.UTC().Format(time.RFC3339),
+		"to":   to.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	switch fieldType {
-	case "float":
-		return a.toFloat(rawValue)
-	case "int":
-		return a.toInt(rawValue)
-	case "bool":
-		return a.toBool(rawValue)
-	case "string":
-		return fmt.Sprintf("%v", rawValue), model.QualityGood
-	default:
-		return rawValue, model.QualityGood
+	records, err := decodeHistory(body, a.lenientJSON)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (a *EnergyAPIAdapter) toFloat(v any) (any, string) {
-	switch val := v.(type) {
-	case float64:
-		return val, model.QualityGood
-	case float32:
-		return float64(val), model.QualityGood
-	case int:
-		return float64(val), model.QualityGood
-	case int64:
-		return float64(val), model.QualityGood
-	case string:
-		f, err := strconv.ParseFloat(val, 64)
-		if err != nil {
-			a.log.Debug("failed to parse float", slog.String("value", val), sl.Err(err))
-			return nil, model.QualityBad
-		}
-		return f, model.QualityGood
-	default:
-		return nil, model.QualityBad
+	timeField := device.HistoryTimeField
+	if timeField == "" {
+		timeField = "timestamp"
 	}
-}
 
-func (a *EnergyAPIAdapter) toInt(v any) (any, string) {
-	switch val := v.(type) {
-	case int:
-		return val, model.QualityGood
-	case int64:
-		return int(val), model.QualityGood
-	case float64:
-		return int(val), model.QualityGood
-	case string:
-		i, err := strconv.Atoi(val)
+	readings := make([]*collector.CollectedData, 0, len(records))
+	for _, record := range records {
+		ts, err := recordTime(record[timeField])
 		if err != nil {
-			a.log.Debug("failed to parse int", slog.String("value", val), sl.Err(err))
-			return nil, model.QualityBad
+			a.log.Debug("skipping history record",
+				slog.String("device_id", device.ID),
+				sl.Err(err),
+			)
+			continue
 		}
-		return i, model.QualityGood
-	default:
-		return nil, model.QualityBad
+		readings = append(readings, &collector.CollectedData{
+			DeviceID:    device.ID,
+			DeviceName:  device.Name,
+			DeviceGroup: device.Group,
+			DataPoints:  a.transformData(record, device.Fields),
+			Metadata:    a.extractMetadata(record, device.MetadataFields),
+			Timestamp:   ts,
+		})
 	}
+
+	return readings, nil
 }
 
-func (a *EnergyAPIAdapter) toBool(v any) (any, string) {
-	switch val := v.(type) {
-	case bool:
-		return val, model.QualityGood
-	case int:
-		return val != 0, model.QualityGood
-	case float64:
-		return val != 0, model.QualityGood
+// recordTime parses a history record time given as RFC 3339 text or as Unix
+// seconds.
+func recordTime(v any) (time.Time, error) {
+	switch t := v.(type) {
 	case string:
-		b, err := strconv.ParseBool(val)
+		return time.Parse(time.RFC3339Nano, t)
+	case json.Number:
+		if sec, err := t.Int64(); err == nil {
+			return time.Unix(sec, 0).UTC(), nil
+		}
+		sec, err := t.Float64()
 		if err != nil {
-			return val == "1" || val == "on" || val == "true", model.QualityGood
+			return time.Time{}, err
 		}
-		return b, model.QualityGood
-	default:
-		return nil, model.QualityBad
+		return time.Unix(0, int64(sec*float64(time.Second))).UTC(), nil
+	case nil:
+		return time.Time{}, errors.New("record has no time")
 	}
+	return time.Time{}, fmt.Errorf("unsupported record time %T", v)
 }
@@ -0,0 +1,73 @@
+package adapters
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/speedwagon-io/asutp/internal/config"
+)
+
+// programCache holds compiled expressions of fields not loaded through
+// config.LoadStation, which compiles them at load, keyed by source text.
+var programCache sync.Map
+
+func compiledExpression(field config.FieldConfig) (*vm.Program, error) {
+	if program := field.Program(); program != nil {
+		return program, nil
+	}
+	source := field.Expression
+	if program, ok := programCache.Load(source); ok {
+		return program.(*vm.Program), nil
+	}
+	program, err := config.CompileExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	programCache.Store(source, program)
+	return program, nil
+}
+
+// evalExpression evaluates the field expression with the source field as value
+// and the whole response as raw, already passed through plainNumbers.
+func evalExpression(field config.FieldConfig, value any, raw map[string]any) (any, error) {
+	program, err := compiledExpression(field)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := expr.Run(program, config.ExpressionEnv{
+		Value: plainNumber(value),
+		Raw:   raw,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate expression %q: %w", field.Expression, err)
+	}
+	return out, nil
+}
+
+// plainNumbers converts json.Number values so expressions can do arithmetic
+// on them. It copies the map, so it is built once per reading.
+func plainNumbers(raw map[string]any) map[string]any {
+	out := make(map[string]any, len(raw))
+	for k, v := range raw {
+		out[k] = plainNumber(v)
+	}
+	return out
+}
+
+func plainNumber(v any) any {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return int(i)
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
@@ -0,0 +1,188 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/speedwagon-io/asutp/internal/collector"
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+const (
+	FileKeep    = "keep"
+	FileDelete  = "delete"
+	FileArchive = "archive"
+)
+
+// FileAdapter reads device data from JSON files dropped into a spool
+// directory, or from a named pipe. The device endpoint is a glob pattern
+// relative to the spool directory; the newest matching file is used.
+type FileAdapter struct {
+	fieldMapper
+	log         *slog.Logger
+	dir         string
+	afterRead   string
+	archiveDir  string
+	lenientJSON bool
+}
+
+func NewFileAdapter(log *slog.Logger, cfg *config.ConnectionConfig) (*FileAdapter, error) {
+	switch cfg.File.AfterRead {
+	case FileKeep, FileDelete:
+	case FileArchive:
+		if cfg.File.ArchiveDir == "" {
+			return nil, errors.New("file adapter archive_dir is required for archive mode")
+		}
+		if err := os.MkdirAll(cfg.File.ArchiveDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown file adapter after_read mode: %s", cfg.File.AfterRead)
+	}
+
+	return &FileAdapter{
+		fieldMapper: fieldMapper{log: log},
+		log:         log,
+		dir:         cfg.File.Dir,
+		afterRead:   cfg.File.AfterRead,
+		archiveDir:  cfg.File.ArchiveDir,
+		lenientJSON: cfg.LenientJSON,
+	}, nil
+}
+
+func (a *FileAdapter) Name() string {
+	return "file"
+}
+
+func (a *FileAdapter) Close() error {
+	return nil
+}
+
+// Probe checks that the drop directory is accessible.
+func (a *FileAdapter) Probe(ctx context.Context) error {
+	info, err := os.Stat(a.dir)
+	if err != nil {
+		return fmt.Errorf("failed to stat drop directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("drop path is not a directory: %s", a.dir)
+	}
+	return nil
+}
+
+func (a *FileAdapter) Collect(ctx context.Context, device *config.DeviceConfig) (*collector.CollectedData, error) {
+	pattern := filepath.Join(a.dir, device.Endpoint)
+
+	var (
+		body     []byte
+		consumed []string
+		err      error
+	)
+
+	if info, statErr := os.Stat(pattern); statErr == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		body, err = a.readPipe(ctx, pattern)
+	} else {
+		body, consumed, err = a.readLatest(pattern)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := &collector.CollectedData{
+		DeviceID:    device.ID,
+		DeviceName:  device.Name,
+		DeviceGroup: device.Group,
+		DataPoints:  []model.DataPoint{},
+	}
+
+	if body == nil {
+		a.log.Debug("no file to collect", slog.String("pattern", pattern))
+		return data, nil
+	}
+
+	if device.RawPassthrough {
+		data.Raw = rawPayload(body)
+	}
+
+	rawData, err := decodePayload(body, a.lenientJSON)
+	if errors.Is(err, errBooleanPayload) {
+		data.DataPoints = a.booleanStatus(body, device.BooleanTarget)
+	} else if err != nil {
+		// Disposed like a good file, or it would stay the newest match and
+		// fail every collect until a newer one arrives.
+		a.dispose(consumed)
+		return nil, err
+	}
+	if rawData != nil {
+		data.DataPoints = a.transformData(rawData, device.Fields)
+		data.Metadata = a.extractMetadata(rawData, device.MetadataFields)
+	}
+
+	a.dispose(consumed)
+
+	return data, nil
+}
+
+// readLatest returns the contents of the newest file matching pattern and
+// all matched files, which are superseded by it. It returns nil contents
+// when nothing matches.
+func (a *FileAdapter) readLatest(pattern string) ([]byte, []string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid file pattern: %w", err)
+	}
+
+	var (
+		latest     string
+		latestInfo os.FileInfo
+		files      []string
+	)
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, path)
+		if latestInfo == nil || info.ModTime().After(latestInfo.ModTime()) {
+			latest, latestInfo = path, info
+		}
+	}
+
+	if latest == "" {
+		return nil, nil, nil
+	}
+
+	body, err := os.ReadFile(latest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return body, files, nil
+}
+
+func (a *FileAdapter) dispose(files []string) {
+	for _, path := range files {
+		var err error
+		switch a.afterRead {
+		case FileDelete:
+			err = os.Remove(path)
+		case FileArchive:
+			err = os.Rename(path, filepath.Join(a.archiveDir, filepath.Base(path)))
+		default:
+			return
+		}
+		if err != nil {
+			a.log.Error("failed to dispose consumed file",
+				slog.String("path", path),
+				slog.String("mode", a.afterRead),
+				sl.Err(err),
+			)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package adapters
+
+import (
+	"context"
+	"errors"
+)
+
+// readPipe is unsupported where named pipes cannot be polled.
+func (a *FileAdapter) readPipe(ctx context.Context, path string) ([]byte, error) {
+	return nil, errors.New("named pipes are not supported on this platform")
+}
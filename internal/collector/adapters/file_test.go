@@ -0,0 +1,40 @@
+package adapters
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+)
+
+func newTestFileAdapter(t *testing.T, afterRead string) (*FileAdapter, string) {
+	t.Helper()
+	dir := t.TempDir()
+	a, err := NewFileAdapter(slog.New(slog.NewTextHandler(io.Discard, nil)), &config.ConnectionConfig{
+		File: config.FileConfig{Dir: dir, AfterRead: afterRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, dir
+}
+
+func TestCollectDisposesUndecodableFile(t *testing.T) {
+	a, dir := newTestFileAdapter(t, FileDelete)
+	path := filepath.Join(dir, "meter1.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	device := &config.DeviceConfig{ID: "meter1", Endpoint: "meter1*.json"}
+	if _, err := a.Collect(context.Background(), device); err == nil {
+		t.Fatal("Collect succeeded on an undecodable file")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("undecodable file was not disposed: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build unix
+
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// pipePollInterval bounds how long a pipe read waits before checking ctx.
+const pipePollInterval = 100 // ms
+
+// readPipe reads one document from a named pipe: everything a writer sends
+// until it closes its end. The pipe is opened without blocking and polled, so
+// waiting for a writer ends with ctx instead of holding a goroutine.
+func (a *FileAdapter) readPipe(ctx context.Context, path string) ([]byte, error) {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pipe: %w", err)
+	}
+	defer unix.Close(fd)
+
+	var body []byte
+	chunk := make([]byte, 32<<10)
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read pipe: %w", err)
+		}
+
+		// Until a writer connects, the pipe reports no events, so it is
+		// only read once it has data or the writer has hung up.
+		n, err := unix.Poll(fds, pipePollInterval)
+		if errors.Is(err, unix.EINTR) || n == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll pipe: %w", err)
+		}
+
+		for {
+			n, err := unix.Read(fd, chunk)
+			if n > 0 {
+				body = append(body, chunk[:n]...)
+				if len(body) > maxBodySize {
+					return nil, fmt.Errorf("%w: over %d bytes", errBodyTooLarge, maxBodySize)
+				}
+				continue
+			}
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read pipe: %w", err)
+			}
+			return bytes.TrimSpace(body), nil
+		}
+	}
+}
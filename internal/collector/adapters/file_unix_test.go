@@ -0,0 +1,68 @@
+//go:build unix
+
+package adapters
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func newTestPipe(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "meter1.pipe")
+	if err := unix.Mkfifo(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadPipe(t *testing.T) {
+	a, _ := newTestFileAdapter(t, FileKeep)
+	path := newTestPipe(t)
+
+	go func() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		f.WriteString(" {\"p\": 1}\n")
+		f.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	body, err := a.readPipe(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"p": 1}` {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestReadPipeWithoutWriterEndsWithContext(t *testing.T) {
+	a, _ := newTestFileAdapter(t, FileKeep)
+	path := newTestPipe(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.readPipe(ctx, path)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("read without a writer succeeded")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("read did not end with its context")
+	}
+}
@@ -0,0 +1,129 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errBooleanPayload is returned by decodePayload when the source answered
+// with a bare boolean instead of an object, meaning there is no data.
+var errBooleanPayload = errors.New("boolean payload")
+
+// rawPayload returns the response for raw passthrough: embedded as-is when it
+// is valid JSON, as a JSON string otherwise.
+func rawPayload(body []byte) json.RawMessage {
+	trimmed := bytes.TrimSpace(body)
+	if json.Valid(trimmed) {
+		return json.RawMessage(trimmed)
+	}
+	quoted, _ := json.Marshal(string(trimmed))
+	return quoted
+}
+
+// decodePayload parses a source response into a flat map of fields.
+func decodePayload(body []byte, lenient bool) (map[string]any, error) {
+	var rawData map[string]any
+	if err := decodeInto(body, lenient, &rawData); err != nil {
+		return nil, err
+	}
+	return rawData, nil
+}
+
+// decodeHistory parses a history response: an array of flat records.
+func decodeHistory(body []byte, lenient bool) ([]map[string]any, error) {
+	var records []map[string]any
+	if err := decodeInto(body, lenient, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func decodeInto(body []byte, lenient bool, v any) error {
+	// Some endpoints return plain "True"/"False" instead of JSON
+	// when there's no data or everything is OK
+	bodyStr := string(bytes.TrimSpace(body))
+	if bodyStr == "True" || bodyStr == "False" || bodyStr == "true" || bodyStr == "false" {
+		return errBooleanPayload
+	}
+
+	// Fix Python-style booleans (True/False -> true/false)
+	bodyStr = strings.ReplaceAll(bodyStr, ":True,", ":true,")
+	bodyStr = strings.ReplaceAll(bodyStr, ":True}", ":true}")
+	bodyStr = strings.ReplaceAll(bodyStr, ":False,", ":false,")
+	bodyStr = strings.ReplaceAll(bodyStr, ":False}", ":false}")
+
+	payload := []byte(bodyStr)
+	if lenient {
+		payload = replaceNonFinite(payload)
+	}
+
+	// Numbers are kept as json.Number so decimal fields see the exact
+	// source digits instead of a float64 approximation.
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return nil
+}
+
+var nonFiniteTokens = [][]byte{
+	[]byte("-Infinity"),
+	[]byte("+Infinity"),
+	[]byte("Infinity"),
+	[]byte("NaN"),
+}
+
+// replaceNonFinite rewrites bare NaN and Infinity literals outside of strings
+// to null so that the rest of the document can still be decoded. The
+// affected fields then become bad-quality points.
+func replaceNonFinite(data []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(data))
+
+	inString := false
+	escaped := false
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		if inString {
+			out.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+			out.WriteByte(c)
+			continue
+		}
+
+		matched := false
+		for _, tok := range nonFiniteTokens {
+			if bytes.HasPrefix(data[i:], tok) {
+				out.WriteString("null")
+				i += len(tok) - 1
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			out.WriteByte(c)
+		}
+	}
+
+	return out.Bytes()
+}
@@ -0,0 +1,96 @@
+package adapters
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestReplaceNonFinite(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"nan", `{"a":NaN}`, `{"a":null}`},
+		{"infinity", `{"a":Infinity,"b":1}`, `{"a":null,"b":1}`},
+		{"signed infinity", `{"a":-Infinity,"b":+Infinity}`, `{"a":null,"b":null}`},
+		{"array", `[NaN,1,Infinity]`, `[null,1,null]`},
+		{"inside string", `{"a":"NaN","b":"-Infinity"}`, `{"a":"NaN","b":"-Infinity"}`},
+		{"escaped quote", `{"a":"x\"NaN","b":NaN}`, `{"a":"x\"NaN","b":null}`},
+		{"finite", `{"a":1.5e3,"b":-2}`, `{"a":1.5e3,"b":-2}`},
+		{"empty", ``, ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(replaceNonFinite([]byte(tt.in)))
+			if got != tt.want {
+				t.Fatalf("replaceNonFinite(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		lenient bool
+		want    map[string]any
+		wantErr bool
+		boolean bool
+	}{
+		{
+			name: "object",
+			body: `{"p":1.25,"q":7,"s":"on"}`,
+			want: map[string]any{"p": json.Number("1.25"), "q": json.Number("7"), "s": "on"},
+		},
+		{
+			name: "python booleans",
+			body: `{"a":True,"b":False}`,
+			want: map[string]any{"a": true, "b": false},
+		},
+		{
+			name:    "nan lenient",
+			body:    `{"a":NaN,"b":-Infinity,"c":2}`,
+			lenient: true,
+			want:    map[string]any{"a": nil, "b": nil, "c": json.Number("2")},
+		},
+		{name: "nan strict", body: `{"a":NaN}`, wantErr: true},
+		{name: "truncated", body: `{"a":1,"b":`, wantErr: true},
+		{name: "truncated lenient", body: `{"a":Infin`, lenient: true, wantErr: true},
+		{name: "array", body: `[1,2]`, wantErr: true},
+		{name: "number", body: `42`, wantErr: true},
+		{name: "string", body: `"ok"`, wantErr: true},
+		{name: "empty", body: ``, wantErr: true},
+		{name: "bare true", body: " True\n", wantErr: true, boolean: true},
+		{name: "bare false", body: `false`, wantErr: true, boolean: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePayload([]byte(tt.body), tt.lenient)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodePayload(%s) = %v, want error", tt.body, got)
+				}
+				if errors.Is(err, errBooleanPayload) != tt.boolean {
+					t.Fatalf("decodePayload(%s) error = %v, boolean payload = %v", tt.body, err, tt.boolean)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodePayload(%s): %v", tt.body, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("decodePayload(%s) = %v, want %v", tt.body, got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Fatalf("decodePayload(%s)[%s] = %#v, want %#v", tt.body, k, got[k], v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package adapters
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+	"github.com/speedwagon-io/asutp/internal/collector"
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// fieldMapper converts raw source values into data points according to the
+// device field configuration. It is shared by all adapters.
+type fieldMapper struct {
+	log *slog.Logger
+}
+
+// extractMetadata picks the configured metadata fields from the response.
+// Missing fields are left out.
+func (m *fieldMapper) extractMetadata(rawData map[string]any, fields map[string]string) map[string]string {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	metadata := make(map[string]string, len(fields))
+	for key, source := range fields {
+		value, ok := rawData[source]
+		if !ok || value == nil {
+			continue
+		}
+		metadata[key] = fmt.Sprintf("%v", value)
+	}
+
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// fieldUnit returns the configured unit or, when it is empty, the unit the
+// response reports in the field's UnitSource.
+func (m *fieldMapper) fieldUnit(rawData map[string]any, field config.FieldConfig) string {
+	if field.Unit != "" || field.UnitSource == "" {
+		return field.Unit
+	}
+
+	raw, ok := rawData[field.UnitSource]
+	if !ok {
+		return ""
+	}
+	unit := model.Intern(strings.TrimSpace(fmt.Sprintf("%v", raw)))
+	if !config.UnitFits(field.Quantity, unit) {
+		m.log.Debug("response unit does not fit field quantity",
+			slog.String("target", field.Target),
+			slog.String("unit", unit),
+			slog.String("quantity", field.Quantity),
+		)
+	}
+	return unit
+}
+
+// lookupSource returns the value of the first source name present in rawData.
+func lookupSource(rawData map[string]any, names config.SourceNames) (any, bool) {
+	for _, name := range names {
+		if value, ok := rawData[name]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (m *fieldMapper) transformData(rawData map[string]any, fields []config.FieldConfig) []model.DataPoint {
+	dataPoints := collector.NewDataPoints(len(fields))
+	var plainRaw map[string]any
+
+	for _, field := range fields {
+		rawValue, exists := lookupSource(rawData, field.Source)
+		sourceValue := rawValue
+		reason := model.ReasonMissingField
+		if field.Expression != "" {
+			if plainRaw == nil {
+				plainRaw = plainNumbers(rawData)
+			}
+			result, err := evalExpression(field, rawValue, plainRaw)
+			if err != nil {
+				m.log.Debug("field expression failed",
+					slog.String("target", field.Target),
+					sl.Err(err),
+				)
+				if exists {
+					reason = model.ReasonParseError
+				}
+			}
+			rawValue, exists = result, err == nil
+		}
+		if !exists {
+			m.log.Debug("field not found in response",
+				slog.String("source", field.Source.String()),
+			)
+			dp := model.DataPoint{
+				Name:          field.Target,
+				Unit:          field.Unit,
+				Quality:       model.QualityBad,
+				QualityReason: reason,
+			}
+			m.applyDefault(&dp, field)
+			dataPoints = append(dataPoints, dp)
+			continue
+		}
+
+		value, quality := m.convertValue(rawValue, field.Type, field.Normalize)
+		switch {
+		case quality == model.QualityGood && field.Scaled():
+			if value, reason = scaleValue(value, field); reason != "" {
+				quality = model.QualityBad
+				break
+			}
+			fallthrough
+		case quality == model.QualityGood:
+			quality = m.companionQuality(rawData, field, quality)
+			reason = model.ReasonSourceInvalid
+		case rawValue == nil:
+			reason = model.ReasonSourceInvalid
+		default:
+			reason = conversionReason(rawValue)
+		}
+
+		dp := model.DataPoint{
+			Name:    field.Target,
+			Value:   value,
+			Unit:    m.fieldUnit(rawData, field),
+			Quality: quality,
+		}
+
+		if quality == model.QualityBad {
+			dp.QualityReason = reason
+			m.applyDefault(&dp, field)
+		}
+
+		if field.Severity != "" {
+			dp.Severity = field.Severity
+		}
+
+		if quality != model.QualityGood || field.KeepRaw {
+			dp.Raw = retainedRaw(sourceValue)
+		}
+
+		dataPoints = append(dataPoints, dp)
+	}
+
+	return dataPoints
+}
+
+// maxRawString caps string source values retained on a data point.
+const maxRawString = 256
+
+// retainedRaw prepares a source value for DataPoint.Raw: numbers are made
+// plain and long strings are cut to maxRawString bytes.
+func retainedRaw(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return plainNumber(v)
+	}
+	if len(s) <= maxRawString {
+		return s
+	}
+	cut := maxRawString
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}
+
+// scaleValue maps a converted value from the field's raw range to its
+// engineering range, applying ScaleClamp to values outside the raw range. It
+// returns the quality reason when the value cannot be scaled.
+func scaleValue(value model.Value, field config.FieldConfig) (model.Value, string) {
+	raw, ok := value.Float()
+	if !ok {
+		return model.Value{}, model.ReasonTypeMismatch
+	}
+
+	rawMin, rawMax := *field.RawMin, *field.RawMax
+	euMin, euMax := *field.EUMin, *field.EUMax
+	if raw < min(rawMin, rawMax) || raw > max(rawMin, rawMax) {
+		switch field.ScaleClamp {
+		case config.ScaleClampBad:
+			return model.Value{}, model.ReasonOutOfRange
+		case config.ScaleClampLimit:
+			raw = min(max(raw, min(rawMin, rawMax)), max(rawMin, rawMax))
+		}
+	}
+
+	eu := euMin + (raw-rawMin)*(euMax-euMin)/(rawMax-rawMin)
+	if field.Type == "int" {
+		return model.IntValue(int64(math.Round(eu))), ""
+	}
+	return model.FloatValue(eu), ""
+}
+
+// conversionReason tells why a source value failed to convert: text and
+// numbers that do not parse as the field type are parse errors, values of
+// another JSON type, such as an object for a float field, type mismatches.
+func conversionReason(rawValue any) string {
+	switch rawValue.(type) {
+	case string, json.Number:
+		return model.ReasonParseError
+	}
+	return model.ReasonTypeMismatch
+}
+
+// companionQuality derives quality from the field's companion status field.
+// It returns fallback when no companion is configured or present.
+func (m *fieldMapper) companionQuality(rawData map[string]any, field config.FieldConfig, fallback string) string {
+	if field.QualitySource == "" {
+		return fallback
+	}
+
+	status, ok := rawData[field.QualitySource]
+	if !ok || status == nil {
+		return fallback
+	}
+
+	if quality, ok := field.QualityMap[fmt.Sprintf("%v", status)]; ok {
+		return quality
+	}
+	return model.QualityUncertain
+}
+
+// booleanStatus turns a bare boolean response into a single status data
+// point named target. It returns no points when target is empty, keeping the
+// default of skipping such responses.
+func (m *fieldMapper) booleanStatus(body []byte, target string) []model.DataPoint {
+	if target == "" {
+		return []model.DataPoint{}
+	}
+	value, err := strconv.ParseBool(strings.TrimSpace(string(body)))
+	if err != nil {
+		return []model.DataPoint{}
+	}
+	return []model.DataPoint{{
+		Name:    target,
+		Value:   model.BoolValue(value),
+		Quality: model.QualityGood,
+	}}
+}
+
+// applyDefault substitutes the field's configured default, converted to its
+// type at load, into a bad-quality data point. Quality stays bad and the
+// point is flagged as substituted.
+func (m *fieldMapper) applyDefault(dp *model.DataPoint, field config.FieldConfig) {
+	value, ok := field.DefaultValue()
+	if !ok {
+		return
+	}
+	dp.Value = value
+	dp.Substituted = true
+}
+
+func (m *fieldMapper) convertValue(rawValue any, fieldType string, normalize []string) (model.Value, string) {
+	if rawValue == nil {
+		return model.Value{}, model.QualityBad
+	}
+
+	switch fieldType {
+	case "float":
+		return m.toFloat(rawValue)
+	case "int":
+		return m.toInt(rawValue)
+	case "bool":
+		return m.toBool(rawValue)
+	case "decimal":
+		return m.toDecimal(rawValue)
+	case "string":
+		return model.StringValue(config.NormalizeString(fmt.Sprintf("%v", rawValue), normalize)), model.QualityGood
+	default:
+		return model.ValueOf(rawValue), model.QualityGood
+	}
+}
+
+func (m *fieldMapper) toFloat(v any) (model.Value, string) {
+	switch val := v.(type) {
+	case json.Number:
+		f, err := val.Float64()
+		if err != nil {
+			m.log.Debug("failed to parse float", slog.String("value", val.String()), sl.Err(err))
+			return model.Value{}, model.QualityBad
+		}
+		return model.FloatValue(f), model.QualityGood
+	case float64:
+		return model.FloatValue(val), model.QualityGood
+	case float32:
+		return model.FloatValue(float64(val)), model.QualityGood
+	case int:
+		return model.FloatValue(float64(val)), model.QualityGood
+	case int64:
+		return model.FloatValue(float64(val)), model.QualityGood
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			m.log.Debug("failed to parse float", slog.String("value", val), sl.Err(err))
+			return model.Value{}, model.QualityBad
+		}
+		return model.FloatValue(f), model.QualityGood
+	default:
+		return model.Value{}, model.QualityBad
+	}
+}
+
+func (m *fieldMapper) toInt(v any) (model.Value, string) {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return model.IntValue(i), model.QualityGood
+		}
+		f, err := val.Float64()
+		if err != nil {
+			m.log.Debug("failed to parse int", slog.String("value", val.String()), sl.Err(err))
+			return model.Value{}, model.QualityBad
+		}
+		return model.IntValue(int64(f)), model.QualityGood
+	case int:
+		return model.IntValue(int64(val)), model.QualityGood
+	case int64:
+		return model.IntValue(val), model.QualityGood
+	case float64:
+		return model.IntValue(int64(val)), model.QualityGood
+	case string:
+		i, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			m.log.Debug("failed to parse int", slog.String("value", val), sl.Err(err))
+			return model.Value{}, model.QualityBad
+		}
+		return model.IntValue(i), model.QualityGood
+	default:
+		return model.Value{}, model.QualityBad
+	}
+}
+
+func (m *fieldMapper) toBool(v any) (model.Value, string) {
+	switch val := v.(type) {
+	case bool:
+		return model.BoolValue(val), model.QualityGood
+	case json.Number:
+		f, err := val.Float64()
+		if err != nil {
+			return model.Value{}, model.QualityBad
+		}
+		return model.BoolValue(f != 0), model.QualityGood
+	case int:
+		return model.BoolValue(val != 0), model.QualityGood
+	case int64:
+		return model.BoolValue(val != 0), model.QualityGood
+	case float64:
+		return model.BoolValue(val != 0), model.QualityGood
+	case string:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return model.BoolValue(val == "1" || val == "on" || val == "true"), model.QualityGood
+		}
+		return model.BoolValue(b), model.QualityGood
+	default:
+		return model.Value{}, model.QualityBad
+	}
+}
+
+// toDecimal converts to a fixed-point decimal, which serializes as a JSON
+// string holding the exact digits.
+func (m *fieldMapper) toDecimal(v any) (model.Value, string) {
+	var (
+		d   decimal.Decimal
+		err error
+	)
+	switch val := v.(type) {
+	case json.Number:
+		d, err = decimal.NewFromString(val.String())
+	case string:
+		d, err = decimal.NewFromString(strings.TrimSpace(val))
+	case float64:
+		d = decimal.NewFromFloat(val)
+	case int:
+		d = decimal.NewFromInt(int64(val))
+	case int64:
+		d = decimal.NewFromInt(val)
+	default:
+		return model.Value{}, model.QualityBad
+	}
+	if err != nil {
+		m.log.Debug("failed to parse decimal", slog.Any("value", v), sl.Err(err))
+		return model.Value{}, model.QualityBad
+	}
+	return model.DecimalValue(d.String()), model.QualityGood
+}
@@ -0,0 +1,110 @@
+package adapters
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+func scaled(field config.FieldConfig, clamp string) config.FieldConfig {
+	field.RawMin, field.RawMax = ptr(0), ptr(100)
+	field.EUMin, field.EUMax = ptr(0), ptr(10)
+	field.ScaleClamp = clamp
+	return field
+}
+
+func TestTransformDataReasons(t *testing.T) {
+	float := config.FieldConfig{Source: config.SourceNames{"p"}, Target: "p", Type: "float"}
+
+	tests := []struct {
+		name    string
+		raw     map[string]any
+		field   config.FieldConfig
+		quality string
+		reason  string
+	}{
+		{"good", map[string]any{"p": json.Number("1.5")}, float, model.QualityGood, ""},
+		{"missing", map[string]any{}, float, model.QualityBad, model.ReasonMissingField},
+		{"null", map[string]any{"p": nil}, float, model.QualityBad, model.ReasonSourceInvalid},
+		{"unparsable text", map[string]any{"p": "n/a"}, float, model.QualityBad, model.ReasonParseError},
+		{"object", map[string]any{"p": map[string]any{"v": 1}}, float, model.QualityBad, model.ReasonTypeMismatch},
+		{"bool for float", map[string]any{"p": true}, float, model.QualityBad, model.ReasonTypeMismatch},
+		{
+			"expression error",
+			map[string]any{"p": "x"},
+			config.FieldConfig{Source: config.SourceNames{"p"}, Target: "p", Type: "float", Expression: "value * 2"},
+			model.QualityBad, model.ReasonParseError,
+		},
+		{
+			"expression on missing field",
+			map[string]any{},
+			config.FieldConfig{Source: config.SourceNames{"p"}, Target: "p", Type: "float", Expression: "value * 2"},
+			model.QualityBad, model.ReasonMissingField,
+		},
+		{"scaled", map[string]any{"p": json.Number("50")}, scaled(float, config.ScaleClampBad), model.QualityGood, ""},
+		{"scaled out of range", map[string]any{"p": json.Number("150")}, scaled(float, config.ScaleClampBad), model.QualityBad, model.ReasonOutOfRange},
+		{"scaled clamped", map[string]any{"p": json.Number("150")}, scaled(float, config.ScaleClampLimit), model.QualityGood, ""},
+		{
+			"scaled non-numeric",
+			map[string]any{"p": "on"},
+			scaled(config.FieldConfig{Source: config.SourceNames{"p"}, Target: "p", Type: "string"}, config.ScaleClampBad),
+			model.QualityBad, model.ReasonTypeMismatch,
+		},
+		{
+			"companion bad",
+			map[string]any{"p": json.Number("1"), "p_status": "fault"},
+			config.FieldConfig{
+				Source: config.SourceNames{"p"}, Target: "p", Type: "float",
+				QualitySource: "p_status", QualityMap: map[string]string{"fault": model.QualityBad},
+			},
+			model.QualityBad, model.ReasonSourceInvalid,
+		},
+	}
+
+	m := &fieldMapper{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := m.transformData(tt.raw, []config.FieldConfig{tt.field})
+			if len(points) != 1 {
+				t.Fatalf("got %d points, want 1", len(points))
+			}
+			dp := points[0]
+			if dp.Quality != tt.quality || dp.QualityReason != tt.reason {
+				t.Fatalf("quality = %q (%q), want %q (%q)", dp.Quality, dp.QualityReason, tt.quality, tt.reason)
+			}
+		})
+	}
+}
+
+func TestToBool(t *testing.T) {
+	tests := []struct {
+		in   any
+		want bool
+	}{
+		{true, true},
+		{json.Number("0"), false},
+		{1, true},
+		{int64(0), false},
+		{int64(1), true},
+		{0.0, false},
+		{"on", true},
+		{"false", false},
+	}
+
+	m := &fieldMapper{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	for _, tt := range tests {
+		v, quality := m.toBool(tt.in)
+		if quality != model.QualityGood {
+			t.Fatalf("toBool(%#v) quality = %q, want good", tt.in, quality)
+		}
+		if v != model.BoolValue(tt.want) {
+			t.Fatalf("toBool(%#v) = %v, want %v", tt.in, v, tt.want)
+		}
+	}
+}
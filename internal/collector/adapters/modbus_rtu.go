@@ -0,0 +1,169 @@
+package adapters
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/goburrow/modbus"
+	"github.com/speedwagon-io/asutp/internal/collector"
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+)
+
+// ModbusRTUAdapter reads registers from Modbus RTU slaves on a shared RS-485
+// serial bus. The bus is half-duplex, so requests are serialized; a collect
+// waiting for the bus gives up when its context ends. Register values are
+// decoded and then mapped like response fields, keyed by the field's source
+// name or, without one, its target.
+type ModbusRTUAdapter struct {
+	fieldMapper
+	log     *slog.Logger
+	bus     chan struct{}
+	handler *modbus.RTUClientHandler
+	client  modbus.Client
+}
+
+func NewModbusRTUAdapter(log *slog.Logger, cfg *config.ConnectionConfig) (*ModbusRTUAdapter, error) {
+	if cfg.Serial.Device == "" {
+		return nil, errors.New("modbus_rtu adapter serial device is required")
+	}
+
+	handler := modbus.NewRTUClientHandler(cfg.Serial.Device)
+	handler.BaudRate = cfg.Serial.BaudRate
+	handler.DataBits = cfg.Serial.DataBits
+	handler.Parity = cfg.Serial.Parity
+	handler.StopBits = cfg.Serial.StopBits
+	if cfg.Timeout > 0 {
+		handler.Timeout = cfg.Timeout
+	}
+
+	return &ModbusRTUAdapter{
+		fieldMapper: fieldMapper{log: log},
+		log:         log,
+		bus:         make(chan struct{}, 1),
+		handler:     handler,
+		client:      modbus.NewClient(handler),
+	}, nil
+}
+
+func (a *ModbusRTUAdapter) Name() string {
+	return "modbus_rtu"
+}
+
+func (a *ModbusRTUAdapter) Close() error {
+	a.bus <- struct{}{}
+	defer func() { <-a.bus }()
+	return a.handler.Close()
+}
+
+func (a *ModbusRTUAdapter) Collect(ctx context.Context, device *config.DeviceConfig) (*collector.CollectedData, error) {
+	select {
+	case a.bus <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-a.bus }()
+
+	a.handler.SlaveId = device.SlaveID
+
+	rawData := make(map[string]any, len(device.Fields))
+	fields := make([]config.FieldConfig, 0, len(device.Fields))
+	var (
+		reads    int
+		firstErr error
+		busDown  bool
+	)
+	for _, field := range device.Fields {
+		if field.Register == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		key := field.Target
+		if len(field.Source) > 0 {
+			key = field.Source[0]
+		}
+		field.Source = config.SourceNames{key}
+		fields = append(fields, field)
+		if busDown {
+			continue
+		}
+
+		reads++
+		value, err := a.readRegister(field)
+		if err != nil {
+			a.log.Debug("failed to read register",
+				slog.String("device_id", device.ID),
+				slog.String("target", field.Target),
+				slog.Int("register", int(*field.Register)),
+				sl.Err(err),
+			)
+			if firstErr == nil {
+				firstErr = err
+			}
+			// Only an exception reply means the slave is there; after a
+			// timeout or port error the remaining reads would fail the same
+			// way, each holding the bus for the full timeout, so they are
+			// left unread.
+			var exception *modbus.ModbusError
+			busDown = !errors.As(err, &exception)
+			continue
+		}
+		rawData[key] = value
+	}
+
+	if reads > 0 && len(rawData) == 0 {
+		return nil, fmt.Errorf("failed to read registers of slave %d: %w", device.SlaveID, firstErr)
+	}
+
+	return &collector.CollectedData{
+		DeviceID:    device.ID,
+		DeviceName:  device.Name,
+		DeviceGroup: device.Group,
+		DataPoints:  a.transformData(rawData, fields),
+	}, nil
+}
+
+// readRegister reads and decodes the register of a field.
+func (a *ModbusRTUAdapter) readRegister(field config.FieldConfig) (any, error) {
+	quantity := uint16(1)
+	switch field.RegisterFormat {
+	case config.FormatUint32, config.FormatInt32, config.FormatFloat32:
+		quantity = 2
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if field.RegisterType == config.RegisterInput {
+		data, err = a.client.ReadInputRegisters(*field.Register, quantity)
+	} else {
+		data, err = a.client.ReadHoldingRegisters(*field.Register, quantity)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < int(quantity)*2 {
+		return nil, fmt.Errorf("short register response: %d bytes", len(data))
+	}
+
+	switch field.RegisterFormat {
+	case config.FormatInt16:
+		return int64(int16(binary.BigEndian.Uint16(data))), nil
+	case config.FormatUint32:
+		return int64(binary.BigEndian.Uint32(data)), nil
+	case config.FormatInt32:
+		return int64(int32(binary.BigEndian.Uint32(data))), nil
+	case config.FormatFloat32:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	default:
+		return int64(binary.BigEndian.Uint16(data)), nil
+	}
+}
@@ -0,0 +1,196 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/events"
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// ErrRangeUnsupported is returned by CollectRange when the device has no
+// historical source.
+var ErrRangeUnsupported = errors.New("range collection not supported")
+
+// RangeCollector is implemented by collectors that can read a device's
+// historical log. Each returned reading has its source Timestamp set.
+type RangeCollector interface {
+	CollectRange(ctx context.Context, device *config.DeviceConfig, from, to time.Time) ([]*CollectedData, error)
+}
+
+// WatermarkStore keeps, per device, the timestamp of the newest data that
+// was delivered or buffered.
+type WatermarkStore interface {
+	Watermark(ctx context.Context, deviceID string) (time.Time, error)
+	SetWatermark(ctx context.Context, deviceID string, t time.Time) error
+}
+
+// memoryWatermarks is used when no persistent store is available. Gaps
+// spanning a restart are then not detected.
+type memoryWatermarks struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func newMemoryWatermarks() *memoryWatermarks {
+	return &memoryWatermarks{last: make(map[string]time.Time)}
+}
+
+func (w *memoryWatermarks) Watermark(_ context.Context, deviceID string) (time.Time, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last[deviceID], nil
+}
+
+func (w *memoryWatermarks) SetWatermark(_ context.Context, deviceID string, t time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if t.After(w.last[deviceID]) {
+		w.last[deviceID] = t
+	}
+	return nil
+}
+
+// advanceWatermark records that the envelope's data was delivered or
+// buffered and starts a backfill when it follows a gap longer than
+// Backfill.MinGap.
+func (m *Manager) advanceWatermark(ctx context.Context, envelope *model.Envelope) {
+	if !m.cfg.Backfill.Enabled {
+		return
+	}
+
+	last, err := m.watermarks.Watermark(ctx, envelope.DeviceID)
+	if err != nil {
+		m.log.Error("failed to read watermark", slog.String("device_id", envelope.DeviceID), sl.Err(err))
+		return
+	}
+	if err := m.watermarks.SetWatermark(ctx, envelope.DeviceID, envelope.Timestamp); err != nil {
+		m.log.Error("failed to store watermark", slog.String("device_id", envelope.DeviceID), sl.Err(err))
+	}
+
+	if !last.IsZero() && envelope.Timestamp.Sub(last) > m.cfg.Backfill.MinGap {
+		m.startBackfill(ctx, envelope.DeviceID, last, envelope.Timestamp)
+	}
+}
+
+// startBackfill fetches the readings strictly between from and to in the
+// background. Only one backfill runs per device at a time.
+func (m *Manager) startBackfill(ctx context.Context, deviceID string, from, to time.Time) {
+	rc, ok := m.collector.(RangeCollector)
+	if !ok {
+		return
+	}
+
+	var device *config.DeviceConfig
+	for i := range m.stationCfg.Devices {
+		if m.stationCfg.Devices[i].ID == deviceID {
+			device = &m.stationCfg.Devices[i]
+			break
+		}
+	}
+	if device == nil {
+		return
+	}
+
+	if _, running := m.backfilling.LoadOrStore(deviceID, struct{}{}); running {
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer m.backfilling.Delete(deviceID)
+		m.backfill(ctx, rc, device, from, to)
+	}()
+}
+
+func (m *Manager) backfill(ctx context.Context, rc RangeCollector, device *config.DeviceConfig, from, to time.Time) {
+	m.log.Info("backfilling data gap",
+		slog.String("device_id", device.ID),
+		slog.Time("from", from),
+		slog.Time("to", to),
+	)
+
+	sent := 0
+	for start := from; start.Before(to); {
+		select {
+		case <-m.stopCh:
+			return
+		default:
+		}
+
+		end := start.Add(m.cfg.Backfill.MaxRange)
+		if end.After(to) {
+			end = to
+		}
+
+		collectCtx, cancel := context.WithTimeout(ctx, m.stationCfg.Polling.Timeout)
+		readings, err := rc.CollectRange(collectCtx, device, start, end)
+		cancel()
+		if errors.Is(err, ErrRangeUnsupported) {
+			m.log.Debug("device does not support backfill", slog.String("device_id", device.ID))
+			return
+		}
+		if err != nil {
+			m.backfillFailed(device.ID, start, to, err)
+			return
+		}
+
+		// Chunks are half-open so readings on a chunk boundary are sent once,
+		// and from itself was already delivered.
+		for _, data := range readings {
+			if !data.Timestamp.After(from) || data.Timestamp.Before(start) || !data.Timestamp.Before(end) {
+				continue
+			}
+			prefixFields(data, device)
+
+			envelope, err := m.newEnvelope(ctx, data)
+			if err != nil {
+				m.backfillFailed(device.ID, data.Timestamp, to, err)
+				return
+			}
+			envelope.SetMeta(MetaBackfill, "true")
+			if !m.checkEnvelope(envelope) {
+				continue
+			}
+
+			for _, part := range envelope.Split(m.cfg.Envelope.MaxPoints) {
+				if err := m.send(ctx, part, nil); err != nil {
+					if !m.bufferEnabled || m.buffer == nil {
+						m.backfillFailed(device.ID, data.Timestamp, to, err)
+						return
+					}
+					if bufErr := m.storeEnvelope(ctx, part); bufErr != nil {
+						m.backfillFailed(device.ID, data.Timestamp, to, bufErr)
+						return
+					}
+				}
+				sent++
+			}
+		}
+
+		start = end
+	}
+
+	m.log.Info("backfill complete",
+		slog.String("device_id", device.ID),
+		slog.Int("envelopes", sent),
+	)
+}
+
+// backfillFailed reports the part of a gap that could not be filled. It is
+// not retried: the watermark has already moved past it.
+func (m *Manager) backfillFailed(deviceID string, from, to time.Time, err error) {
+	m.log.Error("backfill failed, data gap remains",
+		slog.String("device_id", deviceID),
+		slog.Time("from", from),
+		slog.Time("to", to),
+		sl.Err(err),
+	)
+	m.events.Publish(events.LevelError, events.KindBackfill, deviceID, err.Error())
+}
@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/speedwagon-io/asutp/internal/model"
+	"github.com/speedwagon-io/asutp/internal/sender"
+)
+
+// envelopeBatch is a run of envelopes bound for the same sender. encoded
+// holds the JSON of each envelope when it was needed for sizing.
+type envelopeBatch struct {
+	sender    sender.Sender
+	envelopes []*model.Envelope
+	encoded   []json.RawMessage
+	bytes     int
+}
+
+// batchEnvelopes splits envelopes into batches per sender, closing a batch
+// when adding the next envelope would exceed maxCount envelopes or maxBytes
+// of serialized JSON, whichever comes first. An envelope larger than maxBytes
+// gets a batch of its own. Zero limits are ignored.
+func (m *Manager) batchEnvelopes(envelopes []*model.Envelope, maxCount, maxBytes int) []*envelopeBatch {
+	var (
+		batches []*envelopeBatch
+		current *envelopeBatch
+	)
+
+	for _, envelope := range envelopes {
+		snd := m.senderFor(envelope)
+
+		size := 0
+		var data []byte
+		if maxBytes > 0 {
+			var err error
+			data, err = json.Marshal(envelope)
+			if err == nil {
+				// One byte for the separating comma in the batch array.
+				size = len(data) + 1
+			}
+		}
+
+		full := current != nil && ((maxCount > 0 && len(current.envelopes) >= maxCount) ||
+			(maxBytes > 0 && current.bytes+size > maxBytes))
+		if current == nil || current.sender != snd || full {
+			current = &envelopeBatch{sender: snd}
+			batches = append(batches, current)
+		}
+
+		current.envelopes = append(current.envelopes, envelope)
+		current.bytes += size
+		if maxBytes > 0 {
+			current.encoded = append(current.encoded, data)
+		}
+	}
+
+	return batches
+}
+
+// sendBatch forwards a batch to its sender, waiting for a free slot when the
+// number of in-flight sends is capped. retry, when set, replaces the retry
+// policy of a sender.ReplaySender, and a sender.EncodedBatchSender reuses the
+// JSON encoded for sizing.
+func (m *Manager) sendBatch(ctx context.Context, batch *envelopeBatch, retry *sender.RetryConfig) error {
+	if m.sendSem != nil {
+		select {
+		case m.sendSem <- struct{}{}:
+			defer func() { <-m.sendSem }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if retry != nil {
+		if encoder, ok := batch.sender.(sender.EncodedBatchSender); ok && batch.encoded != nil {
+			return encoder.SendEncodedBatch(ctx, batch.envelopes, batch.encoded, *retry)
+		}
+		if replayer, ok := batch.sender.(sender.ReplaySender); ok {
+			return replayer.SendBatchWithRetry(ctx, batch.envelopes, *retry)
+		}
+	}
+	return batch.sender.SendBatch(ctx, batch.envelopes)
+}
@@ -2,16 +2,32 @@ package collector
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/speedwagon-io/asutp/internal/config"
 	"github.com/speedwagon-io/asutp/internal/model"
 )
 
 type CollectedData struct {
-	DeviceID    string
-	DeviceName  string
-	DeviceGroup string
-	DataPoints  []model.DataPoint
+	DeviceID    string            `json:"device_id"`
+	DeviceName  string            `json:"device_name"`
+	DeviceGroup string            `json:"device_group"`
+	DataPoints  []model.DataPoint `json:"datapoints"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Raw         json.RawMessage   `json:"raw,omitempty"`
+
+	// Timestamp is the source time of a historical reading; zero means the
+	// reading is current.
+	Timestamp time.Time `json:"timestamp,omitempty"`
+
+	// CorrelationID ties the reading to its collection tick in logs and
+	// in the envelope sent for it.
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// Event marks data holding only changed event fields, sent as an
+	// envelope with the MetaEvent meta key.
+	Event bool `json:"event,omitempty"`
 }
 
 type Collector interface {
@@ -19,3 +35,75 @@ type Collector interface {
 	Name() string
 	Close() error
 }
+
+// Prober is implemented by collectors that can cheaply check connectivity to
+// their source without collecting a device.
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// Device status values set in envelope metadata for devices with
+// ReportFaults enabled.
+const (
+	MetadataDeviceStatus = "device_status"
+	DeviceUnreachable    = "unreachable"
+	DeviceFault          = "fault"
+)
+
+// Envelope meta keys set by the manager. MetaReplay marks envelopes sent from
+// the buffer rather than straight after collection, MetaBackfill envelopes
+// built from a device's historical log, MetaEvent envelopes of event fields.
+const (
+	MetaConfigChecksum = "config_checksum"
+	MetaReplay         = "replay"
+	MetaBackfill       = "backfill"
+	MetaEvent          = "event"
+)
+
+// unreachableData builds an all-bad result for a device that could not be
+// collected, so downstream can tell "device silent" from no data at all.
+func unreachableData(device *config.DeviceConfig) *CollectedData {
+	points := make([]model.DataPoint, 0, len(device.Fields))
+	for _, field := range device.Fields {
+		points = append(points, model.DataPoint{
+			Name:          field.Target,
+			Unit:          field.Unit,
+			Quality:       model.QualityBad,
+			QualityReason: model.ReasonCollectError,
+		})
+	}
+	return &CollectedData{
+		DeviceID:    device.ID,
+		DeviceName:  device.Name,
+		DeviceGroup: device.Group,
+		DataPoints:  points,
+		Metadata:    map[string]string{MetadataDeviceStatus: DeviceUnreachable},
+	}
+}
+
+// prefixFields namespaces every data point name as prefix.name, using the
+// names the device config precomputed.
+func prefixFields(data *CollectedData, device *config.DeviceConfig) {
+	if device.FieldPrefix == "" {
+		return
+	}
+	for i := range data.DataPoints {
+		data.DataPoints[i].Name = device.PointName(data.DataPoints[i].Name)
+	}
+}
+
+// markFaulted tags a reachable device whose points are all bad.
+func markFaulted(data *CollectedData) {
+	if len(data.DataPoints) == 0 {
+		return
+	}
+	for _, dp := range data.DataPoints {
+		if dp.Quality != model.QualityBad {
+			return
+		}
+	}
+	if data.Metadata == nil {
+		data.Metadata = make(map[string]string, 1)
+	}
+	data.Metadata[MetadataDeviceStatus] = DeviceFault
+}
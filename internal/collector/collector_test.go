@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// prefixedDevice loads a device with a field prefix and the given number of
+// fields through the station config, which precomputes the point names.
+func prefixedDevice(t testing.TB, fields int) *config.DeviceConfig {
+	t.Helper()
+	var yaml strings.Builder
+	yaml.WriteString("id: breaker1\nfield_prefix: breaker\nfields:\n")
+	for i := 0; i < fields; i++ {
+		fmt.Fprintf(&yaml, "  - source: f%d\n    target: f%d\n", i, i)
+	}
+	path := filepath.Join(t.TempDir(), "device.yaml")
+	if err := os.WriteFile(path, []byte(yaml.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := (&config.StationConfig{}).AddDeviceFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return device
+}
+
+func collectedFor(device *config.DeviceConfig) *CollectedData {
+	data := &CollectedData{DeviceID: device.ID, DataPoints: NewDataPoints(len(device.Fields))}
+	for _, f := range device.Fields {
+		data.DataPoints = append(data.DataPoints, model.DataPoint{Name: f.Target, Quality: model.QualityGood})
+	}
+	return data
+}
+
+func TestPrefixFields(t *testing.T) {
+	device := prefixedDevice(t, 2)
+	data := collectedFor(device)
+	data.DataPoints = append(data.DataPoints, model.DataPoint{Name: "unconfigured"})
+
+	prefixFields(data, device)
+
+	for i, want := range []string{"breaker.f0", "breaker.f1", "breaker.unconfigured"} {
+		if data.DataPoints[i].Name != want {
+			t.Fatalf("point %d = %q, want %q", i, data.DataPoints[i].Name, want)
+		}
+	}
+}
+
+func BenchmarkPrefixFields(b *testing.B) {
+	device := prefixedDevice(b, 200)
+	data := collectedFor(device)
+	names := make([]string, len(data.DataPoints))
+	for i, dp := range data.DataPoints {
+		names[i] = dp.Name
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range data.DataPoints {
+			data.DataPoints[j].Name = names[j]
+		}
+		prefixFields(data, device)
+	}
+}
+
+func TestEventFieldsRepeatUntilCommitted(t *testing.T) {
+	e := newEventFields([]config.DeviceConfig{{
+		ID:     "breaker1",
+		Fields: []config.FieldConfig{{Target: "status", Event: true}},
+	}})
+	reading := func() *CollectedData {
+		return &CollectedData{
+			DeviceID:   "breaker1",
+			DataPoints: []model.DataPoint{{Name: "status", Value: model.StringValue("open"), Quality: model.QualityGood}},
+		}
+	}
+
+	first := e.extract(reading())
+	if first == nil {
+		t.Fatal("first reading emitted no event")
+	}
+	if e.extract(reading()) == nil {
+		t.Fatal("undelivered event was not emitted again")
+	}
+
+	e.commit(first)
+	if e.extract(reading()) != nil {
+		t.Fatal("delivered event was emitted again")
+	}
+}
+
+func TestStationStatusCountsStaleDevices(t *testing.T) {
+	now := time.Now()
+	good := func(ts time.Time) []model.DataPoint {
+		return []model.DataPoint{{Name: "p", Value: model.FloatValue(1), Quality: model.QualityGood, Timestamp: ts}}
+	}
+
+	status := newStationStatus()
+	status.observe(&CollectedData{DeviceID: "fresh", Timestamp: now, DataPoints: good(now)}, time.Hour, now)
+	if len(status.faulted) != 0 || status.worst != model.QualityGood {
+		t.Fatalf("fresh device: faulted %v, worst %s", status.faulted, status.worst)
+	}
+
+	status.observe(&CollectedData{DeviceID: "old", Timestamp: now.Add(-2 * time.Hour), DataPoints: good(now)}, time.Hour, now)
+	status.observe(&CollectedData{DeviceID: "stuck", Timestamp: now, DataPoints: good(now.Add(-2 * time.Hour))}, time.Hour, now)
+	if _, ok := status.faulted["old"]; !ok {
+		t.Error("reading older than max age not counted as faulted")
+	}
+	if _, ok := status.faulted["stuck"]; !ok {
+		t.Error("device with only stale points not counted as faulted")
+	}
+	if status.worst != model.QualityBad {
+		t.Errorf("worst quality = %s, want bad", status.worst)
+	}
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// badStreaks counts consecutive bad-quality readings per device field.
+type badStreaks struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int
+}
+
+func newBadStreaks() *badStreaks {
+	return &badStreaks{counts: make(map[string]map[string]int)}
+}
+
+// escalate updates the streaks with the device's latest points and sets
+// severity on points that have been bad for at least threshold readings in a
+// row. A good or uncertain reading resets the streak.
+func (s *badStreaks) escalate(data *CollectedData, threshold int, severity string) {
+	if threshold <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts, ok := s.counts[data.DeviceID]
+	if !ok {
+		counts = make(map[string]int)
+		s.counts[data.DeviceID] = counts
+	}
+
+	for i := range data.DataPoints {
+		dp := &data.DataPoints[i]
+		if dp.Quality != model.QualityBad {
+			delete(counts, dp.Name)
+			continue
+		}
+		counts[dp.Name]++
+		if counts[dp.Name] >= threshold {
+			dp.Severity = severity
+		}
+	}
+}
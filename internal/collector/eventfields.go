@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// eventFields splits event points (see config.FieldConfig.Event) out of
+// collected data. It remembers the last delivered value and quality of each
+// event point, so an event is emitted only when one of them changes.
+type eventFields struct {
+	names map[string]map[string]struct{}
+
+	mu   sync.Mutex
+	last map[string]map[string]eventState
+}
+
+type eventState struct {
+	value   model.Value
+	quality string
+}
+
+func newEventFields(devices []config.DeviceConfig) *eventFields {
+	names := make(map[string]map[string]struct{})
+	for i := range devices {
+		d := &devices[i]
+		for _, f := range d.Fields {
+			if !f.Event {
+				continue
+			}
+			if names[d.ID] == nil {
+				names[d.ID] = make(map[string]struct{})
+			}
+			names[d.ID][d.PointName(f.Target)] = struct{}{}
+		}
+	}
+	return &eventFields{names: names, last: make(map[string]map[string]eventState)}
+}
+
+// extract removes the device's event points from data and returns those
+// that changed since the last delivered reading as event data, or nil when
+// none did. The change is remembered only once commit is called, so an event
+// that fails to send is emitted again by the next reading.
+func (e *eventFields) extract(data *CollectedData) *CollectedData {
+	names := e.names[data.DeviceID]
+	if len(names) == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	last := e.last[data.DeviceID]
+	var changed []model.DataPoint
+	kept := data.DataPoints[:0]
+	for _, dp := range data.DataPoints {
+		if _, ok := names[dp.Name]; !ok {
+			kept = append(kept, dp)
+			continue
+		}
+		state := eventState{value: dp.Value, quality: dp.Quality}
+		if prev, seen := last[dp.Name]; seen && prev == state {
+			continue
+		}
+		changed = append(changed, dp)
+	}
+	clear(data.DataPoints[len(kept):])
+	data.DataPoints = kept
+
+	if len(changed) == 0 {
+		return nil
+	}
+	return &CollectedData{
+		DeviceID:      data.DeviceID,
+		DeviceName:    data.DeviceName,
+		DeviceGroup:   data.DeviceGroup,
+		DataPoints:    changed,
+		Metadata:      data.Metadata,
+		Timestamp:     data.Timestamp,
+		CorrelationID: data.CorrelationID,
+		Event:         true,
+	}
+}
+
+// commit remembers the points of delivered event data as the last state of
+// its device's event points.
+func (e *eventFields) commit(data *CollectedData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	last, ok := e.last[data.DeviceID]
+	if !ok {
+		last = make(map[string]eventState)
+		e.last[data.DeviceID] = last
+	}
+	for _, dp := range data.DataPoints {
+		last[dp.Name] = eventState{value: dp.Value, quality: dp.Quality}
+	}
+}
@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/health"
+)
+
+const bufferRetryInterval = 30 * time.Second
+
+// heartbeat records the last time a loop made progress.
+type heartbeat struct {
+	last atomic.Int64
+}
+
+func (h *heartbeat) beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+func (h *heartbeat) time() time.Time {
+	return time.Unix(0, h.last.Load())
+}
+
+// Heartbeats reports the progress of collection cycles and the buffer-retry
+// loop. The cycle heartbeat beats when a cycle completes, so a stuck cycle
+// fails liveness even while ticks keep arriving. threshold is its maximum
+// age; when zero it defaults to three polling intervals. The retry loop is
+// allowed at least three of its own intervals.
+func (m *Manager) Heartbeats(threshold time.Duration) []health.Heartbeat {
+	if threshold <= 0 {
+		threshold = 3 * m.stationCfg.Polling.Interval
+	}
+
+	beats := []health.Heartbeat{{
+		Name:   "cycle",
+		Last:   m.cycleBeat.time(),
+		MaxAge: threshold,
+	}}
+
+	if m.bufferEnabled && m.buffer != nil {
+		beats = append(beats, health.Heartbeat{
+			Name:   "buffer_retry",
+			Last:   m.retryBeat.time(),
+			MaxAge: max(threshold, 3*bufferRetryInterval),
+		})
+	}
+
+	return beats
+}
@@ -2,15 +2,30 @@ package collector
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math/rand"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/speedwagon-io/asutp/internal/buffer"
 	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/events"
+	"github.com/speedwagon-io/asutp/internal/health"
 	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
 	"github.com/speedwagon-io/asutp/internal/model"
 	"github.com/speedwagon-io/asutp/internal/sender"
+	"github.com/speedwagon-io/asutp/internal/version"
+)
+
+const (
+	OverlapSkip  = "skip"
+	OverlapQueue = "queue"
 )
 
 type Manager struct {
@@ -19,10 +34,36 @@ type Manager struct {
 	stationCfg    *config.StationConfig
 	collector     Collector
 	sender        sender.Sender
+	groupSenders  map[string]sender.Sender
+	eventSender   sender.Sender
 	buffer        buffer.Buffer
 	stopCh        chan struct{}
 	wg            sync.WaitGroup
 	bufferEnabled bool
+	sendSem       chan struct{}
+	readiness     *health.Readiness
+	drainMu       sync.Mutex
+	cycleBeat     heartbeat
+	retryBeat     heartbeat
+	throttle      *sendThrottle
+	minIntervals  map[string]time.Duration
+	priorities    map[string]int
+	stats         *sessionStats
+	events        *events.Bus
+	lastCycle     atomic.Pointer[cycleSummary]
+	watchdog      watchdog
+	envelopeMeta  map[string]string
+	sequences     SequenceStore
+	watermarks    WatermarkStore
+	backfilling   sync.Map
+	streaks       *badStreaks
+	eventFields   *eventFields
+
+	cycleMu       sync.Mutex
+	cycleRunning  bool
+	cycleQueued   bool
+	cancelCycle   context.CancelFunc
+	skippedCycles int64
 }
 
 func NewManager(
@@ -33,7 +74,23 @@ func NewManager(
 	sender sender.Sender,
 	buffer buffer.Buffer,
 ) *Manager {
-	return &Manager{
+	var sendSem chan struct{}
+	if cfg.Sender.MaxConcurrent > 0 {
+		sendSem = make(chan struct{}, cfg.Sender.MaxConcurrent)
+	}
+
+	minIntervals := make(map[string]time.Duration)
+	priorities := make(map[string]int)
+	for _, d := range stationCfg.Devices {
+		if d.MinSendInterval > 0 {
+			minIntervals[d.ID] = d.MinSendInterval
+		}
+		if d.Priority != 0 {
+			priorities[d.ID] = d.Priority
+		}
+	}
+
+	m := &Manager{
 		log:           log,
 		cfg:           cfg,
 		stationCfg:    stationCfg,
@@ -42,6 +99,76 @@ func NewManager(
 		buffer:        buffer,
 		stopCh:        make(chan struct{}),
 		bufferEnabled: cfg.Buffer.Enabled,
+		sendSem:       sendSem,
+		throttle:      newSendThrottle(),
+		minIntervals:  minIntervals,
+		priorities:    priorities,
+		stats:         newSessionStats(),
+		sequences:     newMemorySequences(),
+		watermarks:    newMemoryWatermarks(),
+		streaks:       newBadStreaks(),
+		eventFields:   newEventFields(stationCfg.Devices),
+	}
+	m.cycleBeat.beat()
+	m.retryBeat.beat()
+
+	return m
+}
+
+// SetReadiness registers the readiness tracker notified of the first
+// successful collection and send.
+func (m *Manager) SetReadiness(readiness *health.Readiness) {
+	m.readiness = readiness
+}
+
+// SetEventBus registers the bus that collection and send failures are
+// published to.
+func (m *Manager) SetEventBus(bus *events.Bus) {
+	m.events = bus
+}
+
+// SetEnvelopeMeta sets entries added to the Meta of every envelope built by
+// the manager, e.g. the config checksum.
+func (m *Manager) SetEnvelopeMeta(meta map[string]string) {
+	m.envelopeMeta = meta
+}
+
+// SetSequenceStore replaces the in-memory sequence counter with a persistent
+// one, so sequence numbers continue across restarts.
+func (m *Manager) SetSequenceStore(store SequenceStore) {
+	m.sequences = store
+}
+
+// SetWatermarkStore persists backfill watermarks, e.g. in the buffer.
+func (m *Manager) SetWatermarkStore(store WatermarkStore) {
+	m.watermarks = store
+}
+
+// SetGroupSenders registers senders used for envelopes of specific device
+// groups. Envelopes of other groups go to the default sender.
+func (m *Manager) SetGroupSenders(senders map[string]sender.Sender) {
+	m.groupSenders = senders
+}
+
+// SetEventSender registers the sender used for event envelopes. Without one
+// they go to the sender of their device group.
+func (m *Manager) SetEventSender(s sender.Sender) {
+	m.eventSender = s
+}
+
+func (m *Manager) senderFor(envelope *model.Envelope) sender.Sender {
+	if m.eventSender != nil && envelope.Meta[MetaEvent] == "true" {
+		return m.eventSender
+	}
+	if s, ok := m.groupSenders[envelope.DeviceGroup]; ok {
+		return s
+	}
+	return m.sender
+}
+
+func (m *Manager) markReady(criterion string) {
+	if m.readiness != nil {
+		m.readiness.Mark(criterion)
 	}
 }
 
@@ -51,13 +178,25 @@ func (m *Manager) Start(ctx context.Context) {
 		slog.Duration("interval", m.stationCfg.Polling.Interval),
 	)
 
+	m.wg.Add(2)
+	go m.retryBufferedData(ctx)
+	go m.cleanupBuffer(ctx)
+
+	if !m.waitInitialDelay(ctx) {
+		return
+	}
+
 	ticker := time.NewTicker(m.stationCfg.Polling.Interval)
 	defer ticker.Stop()
 
-	m.wg.Add(1)
-	go m.retryBufferedData(ctx)
+	m.watchdog.lastSuccess.beat()
+	// With no devices nothing can succeed, so the watchdog would only loop.
+	if m.cfg.Watchdog.Enabled && len(m.stationCfg.Devices) > 0 {
+		m.wg.Add(1)
+		go m.runWatchdog(ctx)
+	}
 
-	m.collectAndSend(ctx)
+	m.triggerCycle(ctx)
 
 	for {
 		select {
@@ -68,8 +207,128 @@ func (m *Manager) Start(ctx context.Context) {
 			m.log.Info("stop signal received, stopping manager")
 			return
 		case <-ticker.C:
-			m.collectAndSend(ctx)
+			m.triggerCycle(ctx)
+		}
+	}
+}
+
+// waitInitialDelay holds off the first collection for Polling.InitialDelay,
+// keeping the cycle heartbeat alive meanwhile. It returns false if the
+// manager was stopped while waiting.
+func (m *Manager) waitInitialDelay(ctx context.Context) bool {
+	delay := m.stationCfg.Polling.InitialDelay
+	if delay <= 0 {
+		return true
+	}
+
+	m.log.Info("delaying first collection", slog.Duration("initial_delay", delay))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	beat := time.NewTicker(m.stationCfg.Polling.Interval)
+	defer beat.Stop()
+
+	for {
+		m.cycleBeat.beat()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-m.stopCh:
+			return false
+		case <-beat.C:
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+// CollectDevice runs a one-off collection of a single device without sending
+// or buffering the result. found is false if the device is not configured.
+func (m *Manager) CollectDevice(ctx context.Context, deviceID string) (data *CollectedData, found bool, err error) {
+	for i := range m.stationCfg.Devices {
+		device := &m.stationCfg.Devices[i]
+		if device.ID != deviceID {
+			continue
+		}
+
+		collectCtx, cancel := context.WithTimeout(ctx, m.stationCfg.Polling.Timeout)
+		defer cancel()
+
+		data, err := m.collector.Collect(collectCtx, device)
+		if err == nil {
+			prefixFields(data, device)
+		}
+		return data, true, err
+	}
+	return nil, false, nil
+}
+
+// PreviewEnvelope builds the envelope the manager would send for data
+// without sending or buffering it.
+func (m *Manager) PreviewEnvelope(ctx context.Context, data *CollectedData) (*model.Envelope, error) {
+	return m.newEnvelope(ctx, data)
+}
+
+// SkippedCycles returns the number of ticks dropped because the previous
+// collection cycle was still running.
+func (m *Manager) SkippedCycles() int64 {
+	m.cycleMu.Lock()
+	defer m.cycleMu.Unlock()
+	return m.skippedCycles
+}
+
+// triggerCycle starts a collection cycle in the background unless one is
+// already running, in which case the tick is skipped or queued according to
+// the polling overlap policy.
+func (m *Manager) triggerCycle(ctx context.Context) {
+	m.cycleMu.Lock()
+	if m.cycleRunning {
+		if m.stationCfg.Polling.OverlapPolicy == OverlapQueue {
+			m.cycleQueued = true
+			m.log.Debug("previous collection still running, cycle queued")
+		} else {
+			m.skippedCycles++
+			m.log.Warn("previous collection still running, skipping tick",
+				slog.Int64("skipped_total", m.skippedCycles),
+			)
 		}
+		m.cycleMu.Unlock()
+		return
+	}
+	cycleCtx, cancel := context.WithCancel(ctx)
+	m.cycleRunning = true
+	m.cancelCycle = cancel
+	m.cycleMu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		for {
+			m.collectAndSend(cycleCtx)
+			m.cycleBeat.beat()
+
+			m.cycleMu.Lock()
+			if !m.cycleQueued || cycleCtx.Err() != nil || m.stopped() {
+				m.cycleQueued = false
+				m.cycleRunning = false
+				m.cancelCycle = nil
+				m.cycleMu.Unlock()
+				return
+			}
+			m.cycleQueued = false
+			m.cycleMu.Unlock()
+		}
+	}()
+}
+
+func (m *Manager) stopped() bool {
+	select {
+	case <-m.stopCh:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -79,30 +338,93 @@ func (m *Manager) Stop() {
 	if err := m.collector.Close(); err != nil {
 		m.log.Error("failed to close collector", sl.Err(err))
 	}
+	m.logShutdownReport()
 }
 
 func (m *Manager) collectAndSend(ctx context.Context) {
+	if len(m.stationCfg.Devices) == 0 {
+		return
+	}
+	m.collectDevices(ctx, m.devicesByPriority())
+}
+
+// RunOnce runs a single collection cycle through the normal pipeline and
+// waits until every envelope has been sent or buffered. deviceIDs limits the
+// cycle to those devices; empty means all of them.
+func (m *Manager) RunOnce(ctx context.Context, deviceIDs []string) (CycleResult, error) {
+	devices := m.devicesByPriority()
+	if len(deviceIDs) > 0 {
+		selected := make([]*config.DeviceConfig, 0, len(deviceIDs))
+		for _, id := range deviceIDs {
+			if !m.hasDevice(id) {
+				return CycleResult{}, fmt.Errorf("unknown device: %s", id)
+			}
+		}
+		for _, device := range devices {
+			if slices.Contains(deviceIDs, device.ID) {
+				selected = append(selected, device)
+			}
+		}
+		devices = selected
+	}
+	return m.collectDevices(ctx, devices).result(), nil
+}
+
+// collectDevices collects the devices concurrently and sends the results,
+// returning once all sends have finished.
+func (m *Manager) collectDevices(ctx context.Context, devices []*config.DeviceConfig) *cycleSummary {
+	summary := newCycleSummary()
+	defer func() {
+		summary.log(m.log, m.stationCfg.StationID)
+		m.lastCycle.Store(summary)
+	}()
+
 	var wg sync.WaitGroup
-	results := make(chan *CollectedData, len(m.stationCfg.Devices))
+	results := make(chan collectResult, len(devices))
+	tickID := uuid.NewString()
+	status := newStationStatus()
 
-	for i := range m.stationCfg.Devices {
-		device := &m.stationCfg.Devices[i]
+	for _, device := range devices {
 		wg.Add(1)
+		summary.attempted.Add(1)
 		go func(d *config.DeviceConfig) {
 			defer wg.Done()
+			correlationID := tickID + "/" + d.ID
 
 			collectCtx, cancel := context.WithTimeout(ctx, m.stationCfg.Polling.Timeout)
 			defer cancel()
 
 			data, err := m.collector.Collect(collectCtx, d)
 			if err != nil {
+				summary.failed.Add(1)
+				status.fail(d.ID)
 				m.log.Error("failed to collect data",
 					slog.String("device_id", d.ID),
+					slog.String("correlation_id", correlationID),
 					sl.Err(err),
 				)
+				m.events.Publish(events.LevelError, events.KindCollectFailed, d.ID, err.Error())
+				if !d.ReportFaults {
+					results <- collectResult{device: d}
+					return
+				}
+				data = unreachableData(d)
+				data.CorrelationID = correlationID
+				prefixFields(data, d)
+				m.streaks.escalate(data, m.cfg.Envelope.EscalateAfter, m.cfg.Envelope.EscalateSeverity)
+				results <- collectResult{device: d, data: data}
 				return
 			}
-			results <- data
+			data.CorrelationID = correlationID
+			prefixFields(data, d)
+			if d.ReportFaults {
+				markFaulted(data)
+			}
+			m.streaks.escalate(data, m.cfg.Envelope.EscalateAfter, m.cfg.Envelope.EscalateSeverity)
+			summary.succeeded.Add(1)
+			m.collectSucceeded()
+			m.markReady(health.ReadinessCollect)
+			results <- collectResult{device: d, data: data}
 		}(device)
 	}
 
@@ -111,48 +433,329 @@ func (m *Manager) collectAndSend(ctx context.Context) {
 		close(results)
 	}()
 
-	for data := range results {
-		// Skip empty data (e.g., when endpoint returns "True"/"False")
-		if len(data.DataPoints) == 0 {
-			m.log.Debug("skipping empty data",
-				slog.String("device_id", data.DeviceID),
-			)
-			continue
+	var sendWg sync.WaitGroup
+	dispatch := func(data *CollectedData) {
+		sendWg.Add(1)
+		go func() {
+			defer sendWg.Done()
+			outcome := m.sendCollected(ctx, data)
+			summary.recordSend(outcome)
+			m.stats.record(data.DeviceID, outcome)
+			if data.Event && outcome != sendFailed {
+				m.eventFields.commit(data)
+			}
+			// The envelope has been sent or buffered in serialized form by
+			// now, so its points can be reused by the next cycle.
+			ReleaseDataPoints(data.DataPoints)
+			data.DataPoints = nil
+		}()
+	}
+
+	// With priorities configured, a priority level is sent as soon as all of
+	// its devices have been collected and the previous, higher level has
+	// finished sending. devices is sorted by priority, so levels is too.
+	var (
+		levels    []int
+		next      int
+		remaining = make(map[int]int)
+		held      = make(map[int][]*CollectedData)
+	)
+	for _, device := range devices {
+		if remaining[device.Priority] == 0 {
+			levels = append(levels, device.Priority)
+		}
+		remaining[device.Priority]++
+	}
+	sendLevels := func() {
+		for ; next < len(levels) && remaining[levels[next]] == 0; next++ {
+			level := levels[next]
+			if len(held[level]) == 0 {
+				continue
+			}
+			sendWg.Wait()
+			for _, data := range held[level] {
+				dispatch(data)
+			}
+			delete(held, level)
+		}
+	}
+
+	for result := range results {
+		if data := result.data; data != nil && m.admit(data, status, summary, dispatch) {
+			if len(m.priorities) > 0 {
+				held[result.device.Priority] = append(held[result.device.Priority], data)
+			} else {
+				dispatch(data)
+			}
+		}
+		remaining[result.device.Priority]--
+		if len(m.priorities) > 0 {
+			sendLevels()
+		}
+	}
+
+	ready := m.throttle.due(time.Now())
+	if statusData := m.statusData(status, tickID+"/"+m.cfg.Status.DeviceID); statusData != nil {
+		ready = append(ready, statusData)
+	}
+	if len(m.priorities) == 0 {
+		for _, data := range ready {
+			dispatch(data)
+		}
+		sendWg.Wait()
+		return summary
+	}
+
+	// Readings released by the throttle and the station status follow the
+	// collected levels, again highest priority first.
+	sort.SliceStable(ready, func(i, j int) bool {
+		return m.priorities[ready[i].DeviceID] > m.priorities[ready[j].DeviceID]
+	})
+	for i, data := range ready {
+		if i == 0 || m.priorities[data.DeviceID] != m.priorities[ready[i-1].DeviceID] {
+			sendWg.Wait()
 		}
+		dispatch(data)
+	}
+	sendWg.Wait()
+	return summary
+}
+
+// collectResult is the outcome of collecting one device in a cycle. data is
+// nil when the collect failed and the device does not report faults.
+type collectResult struct {
+	device *config.DeviceConfig
+	data   *CollectedData
+}
+
+// admit records collected data in the cycle status and summary, dispatches
+// its event points at once and reports whether the data itself is to be
+// sent, i.e. it is neither empty nor held back by the send throttle.
+func (m *Manager) admit(data *CollectedData, status *stationStatus, summary *cycleSummary, dispatch func(*CollectedData)) bool {
+	status.observe(data, m.cfg.Sender.MaxAge, time.Now())
+
+	// Events are neither throttled nor held back by priority, so a change
+	// is sent in the cycle that saw it.
+	if eventData := m.eventFields.extract(data); eventData != nil {
+		summary.datapoints.Add(int64(len(eventData.DataPoints)))
+		dispatch(eventData)
+	}
 
-		envelope := model.NewEnvelope(
-			m.stationCfg.StationID,
-			m.stationCfg.StationName,
-			data.DeviceID,
-			data.DeviceName,
-			data.DeviceGroup,
-			data.DataPoints,
+	// Skip empty data (e.g., when endpoint returns "True"/"False")
+	if len(data.DataPoints) == 0 && data.Raw == nil {
+		summary.empty.Add(1)
+		m.log.Debug("skipping empty data",
+			slog.String("device_id", data.DeviceID),
 		)
+		return false
+	}
 
-		if err := m.sender.Send(ctx, envelope); err != nil {
-			m.log.Error("failed to send data",
-				slog.String("device_id", data.DeviceID),
-				sl.Err(err),
-			)
+	summary.datapoints.Add(int64(len(data.DataPoints)))
 
-			if m.bufferEnabled && m.buffer != nil {
-				if bufErr := m.buffer.Store(ctx, envelope); bufErr != nil {
-					m.log.Error("failed to buffer data",
-						slog.String("device_id", data.DeviceID),
-						sl.Err(bufErr),
-					)
-				} else {
-					m.log.Info("data buffered for later retry",
-						slog.String("device_id", data.DeviceID),
-					)
-				}
+	if !m.throttle.admit(data, m.minIntervals[data.DeviceID], time.Now()) {
+		summary.throttled.Add(1)
+		m.log.Debug("send throttled, keeping latest reading",
+			slog.String("device_id", data.DeviceID),
+		)
+		return false
+	}
+	return true
+}
+
+// devicesByPriority returns the station devices, highest priority first.
+// Devices of equal priority keep their configured order.
+func (m *Manager) devicesByPriority() []*config.DeviceConfig {
+	devices := make([]*config.DeviceConfig, len(m.stationCfg.Devices))
+	for i := range m.stationCfg.Devices {
+		devices[i] = &m.stationCfg.Devices[i]
+	}
+	sort.SliceStable(devices, func(i, j int) bool {
+		return devices[i].Priority > devices[j].Priority
+	})
+	return devices
+}
+
+func (m *Manager) sendCollected(ctx context.Context, data *CollectedData) sendOutcome {
+	envelope, err := m.newEnvelope(ctx, data)
+	if err != nil {
+		m.log.Error("dropping data without envelope",
+			slog.String("device_id", data.DeviceID),
+			slog.String("correlation_id", data.CorrelationID),
+			sl.Err(err),
+		)
+		return sendFailed
+	}
+
+	if m.isStale(envelope, time.Now()) {
+		m.log.Warn("dropping stale data",
+			slog.String("device_id", data.DeviceID),
+			slog.String("correlation_id", data.CorrelationID),
+			slog.Time("timestamp", envelope.Timestamp),
+		)
+		return sendFailed
+	}
+
+	if !m.checkEnvelope(envelope) {
+		return sendFailed
+	}
+
+	outcome := sendOK
+	for _, part := range envelope.Split(m.cfg.Envelope.MaxPoints) {
+		outcome = max(outcome, m.deliver(ctx, part, data))
+	}
+	return outcome
+}
+
+// deliver sends one envelope of collected data, buffering it when the send
+// fails.
+func (m *Manager) deliver(ctx context.Context, envelope *model.Envelope, data *CollectedData) sendOutcome {
+	if err := m.send(ctx, envelope, nil); err != nil {
+		m.log.Error("failed to send data",
+			slog.String("device_id", data.DeviceID),
+			slog.String("correlation_id", data.CorrelationID),
+			sl.Err(err),
+		)
+		m.events.Publish(events.LevelError, events.KindSendFailed, data.DeviceID, err.Error())
+
+		if m.bufferEnabled && m.buffer != nil {
+			if bufErr := m.storeEnvelope(ctx, envelope); bufErr != nil {
+				m.log.Error("failed to buffer data",
+					slog.String("device_id", data.DeviceID),
+					slog.String("correlation_id", data.CorrelationID),
+					sl.Err(bufErr),
+				)
+				m.events.Publish(events.LevelError, events.KindBufferFailed, data.DeviceID, bufErr.Error())
+			} else {
+				m.markReady(health.ReadinessSender)
+				m.log.Info("data buffered for later retry",
+					slog.String("device_id", data.DeviceID),
+					slog.String("correlation_id", data.CorrelationID),
+				)
+				m.advanceWatermark(ctx, envelope)
+				return sendBuffered
 			}
-		} else {
-			m.log.Debug("data sent successfully",
-				slog.String("device_id", data.DeviceID),
+		}
+		return sendFailed
+	}
+
+	m.markReady(health.ReadinessSender)
+	m.log.Debug("data sent successfully",
+		slog.String("device_id", data.DeviceID),
+		slog.String("correlation_id", data.CorrelationID),
+	)
+	m.advanceWatermark(ctx, envelope)
+	return sendOK
+}
+
+// newEnvelope wraps collected data in an envelope with the station, meta,
+// sequence and priority filled in. It fails when no sequence number can be
+// assigned, rather than sending a sequence of 0.
+func (m *Manager) newEnvelope(ctx context.Context, data *CollectedData) (*model.Envelope, error) {
+	// The sequence is assigned first, since sequence IDs are derived from it.
+	sequence, err := m.sequences.NextSequence(ctx, data.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign envelope sequence: %w", err)
+	}
+
+	envelope := model.NewEnvelope(
+		m.stationCfg.StationID,
+		m.stationCfg.StationName,
+		data.DeviceID,
+		data.DeviceName,
+		data.DeviceGroup,
+		data.DataPoints,
+		model.WithTimestamp(data.Timestamp),
+		model.WithTimestampPrecision(m.cfg.Envelope.TimestampPrecision),
+		model.WithMetadata(data.Metadata),
+		model.WithMeta(m.envelopeMeta),
+		model.WithRaw(data.Raw),
+		model.WithSequence(sequence),
+		model.WithIDStrategy(m.cfg.Envelope.IDStrategy),
+	)
+	envelope.CorrelationID = data.CorrelationID
+	if data.Event {
+		envelope.SetMeta(MetaEvent, "true")
+	}
+
+	if m.cfg.Envelope.IncludeCollectorVersion {
+		envelope.CollectorVersion = version.Version
+	}
+
+	envelope.Priority = m.priorities[data.DeviceID]
+
+	return envelope, nil
+}
+
+// shutdownStoreTimeout bounds buffering of an envelope whose send was cut
+// short by cancellation.
+const shutdownStoreTimeout = 5 * time.Second
+
+// storeEnvelope buffers the envelope. When ctx is already cancelled, e.g. a
+// send interrupted by shutdown, it stores with a short-lived context detached
+// from ctx so the last readings are not lost.
+func (m *Manager) storeEnvelope(ctx context.Context, envelope *model.Envelope) error {
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), shutdownStoreTimeout)
+		defer cancel()
+	}
+	return m.buffer.Store(ctx, envelope)
+}
+
+// checkEnvelope applies the non-finite value policy, marks points older
+// than the sender max age as stale and validates the envelope, logging and
+// reporting false for envelopes that must be dropped.
+func (m *Manager) checkEnvelope(envelope *model.Envelope) bool {
+	if m.cfg.Sender.MaxAge > 0 {
+		if n := envelope.MarkStale(m.cfg.Sender.MaxAge); n > 0 {
+			m.log.Warn("marked stale values with bad quality",
+				slog.String("device_id", envelope.DeviceID),
+				slog.Int("count", n),
 			)
 		}
 	}
+
+	if m.cfg.Envelope.NonFinite == config.NonFiniteBad {
+		if n := envelope.ReplaceNonFinite(); n > 0 {
+			m.log.Warn("replaced non-finite values with bad quality",
+				slog.String("device_id", envelope.DeviceID),
+				slog.Int("count", n),
+			)
+		}
+	}
+
+	if err := envelope.Validate(); err != nil {
+		m.log.Error("dropping invalid envelope",
+			slog.String("id", envelope.ID),
+			slog.String("station_id", envelope.StationID),
+			slog.String("device_id", envelope.DeviceID),
+			slog.Time("timestamp", envelope.Timestamp),
+			slog.Int("values", len(envelope.Values)),
+			sl.Err(err),
+		)
+		m.events.Publish(events.LevelError, events.KindSendFailed, envelope.DeviceID, "invalid envelope: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// send forwards the envelope to the sender, waiting for a free slot when
+// the number of in-flight sends is capped. retry, when set, replaces the
+// retry policy of a sender.ReplaySender.
+func (m *Manager) send(ctx context.Context, envelope *model.Envelope, retry *sender.RetryConfig) error {
+	if m.sendSem != nil {
+		select {
+		case m.sendSem <- struct{}{}:
+			defer func() { <-m.sendSem }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	snd := m.senderFor(envelope)
+	if replayer, ok := snd.(sender.ReplaySender); ok && retry != nil {
+		return replayer.SendWithRetry(ctx, envelope, *retry)
+	}
+	return snd.Send(ctx, envelope)
 }
 
 func (m *Manager) retryBufferedData(ctx context.Context) {
@@ -162,10 +765,12 @@ func (m *Manager) retryBufferedData(ctx context.Context) {
 		return
 	}
 
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(bufferRetryInterval)
 	defer ticker.Stop()
 
 	for {
+		m.retryBeat.beat()
+
 		select {
 		case <-ctx.Done():
 			return
@@ -177,40 +782,190 @@ func (m *Manager) retryBufferedData(ctx context.Context) {
 	}
 }
 
-func (m *Manager) processBufferedData(ctx context.Context) {
+// cleanupBuffer evicts expired envelopes on a jittered schedule so collectors
+// sharing a buffer don't issue their DELETEs at the same moment.
+func (m *Manager) cleanupBuffer(ctx context.Context) {
+	defer m.wg.Done()
+
+	if !m.bufferEnabled || m.buffer == nil {
+		return
+	}
+
+	for {
+		delay := m.cfg.Buffer.CleanupInterval
+		if delay <= 0 {
+			delay = bufferRetryInterval
+		}
+		if m.cfg.Buffer.CleanupJitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(m.cfg.Buffer.CleanupJitter)))
+		}
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-m.stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+			if err := m.buffer.Cleanup(ctx, m.cfg.Buffer.MaxAge); err != nil {
+				m.log.Error("failed to cleanup old buffer data", sl.Err(err))
+			}
+		}
+	}
+}
+
+// Flush drains the buffer immediately, batch by batch, until it is empty or
+// a send fails. It returns the number of envelopes sent; stale or invalid
+// envelopes dropped on the way are not counted.
+func (m *Manager) Flush(ctx context.Context) (int, error) {
+	if !m.bufferEnabled || m.buffer == nil {
+		return 0, errors.New("buffer is disabled")
+	}
+
+	total := 0
+	for {
+		sent, dropped, fetched := m.processBufferedData(ctx)
+		total += sent
+		if fetched == 0 || sent+dropped < fetched || ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+	}
+}
+
+// Drain sends buffered data until the buffer is empty or ctx is done. Unlike
+// Flush it keeps retrying after a failed batch, pausing for the replay retry
+// delay in between. It returns the number of envelopes sent.
+func (m *Manager) Drain(ctx context.Context) (int, error) {
+	if !m.bufferEnabled || m.buffer == nil {
+		return 0, errors.New("buffer is disabled")
+	}
+
+	total := 0
+	for {
+		sent, dropped, fetched := m.processBufferedData(ctx)
+		total += sent
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+		if fetched == 0 {
+			return total, nil
+		}
+		if sent+dropped < fetched {
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(m.cfg.Sender.ReplayRetry.InitialDelay):
+			}
+		}
+	}
+}
+
+// processBufferedData sends one batch of buffered envelopes and returns how
+// many were sent, how many were dropped as stale or invalid and how many were
+// fetched. Dropped envelopes count as failed sends, as they do for live data.
+// Concurrent calls are serialized.
+func (m *Manager) processBufferedData(ctx context.Context) (sent, dropped, fetched int) {
+	m.drainMu.Lock()
+	defer m.drainMu.Unlock()
+
 	pending, err := m.buffer.GetPending(ctx, 100)
 	if err != nil {
 		m.log.Error("failed to get pending data from buffer", sl.Err(err))
-		return
+		return 0, 0, 0
 	}
 
 	if len(pending) == 0 {
-		return
+		return 0, 0, 0
 	}
 
 	m.log.Info("processing buffered data", slog.Int("count", len(pending)))
 
-	var sentIDs []string
+	retry := &sender.RetryConfig{
+		MaxAttempts:  m.cfg.Sender.ReplayRetry.MaxAttempts,
+		InitialDelay: m.cfg.Sender.ReplayRetry.InitialDelay,
+		MaxDelay:     m.cfg.Sender.ReplayRetry.MaxDelay,
+	}
+
+	now := time.Now()
+	fresh := make([]*model.Envelope, 0, len(pending))
+	var droppedIDs, droppedDevices []string
 	for _, envelope := range pending {
-		if err := m.sender.Send(ctx, envelope); err != nil {
-			m.log.Debug("failed to send buffered data",
-				slog.String("id", envelope.ID),
-				sl.Err(err),
+		if m.isStale(envelope, now) || !m.checkEnvelope(envelope) {
+			droppedIDs = append(droppedIDs, envelope.ID)
+			droppedDevices = append(droppedDevices, envelope.DeviceID)
+			continue
+		}
+		envelope.SetMeta(MetaReplay, "true")
+		fresh = append(fresh, envelope)
+	}
+
+	if len(droppedIDs) > 0 {
+		if err := m.buffer.MarkSent(ctx, droppedIDs); err != nil {
+			m.log.Error("failed to drop buffered data", sl.Err(err))
+		} else {
+			dropped = len(droppedIDs)
+			m.stats.recordDropped(droppedDevices)
+			m.log.Warn("dropped stale or invalid buffered data",
+				slog.Int("count", len(droppedIDs)),
+				slog.Duration("max_age", m.cfg.Sender.MaxAge),
 			)
-			break
 		}
-		sentIDs = append(sentIDs, envelope.ID)
+	}
+
+	var sentIDs []string
+	if m.cfg.Sender.BatchSize > 1 {
+		for _, batch := range m.batchEnvelopes(fresh, m.cfg.Sender.BatchSize, m.cfg.Sender.MaxBatchBytes) {
+			if err := m.sendBatch(ctx, batch, retry); err != nil {
+				var partial *sender.BatchError
+				if errors.As(err, &partial) {
+					for _, envelope := range partial.Sent {
+						sentIDs = append(sentIDs, envelope.ID)
+					}
+				}
+				m.log.Debug("failed to send buffered batch",
+					slog.Int("count", len(batch.envelopes)),
+					slog.Int("bytes", batch.bytes),
+					sl.Err(err),
+				)
+				m.events.Publish(events.LevelWarn, events.KindSendFailed, "", "buffered batch: "+err.Error())
+				break
+			}
+			for _, envelope := range batch.envelopes {
+				sentIDs = append(sentIDs, envelope.ID)
+			}
+		}
+	} else {
+		for _, envelope := range fresh {
+			if err := m.send(ctx, envelope, retry); err != nil {
+				m.log.Debug("failed to send buffered data",
+					slog.String("id", envelope.ID),
+					slog.String("correlation_id", envelope.CorrelationID),
+					sl.Err(err),
+				)
+				m.events.Publish(events.LevelWarn, events.KindSendFailed, envelope.DeviceID, "buffered data: "+err.Error())
+				break
+			}
+			sentIDs = append(sentIDs, envelope.ID)
+		}
 	}
 
 	if len(sentIDs) > 0 {
 		if err := m.buffer.MarkSent(ctx, sentIDs); err != nil {
 			m.log.Error("failed to mark buffered data as sent", sl.Err(err))
 		} else {
-			m.log.Info("buffered data sent successfully", slog.Int("count", len(sentIDs)))
+			sent = len(sentIDs)
+			m.stats.recordDrained(sent)
+			m.log.Info("buffered data sent successfully", slog.Int("count", sent))
 		}
 	}
 
-	if err := m.buffer.Cleanup(ctx, m.cfg.Buffer.MaxAge); err != nil {
-		m.log.Error("failed to cleanup old buffer data", sl.Err(err))
-	}
+	return sent, dropped, len(pending)
+}
+
+// isStale reports whether the envelope is older than the sender max age and
+// should be dropped instead of sent.
+func (m *Manager) isStale(envelope *model.Envelope, now time.Time) bool {
+	return m.cfg.Sender.MaxAge > 0 && now.Sub(envelope.Timestamp) > m.cfg.Sender.MaxAge
 }
@@ -0,0 +1,333 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/health"
+	"github.com/speedwagon-io/asutp/internal/model"
+	"github.com/speedwagon-io/asutp/internal/sender"
+)
+
+// memoryBuffer is an in-memory buffer.Buffer recording stored envelopes and
+// the context each Store got. pending is served until marked sent.
+type memoryBuffer struct {
+	mu        sync.Mutex
+	storeErr  error
+	stored    []*model.Envelope
+	storeCtxs []context.Context
+	pending   []*model.Envelope
+}
+
+func (b *memoryBuffer) Store(ctx context.Context, envelope *model.Envelope) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.storeCtxs = append(b.storeCtxs, ctx)
+	if b.storeErr != nil {
+		return b.storeErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.stored = append(b.stored, envelope)
+	return nil
+}
+
+func (b *memoryBuffer) GetPending(context.Context, int) ([]*model.Envelope, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*model.Envelope(nil), b.pending...), nil
+}
+
+func (b *memoryBuffer) Get(context.Context, string) (*model.Envelope, error) { return nil, nil }
+
+func (b *memoryBuffer) MarkSent(_ context.Context, ids []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = slices.DeleteFunc(b.pending, func(envelope *model.Envelope) bool {
+		return slices.Contains(ids, envelope.ID)
+	})
+	return nil
+}
+
+func (b *memoryBuffer) Cleanup(context.Context, time.Duration) error { return nil }
+
+func (b *memoryBuffer) Count(context.Context) (int64, error) { return int64(len(b.stored)), nil }
+
+func (b *memoryBuffer) OldestPendingAge(context.Context) (time.Duration, error) { return 0, nil }
+
+func (b *memoryBuffer) Probe(context.Context, *model.Envelope) error { return nil }
+
+func (b *memoryBuffer) Close() error { return nil }
+
+// cancelOnRetryServer fails every request and cancels the send context on
+// the first one, so the sender is cancelled while waiting to retry.
+func cancelOnRetryServer(t *testing.T, cancel context.CancelFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newRetryingManager(t *testing.T, url string, buf *memoryBuffer) *Manager {
+	t.Helper()
+	cfg := &config.Config{
+		Sender: config.SenderConfig{
+			URL:   url,
+			Token: "token",
+			Retry: config.RetryConfig{MaxAttempts: 5, InitialDelay: time.Hour, MaxDelay: time.Hour},
+		},
+		Buffer: config.BufferConfig{Enabled: true},
+	}
+	s := sender.NewHTTPSender(discardLogger(), &cfg.Sender, 1, nil)
+	return NewManager(discardLogger(), cfg, &config.StationConfig{StationID: "st1"}, nil, s, buf)
+}
+
+func testData() *CollectedData {
+	return &CollectedData{
+		DeviceID:   "meter1",
+		DataPoints: []model.DataPoint{{Name: "p", Value: model.FloatValue(1), Quality: model.QualityGood}},
+	}
+}
+
+func TestDeliverBuffersWhenCancelledMidRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := cancelOnRetryServer(t, cancel)
+	buf := &memoryBuffer{}
+	m := newRetryingManager(t, srv.URL, buf)
+
+	done := make(chan sendOutcome, 1)
+	go func() { done <- m.sendCollected(ctx, testData()) }()
+
+	select {
+	case outcome := <-done:
+		if outcome != sendBuffered {
+			t.Fatalf("outcome = %v, want sendBuffered", outcome)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("send did not return after cancellation")
+	}
+
+	if len(buf.stored) != 1 {
+		t.Fatalf("buffered %d envelopes, want 1", len(buf.stored))
+	}
+	storeCtx := buf.storeCtxs[0]
+	if _, ok := storeCtx.Deadline(); !ok {
+		t.Fatal("store context has no deadline")
+	}
+}
+
+func TestDeliverFailsWhenBufferFailsAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := cancelOnRetryServer(t, cancel)
+	buf := &memoryBuffer{storeErr: errors.New("disk full")}
+	m := newRetryingManager(t, srv.URL, buf)
+
+	done := make(chan sendOutcome, 1)
+	go func() { done <- m.sendCollected(ctx, testData()) }()
+
+	select {
+	case outcome := <-done:
+		if outcome != sendFailed {
+			t.Fatalf("outcome = %v, want sendFailed", outcome)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("send did not return after cancellation")
+	}
+	if len(buf.storeCtxs) != 1 {
+		t.Fatalf("store attempted %d times, want 1", len(buf.storeCtxs))
+	}
+}
+
+func TestStoreEnvelopeKeepsLiveContext(t *testing.T) {
+	buf := &memoryBuffer{}
+	m := newRetryingManager(t, "http://127.0.0.1:0", buf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	envelope := model.NewEnvelope("st1", "", "meter1", "", "", nil)
+	if err := m.storeEnvelope(ctx, envelope); err != nil {
+		t.Fatal(err)
+	}
+	if buf.storeCtxs[0] != ctx {
+		t.Fatal("store replaced a live context")
+	}
+}
+
+// gatedCollector returns a point for every device, blocking devices listed
+// in gates until their channel is closed.
+type gatedCollector struct {
+	gates map[string]chan struct{}
+}
+
+func (c *gatedCollector) Collect(ctx context.Context, device *config.DeviceConfig) (*CollectedData, error) {
+	if gate, ok := c.gates[device.ID]; ok {
+		select {
+		case <-gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return &CollectedData{
+		DeviceID:   device.ID,
+		DataPoints: []model.DataPoint{{Name: "p", Value: model.FloatValue(1), Quality: model.QualityGood}},
+	}, nil
+}
+
+func (c *gatedCollector) Name() string { return "gated" }
+
+func (c *gatedCollector) Close() error { return nil }
+
+// notifySender reports the device of every envelope it sends.
+type notifySender struct {
+	sent chan string
+}
+
+func (s *notifySender) Send(_ context.Context, envelope *model.Envelope) error {
+	s.sent <- envelope.DeviceID
+	return nil
+}
+
+func (s *notifySender) SendBatch(ctx context.Context, envelopes []*model.Envelope) error {
+	for _, envelope := range envelopes {
+		s.Send(ctx, envelope)
+	}
+	return nil
+}
+
+func (s *notifySender) Health(context.Context) error { return nil }
+
+func TestPriorityLevelSentBeforeSlowerLevelCollected(t *testing.T) {
+	gate := make(chan struct{})
+	coll := &gatedCollector{gates: map[string]chan struct{}{"slow": gate}}
+	s := &notifySender{sent: make(chan string, 2)}
+	stationCfg := &config.StationConfig{
+		StationID: "st1",
+		Polling:   config.PollingConfig{Timeout: time.Minute},
+		Devices: []config.DeviceConfig{
+			{ID: "slow"},
+			{ID: "fast", Priority: 10},
+		},
+	}
+	m := NewManager(discardLogger(), &config.Config{}, stationCfg, coll, s, nil)
+
+	done := make(chan struct{})
+	go func() {
+		m.collectAndSend(context.Background())
+		close(done)
+	}()
+
+	select {
+	case id := <-s.sent:
+		if id != "fast" {
+			t.Fatalf("first send was %q, want fast", id)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("high priority level was held back by a slower device")
+	}
+
+	close(gate)
+	<-done
+	if id := <-s.sent; id != "slow" {
+		t.Fatalf("second send was %q, want slow", id)
+	}
+}
+
+func TestFlushCountsDroppedEnvelopesAsFailed(t *testing.T) {
+	points := testData().DataPoints
+	stale := model.NewEnvelope("st1", "", "old", "", "", points, model.WithTimestamp(time.Now().Add(-2*time.Hour)))
+	fresh := model.NewEnvelope("st1", "", "new", "", "", points)
+	buf := &memoryBuffer{pending: []*model.Envelope{stale, fresh}}
+	s := &notifySender{sent: make(chan string, 2)}
+	cfg := &config.Config{
+		Sender: config.SenderConfig{MaxAge: time.Hour},
+		Buffer: config.BufferConfig{Enabled: true},
+	}
+	m := NewManager(discardLogger(), cfg, &config.StationConfig{StationID: "st1"}, nil, s, buf)
+
+	sent, err := m.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if sent != 1 {
+		t.Errorf("Flush sent %d envelopes, want 1", sent)
+	}
+	if len(buf.pending) != 0 {
+		t.Errorf("%d envelopes left pending, want 0", len(buf.pending))
+	}
+	if drained := m.DrainStats().Drained; drained != 1 {
+		t.Errorf("drained %d envelopes, want 1", drained)
+	}
+	if failed := m.DeviceStats()["old"].Failed; failed != 1 {
+		t.Errorf("stale device failed %d sends, want 1", failed)
+	}
+}
+
+func TestWatchdogStallFailsReadiness(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	server := health.NewServer(discardLogger(), &config.HealthConfig{Address: address})
+	readiness := health.NewReadiness(nil)
+	server.SetReadiness(readiness)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop(context.Background())
+
+	readyStatus := func() int {
+		resp, err := http.Get("http://" + address + "/ready")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	cfg := &config.Config{Watchdog: config.WatchdogConfig{Enabled: true, Threshold: time.Millisecond, Action: WatchdogReset}}
+	stationCfg := &config.StationConfig{
+		StationID: "st1",
+		Polling:   config.PollingConfig{Timeout: time.Minute},
+		Devices:   []config.DeviceConfig{{ID: "meter1"}},
+	}
+	m := NewManager(discardLogger(), cfg, stationCfg, &gatedCollector{}, &notifySender{sent: make(chan string, 1)}, nil)
+	m.SetReadiness(readiness)
+
+	// Nothing has been collected yet, so the first watchdog tick is a stall.
+	ctx, cancel := context.WithCancel(context.Background())
+	m.wg.Add(1)
+	go m.runWatchdog(ctx)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for readyStatus() != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("/ready stayed ready through a watchdog stall")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	cancel()
+	m.wg.Wait()
+
+	m.collectAndSend(context.Background())
+	if status := readyStatus(); status != http.StatusOK {
+		t.Fatalf("/ready = %d after a successful collect, want 200", status)
+	}
+}
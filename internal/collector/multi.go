@@ -0,0 +1,173 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// MultiCollector collects a device from several connections, one per
+// distinct FieldConfig.Connection, and merges the results into one
+// CollectedData. Fields of a failed connection become bad-quality points so
+// the other connections' data is kept.
+type MultiCollector struct {
+	log     *slog.Logger
+	primary Collector
+	named   map[string]Collector
+}
+
+func NewMultiCollector(log *slog.Logger, primary Collector, named map[string]Collector) *MultiCollector {
+	return &MultiCollector{
+		log:     log,
+		primary: primary,
+		named:   named,
+	}
+}
+
+func (c *MultiCollector) Name() string {
+	return "multi"
+}
+
+func (c *MultiCollector) Close() error {
+	errs := []error{c.primary.Close()}
+	for _, coll := range c.named {
+		errs = append(errs, coll.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (c *MultiCollector) Collect(ctx context.Context, device *config.DeviceConfig) (*CollectedData, error) {
+	parts, order := c.split(device)
+	if len(parts) == 1 && order[0] == "" {
+		return c.primary.Collect(ctx, device)
+	}
+
+	type result struct {
+		data *CollectedData
+		err  error
+	}
+	results := make(map[string]result, len(parts))
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, part := range parts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := c.collectorFor(name).Collect(ctx, part)
+			mu.Lock()
+			results[name] = result{data: data, err: err}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	merged := &CollectedData{
+		DeviceID:    device.ID,
+		DeviceName:  device.Name,
+		DeviceGroup: device.Group,
+		DataPoints:  NewDataPoints(len(device.Fields)),
+	}
+
+	var errs []error
+	for _, name := range order {
+		r := results[name]
+		if r.err != nil {
+			c.log.Error("failed to collect from connection",
+				slog.String("device_id", device.ID),
+				slog.String("connection", name),
+				sl.Err(r.err),
+			)
+			errs = append(errs, fmt.Errorf("connection %q: %w", name, r.err))
+			for _, field := range parts[name].Fields {
+				merged.DataPoints = append(merged.DataPoints, model.DataPoint{
+					Name:          field.Target,
+					Unit:          field.Unit,
+					Quality:       model.QualityBad,
+					QualityReason: model.ReasonCollectError,
+				})
+			}
+			continue
+		}
+
+		merged.DataPoints = append(merged.DataPoints, r.data.DataPoints...)
+		ReleaseDataPoints(r.data.DataPoints)
+		for k, v := range r.data.Metadata {
+			if merged.Metadata == nil {
+				merged.Metadata = make(map[string]string)
+			}
+			merged.Metadata[k] = v
+		}
+	}
+
+	if len(errs) == len(parts) {
+		return nil, errors.Join(errs...)
+	}
+
+	return merged, nil
+}
+
+// CollectRange backfills through the collector of the device's connection.
+// Devices whose fields span several connections are not supported.
+func (c *MultiCollector) CollectRange(ctx context.Context, device *config.DeviceConfig, from, to time.Time) ([]*CollectedData, error) {
+	parts, order := c.split(device)
+	if len(parts) != 1 {
+		return nil, ErrRangeUnsupported
+	}
+	rc, ok := c.collectorFor(order[0]).(RangeCollector)
+	if !ok {
+		return nil, ErrRangeUnsupported
+	}
+	return rc.CollectRange(ctx, parts[order[0]], from, to)
+}
+
+// split groups the device fields by connection, deriving a device config
+// per connection with that connection's endpoint. order lists connections in
+// order of first appearance.
+func (c *MultiCollector) split(device *config.DeviceConfig) (map[string]*config.DeviceConfig, []string) {
+	parts := make(map[string]*config.DeviceConfig)
+	var order []string
+
+	for _, field := range device.Fields {
+		part, ok := parts[field.Connection]
+		if !ok {
+			d := *device
+			d.Fields = nil
+			if field.Connection != "" {
+				if src, ok := device.Sources[field.Connection]; ok {
+					d.Endpoint = src.Endpoint
+					d.RequestParam = src.RequestParam
+				}
+				// Metadata is taken from the primary connection only.
+				d.MetadataFields = nil
+			}
+			part = &d
+			parts[field.Connection] = part
+			order = append(order, field.Connection)
+		}
+		part.Fields = append(part.Fields, field)
+	}
+
+	if len(parts) == 0 {
+		parts[""] = device
+		order = append(order, "")
+	}
+
+	return parts, order
+}
+
+func (c *MultiCollector) collectorFor(name string) Collector {
+	if coll, ok := c.named[name]; ok {
+		return coll
+	}
+	return c.primary
+}
@@ -0,0 +1,36 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// maxPooledPoints keeps unusually large slices out of the pool so one huge
+// response does not pin its memory for the life of the process.
+const maxPooledPoints = 16384
+
+var dataPointPool sync.Pool
+
+// NewDataPoints returns an empty slice with room for at least n points,
+// reusing a released slice when one is large enough.
+func NewDataPoints(n int) []model.DataPoint {
+	if p, ok := dataPointPool.Get().(*[]model.DataPoint); ok {
+		if cap(*p) >= n {
+			return (*p)[:0]
+		}
+		dataPointPool.Put(p)
+	}
+	return make([]model.DataPoint, 0, n)
+}
+
+// ReleaseDataPoints hands a slice back for reuse. The caller must not touch
+// the slice, or anything sharing its backing array, afterwards.
+func ReleaseDataPoints(points []model.DataPoint) {
+	if cap(points) == 0 || cap(points) > maxPooledPoints {
+		return
+	}
+	clear(points[:cap(points)])
+	points = points[:0]
+	dataPointPool.Put(&points)
+}
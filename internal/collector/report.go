@@ -0,0 +1,175 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/lib/rolling"
+)
+
+// DeviceTotals are the session counters of a single device.
+type DeviceTotals struct {
+	Collected int64 `json:"collected"`
+	Sent      int64 `json:"sent"`
+	Buffered  int64 `json:"buffered"`
+	Failed    int64 `json:"failed"`
+}
+
+// sessionStats accumulates counters for the shutdown report.
+type sessionStats struct {
+	mu        sync.Mutex
+	started   time.Time
+	collected int64
+	sent      int64
+	buffered  int64
+	failed    int64
+	drained   int64
+	drainRate *rolling.Window
+	devices   map[string]*DeviceTotals
+}
+
+func newSessionStats() *sessionStats {
+	return &sessionStats{
+		started:   time.Now(),
+		drainRate: rolling.NewWindow(time.Minute),
+		devices:   make(map[string]*DeviceTotals),
+	}
+}
+
+func (s *sessionStats) record(deviceID string, outcome sendOutcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.devices[deviceID]
+	if !ok {
+		d = &DeviceTotals{}
+		s.devices[deviceID] = d
+	}
+
+	s.collected++
+	d.Collected++
+
+	switch outcome {
+	case sendOK:
+		s.sent++
+		d.Sent++
+	case sendBuffered:
+		s.buffered++
+		d.Buffered++
+	case sendFailed:
+		s.failed++
+		d.Failed++
+	}
+}
+
+// recordDropped counts buffered envelopes dropped instead of replayed as
+// failed sends of their devices.
+func (s *sessionStats) recordDropped(deviceIDs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, deviceID := range deviceIDs {
+		d, ok := s.devices[deviceID]
+		if !ok {
+			d = &DeviceTotals{}
+			s.devices[deviceID] = d
+		}
+		s.failed++
+		d.Failed++
+	}
+}
+
+// DeviceStats returns a snapshot of the per-device session counters.
+func (m *Manager) DeviceStats() map[string]DeviceTotals {
+	s := m.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]DeviceTotals, len(s.devices))
+	for id, d := range s.devices {
+		out[id] = *d
+	}
+	return out
+}
+
+func (s *sessionStats) recordDrained(n int) {
+	s.drainRate.Add(int64(n))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drained += int64(n)
+}
+
+// DrainStats reports how fast the buffer backlog is being sent.
+type DrainStats struct {
+	Window      string  `json:"window"`
+	Drained     int64   `json:"drained"`
+	DrainPerSec float64 `json:"drain_per_sec"`
+}
+
+// DrainStats returns the session drain total and the rolling drain rate.
+func (m *Manager) DrainStats() DrainStats {
+	s := m.stats
+	s.mu.Lock()
+	drained := s.drained
+	s.mu.Unlock()
+
+	return DrainStats{
+		Window:      s.drainRate.Span().String(),
+		Drained:     drained,
+		DrainPerSec: s.drainRate.Rate(),
+	}
+}
+
+// logShutdownReport emits the session summary, including how many envelopes
+// are still pending in the buffer.
+func (m *Manager) logShutdownReport() {
+	s := m.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := int64(-1)
+	if m.buffer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		n, err := m.buffer.Count(ctx)
+		if err != nil {
+			m.log.Error("failed to count pending buffer entries", sl.Err(err))
+		} else {
+			pending = n
+		}
+	}
+
+	ids := make([]string, 0, len(s.devices))
+	for id := range s.devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	devices := make([]any, 0, len(ids))
+	for _, id := range ids {
+		d := s.devices[id]
+		devices = append(devices, slog.Group(id,
+			slog.Int64("collected", d.Collected),
+			slog.Int64("sent", d.Sent),
+			slog.Int64("buffered", d.Buffered),
+			slog.Int64("failed", d.Failed),
+		))
+	}
+
+	m.log.Info("shutdown report",
+		slog.String("station_id", m.stationCfg.StationID),
+		slog.Duration("uptime", time.Since(s.started)),
+		slog.Int64("envelopes_collected", s.collected),
+		slog.Int64("envelopes_sent", s.sent),
+		slog.Int64("envelopes_buffered", s.buffered),
+		slog.Int64("envelopes_failed", s.failed),
+		slog.Int64("buffer_drained", s.drained),
+		slog.Int64("buffer_pending", pending),
+		slog.Group("devices", devices...),
+	)
+}
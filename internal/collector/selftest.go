@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/model"
+	"github.com/speedwagon-io/asutp/internal/version"
+)
+
+// SelfTestDevice is the per-device result of a self-test.
+type SelfTestDevice struct {
+	DeviceID       string `json:"device_id"`
+	CollectOK      bool   `json:"collect_ok"`
+	CollectLatency string `json:"collect_latency"`
+	Points         int    `json:"points"`
+	SendOK         bool   `json:"send_ok"`
+	SendLatency    string `json:"send_latency,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// SelfTestReport is the result of a full pipeline self-test.
+type SelfTestReport struct {
+	OK          bool             `json:"ok"`
+	Devices     []SelfTestDevice `json:"devices"`
+	BufferOK    *bool            `json:"buffer_ok,omitempty"`
+	BufferError string           `json:"buffer_error,omitempty"`
+}
+
+// SelfTest collects each requested device once (all when deviceIDs is empty),
+// sends the result as test-marked envelopes and, if checkBuffer is set,
+// stores and re-reads one envelope through the buffer. Failed sends are not
+// buffered.
+func (m *Manager) SelfTest(ctx context.Context, deviceIDs []string, checkBuffer bool) (*SelfTestReport, error) {
+	wanted := make(map[string]bool, len(deviceIDs))
+	for _, id := range deviceIDs {
+		wanted[id] = true
+	}
+	for id := range wanted {
+		if !m.hasDevice(id) {
+			return nil, fmt.Errorf("device not found: %s", id)
+		}
+	}
+
+	report := &SelfTestReport{OK: true, Devices: make([]SelfTestDevice, 0)}
+	var sample *model.Envelope
+
+	for i := range m.stationCfg.Devices {
+		device := &m.stationCfg.Devices[i]
+		if len(wanted) > 0 && !wanted[device.ID] {
+			continue
+		}
+
+		result := SelfTestDevice{DeviceID: device.ID}
+
+		collectCtx, cancel := context.WithTimeout(ctx, m.stationCfg.Polling.Timeout)
+		started := time.Now()
+		data, err := m.collector.Collect(collectCtx, device)
+		cancel()
+		result.CollectLatency = time.Since(started).Round(time.Millisecond).String()
+
+		if err != nil {
+			result.Error = err.Error()
+			report.OK = false
+			report.Devices = append(report.Devices, result)
+			continue
+		}
+		prefixFields(data, device)
+		result.CollectOK = true
+		result.Points = len(data.DataPoints)
+
+		envelope := m.testEnvelope(data)
+		if sample == nil {
+			sample = envelope
+		}
+
+		started = time.Now()
+		err = m.send(ctx, envelope, nil)
+		result.SendLatency = time.Since(started).Round(time.Millisecond).String()
+		if err != nil {
+			result.Error = err.Error()
+			report.OK = false
+		} else {
+			result.SendOK = true
+		}
+
+		report.Devices = append(report.Devices, result)
+	}
+
+	if checkBuffer {
+		ok := true
+		if err := m.selfTestBuffer(ctx, sample); err != nil {
+			ok = false
+			report.OK = false
+			report.BufferError = err.Error()
+		}
+		report.BufferOK = &ok
+	}
+
+	return report, nil
+}
+
+func (m *Manager) hasDevice(id string) bool {
+	for _, device := range m.stationCfg.Devices {
+		if device.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) testEnvelope(data *CollectedData) *model.Envelope {
+	envelope := model.NewEnvelope(
+		m.stationCfg.StationID,
+		m.stationCfg.StationName,
+		data.DeviceID,
+		data.DeviceName,
+		data.DeviceGroup,
+		data.DataPoints,
+		model.WithTimestampPrecision(m.cfg.Envelope.TimestampPrecision),
+		model.WithMetadata(data.Metadata),
+		model.WithMeta(m.envelopeMeta),
+		model.WithTest(),
+	)
+	if m.cfg.Envelope.IncludeCollectorVersion {
+		envelope.CollectorVersion = version.Version
+	}
+	return envelope
+}
+
+// selfTestBuffer stores a copy of sample in the buffer and reads it back in
+// a transaction that is rolled back, so the probe never becomes pending.
+func (m *Manager) selfTestBuffer(ctx context.Context, sample *model.Envelope) error {
+	if !m.bufferEnabled || m.buffer == nil {
+		return errors.New("buffer is disabled")
+	}
+	if sample == nil {
+		return errors.New("no envelope collected to buffer")
+	}
+
+	probe := *sample
+	probe.ID = "selftest-" + sample.ID
+	return m.buffer.Probe(ctx, &probe)
+}
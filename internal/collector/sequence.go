@@ -0,0 +1,29 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// SequenceStore hands out per-device sequence numbers that survive restarts.
+type SequenceStore interface {
+	NextSequence(ctx context.Context, deviceID string) (uint64, error)
+}
+
+// memorySequences numbers envelopes when no persistent store is available,
+// e.g. with the buffer disabled. Numbering restarts at 1 on restart.
+type memorySequences struct {
+	mu   sync.Mutex
+	last map[string]uint64
+}
+
+func newMemorySequences() *memorySequences {
+	return &memorySequences{last: make(map[string]uint64)}
+}
+
+func (s *memorySequences) NextSequence(_ context.Context, deviceID string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last[deviceID]++
+	return s.last[deviceID], nil
+}
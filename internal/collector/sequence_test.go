@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestMemorySequencesConcurrent(t *testing.T) {
+	s := newMemorySequences()
+	ctx := context.Background()
+
+	const workers, perWorker = 8, 100
+	var wg sync.WaitGroup
+	results := make(chan uint64, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				seq, _ := s.NextSequence(ctx, "meter1")
+				results <- seq
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	seen := make(map[uint64]bool)
+	for seq := range results {
+		if seen[seq] {
+			t.Fatalf("sequence %d assigned twice", seq)
+		}
+		seen[seq] = true
+	}
+	if len(seen) != workers*perWorker {
+		t.Fatalf("got %d distinct sequences, want %d", len(seen), workers*perWorker)
+	}
+}
+
+type failingSequences struct{}
+
+func (failingSequences) NextSequence(context.Context, string) (uint64, error) {
+	return 0, errors.New("database is locked")
+}
+
+func TestNewEnvelopeFailsWithoutSequence(t *testing.T) {
+	m := NewManager(discardLogger(), &config.Config{}, &config.StationConfig{StationID: "st1"}, nil, nil, nil)
+	m.SetSequenceStore(failingSequences{})
+
+	data := &CollectedData{DeviceID: "meter1"}
+	envelope, err := m.PreviewEnvelope(context.Background(), data)
+	if err == nil {
+		t.Fatalf("PreviewEnvelope = %+v, want error", envelope)
+	}
+	if outcome := m.sendCollected(context.Background(), data); outcome != sendFailed {
+		t.Fatalf("sendCollected = %v, want sendFailed", outcome)
+	}
+}
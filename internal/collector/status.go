@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// qualityRank orders qualities from best to worst for the station status.
+var qualityRank = map[string]int{
+	model.QualityGood:      0,
+	model.QualityUncertain: 1,
+	model.QualityUnknown:   2,
+	model.QualityBad:       3,
+}
+
+// stationStatus aggregates the per-device results of one cycle into the
+// synthetic station status reading (see config.StatusConfig).
+type stationStatus struct {
+	mu      sync.Mutex
+	faulted map[string]struct{}
+	worst   string
+}
+
+func newStationStatus() *stationStatus {
+	return &stationStatus{faulted: make(map[string]struct{}), worst: model.QualityGood}
+}
+
+// fail records a device whose collection failed.
+func (s *stationStatus) fail(deviceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faulted[deviceID] = struct{}{}
+	s.worst = model.QualityBad
+}
+
+// observe records the points of a collected device. With a maxAge, stale
+// data counts as the send path will treat it: a reading older than maxAge is
+// dropped, so the device counts as faulted, and points more than maxAge older
+// than their reading count as bad.
+func (s *stationStatus) observe(data *CollectedData, maxAge time.Duration, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timestamp := data.Timestamp
+	if timestamp.IsZero() {
+		timestamp = now
+	}
+	if maxAge > 0 && now.Sub(timestamp) > maxAge {
+		s.faulted[data.DeviceID] = struct{}{}
+		s.worst = model.QualityBad
+		return
+	}
+
+	allBad := len(data.DataPoints) > 0
+	for _, dp := range data.DataPoints {
+		quality := dp.Quality
+		if maxAge > 0 && !dp.Timestamp.IsZero() && timestamp.Sub(dp.Timestamp) > maxAge {
+			quality = model.QualityBad
+		}
+		if quality != model.QualityBad {
+			allBad = false
+		}
+		if qualityRank[quality] > qualityRank[s.worst] {
+			s.worst = quality
+		}
+	}
+	if allBad {
+		s.faulted[data.DeviceID] = struct{}{}
+	}
+}
+
+// statusData builds the station status reading, or nil when it is disabled.
+func (m *Manager) statusData(s *stationStatus, correlationID string) *CollectedData {
+	cfg := m.cfg.Status
+	if !cfg.Enabled {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	points := []model.DataPoint{
+		{
+			Name:    cfg.AnyFaultedField,
+			Value:   model.BoolValue(len(s.faulted) > 0),
+			Quality: model.QualityGood,
+		},
+		{
+			Name:    cfg.FaultedField,
+			Value:   model.IntValue(int64(len(s.faulted))),
+			Quality: model.QualityGood,
+		},
+		{
+			Name:    cfg.WorstQualityField,
+			Value:   model.StringValue(s.worst),
+			Quality: model.QualityGood,
+		},
+	}
+
+	return &CollectedData{
+		DeviceID:      cfg.DeviceID,
+		DeviceName:    m.stationCfg.StationName,
+		DataPoints:    points,
+		CorrelationID: correlationID,
+	}
+}
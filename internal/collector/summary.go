@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+type sendOutcome int
+
+const (
+	sendOK sendOutcome = iota
+	sendBuffered
+	sendFailed
+)
+
+// cycleSummary aggregates the outcome of one collectAndSend cycle.
+type cycleSummary struct {
+	started    time.Time
+	attempted  atomic.Int64
+	succeeded  atomic.Int64
+	empty      atomic.Int64
+	failed     atomic.Int64
+	throttled  atomic.Int64
+	datapoints atomic.Int64
+	sendsOK    atomic.Int64
+	sendsFail  atomic.Int64
+	buffered   atomic.Int64
+}
+
+func newCycleSummary() *cycleSummary {
+	return &cycleSummary{started: time.Now()}
+}
+
+func (s *cycleSummary) recordSend(outcome sendOutcome) {
+	switch outcome {
+	case sendOK:
+		s.sendsOK.Add(1)
+	case sendBuffered:
+		s.sendsFail.Add(1)
+		s.buffered.Add(1)
+	case sendFailed:
+		s.sendsFail.Add(1)
+	}
+}
+
+// CycleResult reports the outcome of a single collection cycle. Envelopes
+// counts whole sends, so a reading split into parts counts once.
+type CycleResult struct {
+	DevicesOK         int64 `json:"devices_ok"`
+	DevicesFailed     int64 `json:"devices_failed"`
+	EnvelopesSent     int64 `json:"envelopes_sent"`
+	EnvelopesBuffered int64 `json:"envelopes_buffered"`
+	EnvelopesFailed   int64 `json:"envelopes_failed"`
+}
+
+func (s *cycleSummary) result() CycleResult {
+	return CycleResult{
+		DevicesOK:         s.succeeded.Load(),
+		DevicesFailed:     s.failed.Load(),
+		EnvelopesSent:     s.sendsOK.Load(),
+		EnvelopesBuffered: s.buffered.Load(),
+		EnvelopesFailed:   s.sendsFail.Load() - s.buffered.Load(),
+	}
+}
+
+func (s *cycleSummary) log(log *slog.Logger, stationID string) {
+	log.Info("collection cycle completed",
+		slog.String("station_id", stationID),
+		slog.Int64("devices_attempted", s.attempted.Load()),
+		slog.Int64("devices_succeeded", s.succeeded.Load()),
+		slog.Int64("devices_empty", s.empty.Load()),
+		slog.Int64("devices_failed", s.failed.Load()),
+		slog.Int64("devices_throttled", s.throttled.Load()),
+		slog.Int64("datapoints", s.datapoints.Load()),
+		slog.Int64("sends_ok", s.sendsOK.Load()),
+		slog.Int64("sends_failed", s.sendsFail.Load()),
+		slog.Int64("sends_buffered", s.buffered.Load()),
+		slog.Duration("duration", time.Since(s.started)),
+	)
+}
+
+// CollectRatio returns how many devices were collected successfully out of
+// those attempted in the last completed cycle.
+func (m *Manager) CollectRatio() (succeeded, attempted int64) {
+	summary := m.lastCycle.Load()
+	if summary == nil {
+		return 0, 0
+	}
+	return summary.succeeded.Load(), summary.attempted.Load()
+}
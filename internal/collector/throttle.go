@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// sendThrottle enforces a minimum interval between sends per device.
+// Readings that arrive inside the window are coalesced, keeping only the
+// latest, and released once the window has elapsed.
+type sendThrottle struct {
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+	held     map[string]heldReading
+}
+
+type heldReading struct {
+	data     *CollectedData
+	interval time.Duration
+}
+
+func newSendThrottle() *sendThrottle {
+	return &sendThrottle{
+		lastSent: make(map[string]time.Time),
+		held:     make(map[string]heldReading),
+	}
+}
+
+// admit reports whether data may be sent now. If not, it replaces any
+// reading already held for the device.
+func (t *sendThrottle) admit(data *CollectedData, interval time.Duration, now time.Time) bool {
+	if interval <= 0 {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.lastSent[data.DeviceID]; ok && now.Sub(last) < interval {
+		t.held[data.DeviceID] = heldReading{data: data, interval: interval}
+		return false
+	}
+
+	t.lastSent[data.DeviceID] = now
+	delete(t.held, data.DeviceID)
+	return true
+}
+
+// due returns held readings whose window has elapsed and marks them as sent.
+func (t *sendThrottle) due(now time.Time) []*CollectedData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ready []*CollectedData
+	for id, h := range t.held {
+		if now.Sub(t.lastSent[id]) >= h.interval {
+			ready = append(ready, h.data)
+			t.lastSent[id] = now
+			delete(t.held, id)
+		}
+	}
+	return ready
+}
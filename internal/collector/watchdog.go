@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/events"
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+)
+
+const (
+	WatchdogExit  = "exit"
+	WatchdogReset = "reset"
+)
+
+// watchdog tracks successful collections and how often it had to intervene.
+// stalled is set from a detected stall until the next successful collect.
+type watchdog struct {
+	lastSuccess heartbeat
+	resets      atomic.Int64
+	stalled     atomic.Bool
+}
+
+// WatchdogStatus describes the collection watchdog for health reporting.
+type WatchdogStatus struct {
+	LastSuccess time.Time
+	Threshold   time.Duration
+	Resets      int64
+}
+
+func (m *Manager) watchdogThreshold() time.Duration {
+	if m.cfg.Watchdog.Threshold > 0 {
+		return m.cfg.Watchdog.Threshold
+	}
+	return 5 * m.stationCfg.Polling.Interval
+}
+
+// WatchdogStatus returns the time of the last successful collection and the
+// watchdog threshold.
+func (m *Manager) WatchdogStatus() WatchdogStatus {
+	return WatchdogStatus{
+		LastSuccess: m.watchdog.lastSuccess.time(),
+		Threshold:   m.watchdogThreshold(),
+		Resets:      m.watchdog.resets.Load(),
+	}
+}
+
+// collectSucceeded records a successful collect for the watchdog, clearing a
+// stall reported to readiness.
+func (m *Manager) collectSucceeded() {
+	m.watchdog.lastSuccess.beat()
+	if m.watchdog.stalled.CompareAndSwap(true, false) && m.readiness != nil {
+		m.readiness.SetStalled(false)
+	}
+}
+
+// runWatchdog acts when no device has been collected successfully for longer
+// than the threshold: it marks the service not ready, then either exits the
+// process for a supervisor to restart, or cancels the running cycle and
+// resets the collector.
+func (m *Manager) runWatchdog(ctx context.Context) {
+	defer m.wg.Done()
+
+	threshold := m.watchdogThreshold()
+	ticker := time.NewTicker(max(threshold/4, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		age := time.Since(m.watchdog.lastSuccess.time())
+		if age <= threshold {
+			continue
+		}
+
+		m.watchdog.stalled.Store(true)
+		if m.readiness != nil {
+			m.readiness.SetStalled(true)
+		}
+
+		msg := fmt.Sprintf("no successful collection for %s", age.Round(time.Second))
+		m.events.Publish(events.LevelError, events.KindWatchdog, "", msg)
+
+		if m.cfg.Watchdog.Action == WatchdogExit {
+			m.log.Error("watchdog: collection stuck, exiting", slog.Duration("since_success", age))
+			os.Exit(1)
+		}
+
+		m.log.Error("watchdog: collection stuck, resetting collector", slog.Duration("since_success", age))
+
+		// Cancel the running cycle first, so collects blocked on the source
+		// return and release the adapter before it is closed. The cycle
+		// stays marked running until its goroutine exits, so a new cycle
+		// never overlaps a stuck one.
+		m.cycleMu.Lock()
+		if m.cancelCycle != nil {
+			m.cancelCycle()
+		}
+		m.cycleQueued = false
+		m.cycleMu.Unlock()
+
+		if err := m.collector.Close(); err != nil {
+			m.log.Error("watchdog: failed to reset collector", sl.Err(err))
+		}
+
+		m.watchdog.resets.Add(1)
+		m.watchdog.lastSuccess.beat()
+	}
+}
@@ -1,33 +1,188 @@
 package config
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/speedwagon-io/asutp/internal/lib/redirect"
+	"github.com/speedwagon-io/asutp/internal/model"
 )
 
 type Config struct {
-	Env     string       `yaml:"env" env-default:"prod"`
-	Station StationRef   `yaml:"station"`
-	Sender  SenderConfig `yaml:"sender"`
-	Buffer  BufferConfig `yaml:"buffer"`
-	Health  HealthConfig `yaml:"health"`
-	Log     LogConfig    `yaml:"log"`
+	Env      string         `yaml:"env" env-default:"prod"`
+	Station  StationRef     `yaml:"station"`
+	Sender   SenderConfig   `yaml:"sender"`
+	Buffer   BufferConfig   `yaml:"buffer"`
+	Health   HealthConfig   `yaml:"health"`
+	Log      LogConfig      `yaml:"log"`
+	Envelope EnvelopeConfig `yaml:"envelope"`
+	Watchdog WatchdogConfig `yaml:"watchdog"`
+	Backfill BackfillConfig `yaml:"backfill"`
+	Status   StatusConfig   `yaml:"station_status"`
+
+	// Path is the config path as given: a file, a directory or a
+	// comma-separated list. Paths are the files merged from it, in order.
+	Path  string   `yaml:"-"`
+	Paths []string `yaml:"-"`
+}
+
+// WatchdogConfig acts when no device has been collected successfully for
+// Threshold (0 means five polling intervals). Action "exit" terminates the
+// process for a supervisor to restart; "reset" resets the collector.
+type WatchdogConfig struct {
+	Enabled   bool          `yaml:"enabled" env-default:"false"`
+	Threshold time.Duration `yaml:"threshold" env-default:"0s"`
+	Action    string        `yaml:"action" env-default:"exit"`
+}
+
+// BackfillConfig fills gaps in a device's data from its historical log when
+// the adapter supports time-range queries. A gap is detected when data
+// delivered or buffered for a device is more than MinGap newer than the
+// previous delivery; the missing range is requested in chunks of at most
+// MaxRange.
+type BackfillConfig struct {
+	Enabled  bool          `yaml:"enabled" env-default:"false"`
+	MinGap   time.Duration `yaml:"min_gap" env-default:"5m"`
+	MaxRange time.Duration `yaml:"max_range" env-default:"1h"`
 }
 
+// StatusConfig emits a synthetic station status reading after every cycle,
+// sent as an envelope of device DeviceID. A device counts as faulted when its
+// collection failed, all its points are bad or stale, or its reading is too
+// old to send (see SenderConfig.MaxAge). AnyFaultedField (bool),
+// FaultedField (count of faulted devices) and WorstQualityField (worst point
+// quality across devices, failed ones counting as bad) name the data points.
+type StatusConfig struct {
+	Enabled           bool   `yaml:"enabled" env-default:"false"`
+	DeviceID          string `yaml:"device_id" env-default:"station"`
+	AnyFaultedField   string `yaml:"any_faulted_field" env-default:"any_faulted"`
+	FaultedField      string `yaml:"faulted_field" env-default:"devices_faulted"`
+	WorstQualityField string `yaml:"worst_quality_field" env-default:"worst_quality"`
+}
+
+// StationRef identifies the station. EmptyDevices decides what happens when
+// the station config lists no devices: "warn" logs and keeps running, "fail"
+// exits at startup.
 type StationRef struct {
-	ID         string `yaml:"id" env-required:"true"`
-	Name       string `yaml:"name" env-required:"true"`
-	DBID       int    `yaml:"db_id" env-required:"true"`
-	ConfigPath string `yaml:"config_path" env-required:"true"`
+	ID           string `yaml:"id" env-required:"true"`
+	Name         string `yaml:"name" env-required:"true"`
+	DBID         int    `yaml:"db_id" env-required:"true"`
+	ConfigPath   string `yaml:"config_path" env-required:"true"`
+	EmptyDevices string `yaml:"empty_devices" env-default:"warn"`
 }
 
+// SenderConfig configures delivery.
 type SenderConfig struct {
-	URL     string        `yaml:"url" env-required:"true"`
-	Token   string        `yaml:"token" env:"SENDER_TOKEN" env-required:"true"`
-	Timeout time.Duration `yaml:"timeout" env-default:"30s"`
-	Retry   RetryConfig   `yaml:"retry"`
+	// Type selects the sender: "http", "kafka", "influx" or "s3".
+	Type string `yaml:"type" env-default:"http"`
+	URL  string `yaml:"url"`
+	// GroupURLs routes a device group to its own URL; other groups use URL.
+	GroupURLs map[string]string `yaml:"group_urls"`
+	// Groups gives a device group its own http sender, with Token as the
+	// fallback token.
+	Groups  map[string]GroupSenderConfig `yaml:"groups"`
+	Token   string                       `yaml:"token" env:"SENDER_TOKEN"`
+	Timeout time.Duration                `yaml:"timeout" env-default:"30s"`
+	// Retry applies to live sends.
+	Retry RetryConfig `yaml:"retry"`
+	TLS   TLSConfig   `yaml:"tls"`
+	// MaxConcurrent caps in-flight sends; 0, the default, means unlimited.
+	MaxConcurrent int         `yaml:"max_concurrent" env-default:"0"`
+	Kafka         KafkaConfig `yaml:"kafka"`
+	// HealthURL is probed instead of the ingest URL when set.
+	HealthURL string `yaml:"health_url"`
+	// HealthCacheTTL is how long a probe result is reused.
+	HealthCacheTTL time.Duration `yaml:"health_cache_ttl" env-default:"15s"`
+	// MaxAge drops envelopes older than it at send and drain time; 0 keeps
+	// everything.
+	MaxAge time.Duration `yaml:"max_age" env-default:"0s"`
+	// TokenFile supplies the token instead of Token.
+	TokenFile string `yaml:"token_file" env:"SENDER_TOKEN_FILE"`
+	// RefreshOnAuthError re-reads TokenFile after a 401/403 and retries once.
+	RefreshOnAuthError bool `yaml:"refresh_on_auth_error" env-default:"true"`
+	// BatchSize above 1 drains the buffer in batches of up to BatchSize
+	// envelopes or MaxBatchBytes of JSON.
+	BatchSize     int `yaml:"batch_size" env-default:"1"`
+	MaxBatchBytes int `yaml:"max_batch_bytes" env-default:"1048576"`
+	// ReplayRetry applies to draining the buffer, where data is already
+	// durable and retries should give up sooner.
+	ReplayRetry ReplayRetryConfig `yaml:"replay_retry"`
+	// Influx configures the "influx" type, writing line protocol to an
+	// InfluxDB v2 bucket.
+	Influx InfluxConfig `yaml:"influx"`
+	// Format is the http payload encoding: "json", or "cbor" for narrowband
+	// links.
+	Format string `yaml:"format" env-default:"json"`
+	// TLSServerName overrides the SNI and certificate name, for load
+	// balancers dialed by an address the certificate does not cover.
+	TLSServerName string `yaml:"tls_server_name"`
+	// S3 configures the "s3" type, archiving compressed NDJSON objects.
+	S3 S3Config `yaml:"s3"`
+	// BatchFormat is "array" for a JSON array of envelopes or "compact" for
+	// one station header with per-device payloads.
+	BatchFormat string `yaml:"batch_format" env-default:"array"`
+	// Redirects is the redirect policy of the http and influx clients, as for
+	// ConnectionConfig.
+	Redirects string `yaml:"redirects" env-default:"preserve"`
+	// LogDiffs makes the dry-run log sender log only points changed since a
+	// device's previous envelope, numbers within DiffEpsilon counting as
+	// equal.
+	LogDiffs    bool    `yaml:"log_diffs" env-default:"false"`
+	DiffEpsilon float64 `yaml:"diff_epsilon" env-default:"0"`
+	// Events, when its URL is set, gives event envelopes (see
+	// FieldConfig.Event) their own http sender, with Token as the fallback
+	// token. Otherwise they go with the telemetry, marked by the "event" meta
+	// key.
+	Events GroupSenderConfig `yaml:"events"`
+}
+
+// S3Config configures the "s3" sender type. Endpoint is host:port of an
+// S3-compatible service such as MinIO. Live sends are held and uploaded as
+// one object once FlushSize envelopes are pending or FlushInterval has
+// passed; batches drained from the buffer are uploaded as they come.
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"access_key" env:"S3_ACCESS_KEY"`
+	SecretKey string `yaml:"secret_key" env:"S3_SECRET_KEY"`
+	UseTLS    bool   `yaml:"use_tls" env-default:"true"`
+
+	FlushSize     int           `yaml:"flush_size" env-default:"100"`
+	FlushInterval time.Duration `yaml:"flush_interval" env-default:"1m"`
+}
+
+type InfluxConfig struct {
+	URL    string `yaml:"url"`
+	Org    string `yaml:"org"`
+	Bucket string `yaml:"bucket"`
+	Token  string `yaml:"token" env:"INFLUX_TOKEN"`
+}
+
+type GroupSenderConfig struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+}
+
+type KafkaConfig struct {
+	// Brokers are dialed over TLS, trusting sender.tls.ca_file, when a CA
+	// bundle is configured.
+	Brokers      []string      `yaml:"brokers"`
+	Topic        string        `yaml:"topic"`
+	ClientID     string        `yaml:"client_id" env-default:"asutp-collector"`
+	RequiredAcks int           `yaml:"required_acks" env-default:"-1"`
+	Compression  string        `yaml:"compression" env-default:"snappy"`
+	BatchTimeout time.Duration `yaml:"batch_timeout" env-default:"10ms"`
+}
+
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	ReplaceSystemRoots bool   `yaml:"replace_system_roots" env-default:"false"`
 }
 
 type RetryConfig struct {
@@ -36,16 +191,132 @@ type RetryConfig struct {
 	MaxDelay     time.Duration `yaml:"max_delay" env-default:"60s"`
 }
 
+type ReplayRetryConfig struct {
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"1"`
+	InitialDelay time.Duration `yaml:"initial_delay" env-default:"1s"`
+	MaxDelay     time.Duration `yaml:"max_delay" env-default:"5s"`
+}
+
+// BufferConfig configures the local buffer. Cleanup runs every
+// CleanupInterval plus a random delay of up to CleanupJitter, deleting at most
+// CleanupBatchSize rows per statement. The Health* thresholds drive the
+// buffer health checker; zero disables a threshold. DrainOrder is
+// "created_at" (insertion order) or "timestamp" (measurement time, for
+// consumers that need chronological replay). Live sends still interleave with
+// a drain, so strict order across both only holds while collection is paused.
 type BufferConfig struct {
-	Enabled bool          `yaml:"enabled" env-default:"true"`
-	Path    string        `yaml:"path" env-default:"/var/lib/asutp/buffer.db"`
-	MaxAge  time.Duration `yaml:"max_age" env-default:"24h"`
+	Enabled            bool          `yaml:"enabled" env-default:"true"`
+	Path               string        `yaml:"path" env-default:"/var/lib/asutp/buffer.db"`
+	MaxAge             time.Duration `yaml:"max_age" env-default:"24h"`
+	CleanupInterval    time.Duration `yaml:"cleanup_interval" env-default:"5m"`
+	CleanupJitter      time.Duration `yaml:"cleanup_jitter" env-default:"1m"`
+	CleanupBatchSize   int           `yaml:"cleanup_batch_size" env-default:"500"`
+	HealthMaxCount     int64         `yaml:"health_max_count" env-default:"1000"`
+	HealthDegradedAge  time.Duration `yaml:"health_degraded_age" env-default:"1h"`
+	HealthUnhealthyAge time.Duration `yaml:"health_unhealthy_age" env-default:"6h"`
+	DrainOrder         string        `yaml:"drain_order" env-default:"created_at"`
 }
 
+// HealthConfig configures the health server.
 type HealthConfig struct {
 	Address string `yaml:"address" env-default:":8080"`
+	// AdminAddress serves admin routes on a separate listener. Without auth,
+	// admin routes are only served on a loopback address.
+	AdminAddress     string        `yaml:"admin_address"`
+	HistorySize      int           `yaml:"history_size" env-default:"100"`
+	HistoryRetention time.Duration `yaml:"history_retention" env-default:"24h"`
+	// Readiness lists the criteria (config, collect, sender) that must be met
+	// before /ready returns 200.
+	Readiness []string `yaml:"readiness" env-default:"config,collect,sender"`
+	// LivenessThreshold is the maximum time since the last completed cycle
+	// before /live fails; 0 means three polling intervals.
+	LivenessThreshold time.Duration `yaml:"liveness_threshold" env-default:"0s"`
+	// DebugEnabled exposes pprof and runtime stats on the admin routes.
+	DebugEnabled bool `yaml:"debug_enabled" env-default:"false"`
+	// MaxGoroutines degrades health above that count.
+	MaxGoroutines int `yaml:"max_goroutines" env-default:"10000"`
+	// CheckTimeout bounds each checker; CheckTimeouts overrides it by checker
+	// name.
+	CheckTimeout  time.Duration            `yaml:"check_timeout" env-default:"2s"`
+	CheckTimeouts map[string]time.Duration `yaml:"check_timeouts"`
+	TLS           ServerTLSConfig          `yaml:"tls"`
+	Auth          AuthConfig               `yaml:"auth"`
+	Report        HealthReportConfig       `yaml:"report"`
+	EventLogSize  int                      `yaml:"event_log_size" env-default:"500"`
+	// CacheTTL reuses a recent /health result for rapid probes.
+	CacheTTL time.Duration `yaml:"cache_ttl" env-default:"5s"`
+	// System configures the host disk, memory and load checker.
+	System SystemHealthConfig `yaml:"system"`
+	// DrainTimeout bounds a POST /drain that passes no timeout of its own.
+	DrainTimeout time.Duration `yaml:"drain_timeout" env-default:"5m"`
+	// BindError is "fail" to exit when an address cannot be bound, or "warn"
+	// to log and keep collecting without the health server.
+	BindError string `yaml:"bind_error" env-default:"fail"`
+}
+
+// SystemHealthConfig sets free disk and memory thresholds in percent of the
+// total. LoadDegraded degrades health above that 1-minute load average; 0
+// disables the load check. The check needs Linux and is skipped elsewhere.
+type SystemHealthConfig struct {
+	Enabled                bool    `yaml:"enabled" env-default:"true"`
+	DiskDegradedPercent    float64 `yaml:"disk_degraded_percent" env-default:"10"`
+	DiskUnhealthyPercent   float64 `yaml:"disk_unhealthy_percent" env-default:"5"`
+	MemoryDegradedPercent  float64 `yaml:"memory_degraded_percent" env-default:"10"`
+	MemoryUnhealthyPercent float64 `yaml:"memory_unhealthy_percent" env-default:"5"`
+	LoadDegraded           float64 `yaml:"load_degraded" env-default:"0"`
+}
+
+// HealthReportConfig configures pushing health snapshots to the central
+// platform for stations that cannot be probed from outside. Reports trust
+// the sender TLS CA bundle.
+type HealthReportConfig struct {
+	Enabled  bool          `yaml:"enabled" env-default:"false"`
+	URL      string        `yaml:"url"`
+	Interval time.Duration `yaml:"interval" env-default:"60s"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+type ServerTLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// AuthConfig configures bearer token and/or basic auth. Admin routes always
+// require it when configured; ProtectReadOnly extends it to health probes.
+// PublicLive keeps /live unauthenticated for simple liveness probes.
+type AuthConfig struct {
+	Token           string `yaml:"token" env:"HEALTH_AUTH_TOKEN"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password" env:"HEALTH_AUTH_PASSWORD"`
+	ProtectReadOnly bool   `yaml:"protect_read_only" env-default:"false"`
+	PublicLive      bool   `yaml:"public_live" env-default:"true"`
+}
+
+// EnvelopeConfig controls how envelopes are built. TimestampPrecision
+// truncates envelope timestamps (e.g. 1s or 1m); 0 keeps full precision.
+// NonFinite decides what happens to NaN and infinite floats: "bad" sends them
+// as null with bad quality, "reject" drops the whole envelope. A field bad for
+// EscalateAfter consecutive polls (0 disables) gets EscalateSeverity until it
+// reads good again. Readings with more than MaxPoints values (0 means no
+// limit) are sent as several envelopes; see model.Envelope.Split. IDStrategy
+// picks how envelope IDs are generated: "uuid" (random), "hash" (derived from
+// the reading, for server-side dedup) or "sequence" (monotonic per device,
+// which needs the buffer to keep the numbering across restarts).
+type EnvelopeConfig struct {
+	IncludeCollectorVersion bool          `yaml:"include_collector_version" env-default:"false"`
+	TimestampPrecision      time.Duration `yaml:"timestamp_precision" env-default:"0s"`
+	NonFinite               string        `yaml:"non_finite" env-default:"bad"`
+	EscalateAfter           int           `yaml:"escalate_after" env-default:"0"`
+	EscalateSeverity        string        `yaml:"escalate_severity" env-default:"critical"`
+	MaxPoints               int           `yaml:"max_points" env-default:"0"`
+	IDStrategy              string        `yaml:"id_strategy" env-default:"uuid"`
 }
 
+const (
+	NonFiniteBad    = "bad"
+	NonFiniteReject = "reject"
+)
+
 type LogConfig struct {
 	Level  string `yaml:"level" env-default:"info"`
 	Format string `yaml:"format" env-default:"json"`
@@ -60,14 +331,124 @@ func MustLoad(configPath string) *Config {
 		configPath = "config/config.yaml"
 	}
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		panic("config file not found: " + configPath)
+	paths, err := ResolvePaths(configPath)
+	if err != nil {
+		panic(err.Error())
 	}
 
 	var cfg Config
-	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		panic("failed to read config: " + err.Error())
+	if len(paths) == 1 {
+		if err := cleanenv.ReadConfig(paths[0], &cfg); err != nil {
+			panic("failed to read config: " + err.Error())
+		}
+	} else {
+		merged, err := mergeFiles(paths)
+		if err != nil {
+			panic("failed to merge config: " + err.Error())
+		}
+		if err := cleanenv.ParseYAML(bytes.NewReader(merged), &cfg); err != nil {
+			panic("failed to read config: " + err.Error())
+		}
+		if err := cleanenv.ReadEnv(&cfg); err != nil {
+			panic("failed to read config: " + err.Error())
+		}
+	}
+
+	if cfg.Sender.Type == "http" && (cfg.Sender.URL == "" || (cfg.Sender.Token == "" && cfg.Sender.TokenFile == "")) {
+		panic("sender url and token are required for http sender")
 	}
 
+	if cfg.Station.EmptyDevices != "warn" && cfg.Station.EmptyDevices != "fail" {
+		panic("invalid station empty_devices policy: " + cfg.Station.EmptyDevices)
+	}
+
+	if cfg.Health.BindError != "warn" && cfg.Health.BindError != "fail" {
+		panic("invalid health bind_error policy: " + cfg.Health.BindError)
+	}
+
+	for _, criterion := range cfg.Health.Readiness {
+		switch criterion {
+		case "config", "collect", "sender":
+		default:
+			panic("invalid health readiness criterion: " + criterion)
+		}
+	}
+
+	if cfg.Health.Report.Enabled && cfg.Health.Report.Interval <= 0 {
+		panic("health report interval must be positive")
+	}
+
+	if cfg.Envelope.NonFinite != NonFiniteBad && cfg.Envelope.NonFinite != NonFiniteReject {
+		panic("invalid envelope non_finite policy: " + cfg.Envelope.NonFinite)
+	}
+
+	switch cfg.Envelope.IDStrategy {
+	case model.IDRandom, model.IDHash, model.IDSequence:
+	default:
+		panic("invalid envelope id_strategy: " + cfg.Envelope.IDStrategy)
+	}
+	if cfg.Envelope.IDStrategy == model.IDSequence && !cfg.Buffer.Enabled {
+		panic("envelope id_strategy sequence requires the buffer, which persists the sequence numbers")
+	}
+
+	if cfg.Sender.Retry.MaxAttempts < 1 || cfg.Sender.ReplayRetry.MaxAttempts < 1 {
+		panic("sender retry and replay_retry max_attempts must be at least 1")
+	}
+
+	if cfg.Sender.Format != "json" && cfg.Sender.Format != "cbor" {
+		panic("invalid sender format: " + cfg.Sender.Format)
+	}
+
+	if !redirect.Valid(cfg.Sender.Redirects) {
+		panic("invalid sender redirects policy: " + cfg.Sender.Redirects)
+	}
+
+	if (len(cfg.Sender.Groups) > 0 || cfg.Sender.Events.URL != "") && cfg.Sender.Type != "http" {
+		panic("sender groups and events need the http sender type, not " + cfg.Sender.Type)
+	}
+	for group, groupCfg := range cfg.Sender.Groups {
+		if groupCfg.URL == "" {
+			panic("sender group " + group + " has no url")
+		}
+		if _, ok := cfg.Sender.GroupURLs[group]; ok {
+			panic("sender group " + group + " is set in both groups and group_urls")
+		}
+	}
+
+	if cfg.Sender.BatchFormat != "array" && cfg.Sender.BatchFormat != "compact" {
+		panic("invalid sender batch format: " + cfg.Sender.BatchFormat)
+	}
+
+	if cfg.Buffer.DrainOrder != "created_at" && cfg.Buffer.DrainOrder != "timestamp" {
+		panic("invalid buffer drain order: " + cfg.Buffer.DrainOrder)
+	}
+
+	if cfg.Watchdog.Action != "exit" && cfg.Watchdog.Action != "reset" {
+		panic("invalid watchdog action: " + cfg.Watchdog.Action)
+	}
+
+	escalateSeverity, err := model.NormalizeSeverity(cfg.Envelope.EscalateSeverity, nil, false)
+	if err != nil || escalateSeverity == "" {
+		panic("invalid envelope escalate severity: " + cfg.Envelope.EscalateSeverity)
+	}
+	cfg.Envelope.EscalateSeverity = escalateSeverity
+
+	if cfg.Backfill.Enabled && cfg.Backfill.MaxRange <= 0 {
+		panic("backfill max_range must be positive")
+	}
+
+	cfg.Path = configPath
+	cfg.Paths = paths
+
 	return &cfg
 }
+
+// FileChecksum returns the hex-encoded SHA-256 of the file at path.
+func FileChecksum(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
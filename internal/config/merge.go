@@ -0,0 +1,103 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ResolvePaths expands a config path into the files to load, in merge order.
+// The path is a single file, a directory, or a comma-separated list of
+// either; a directory contributes its *.yaml and *.yml files sorted by name,
+// so numeric prefixes set the order, e.g. 00-base.yaml, 10-site.yaml,
+// 20-secrets.yaml.
+func ResolvePaths(configPath string) ([]string, error) {
+	var paths []string
+	for _, entry := range strings.Split(configPath, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		info, err := os.Stat(entry)
+		if err != nil {
+			return nil, fmt.Errorf("config file not found: %s", entry)
+		}
+		if !info.IsDir() {
+			paths = append(paths, entry)
+			continue
+		}
+
+		var files []string
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(entry, pattern))
+			if err != nil {
+				return nil, fmt.Errorf("failed to list config directory %s: %w", entry, err)
+			}
+			files = append(files, matches...)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("config directory has no yaml files: %s", entry)
+		}
+		sort.Strings(files)
+		paths = append(paths, files...)
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no config files in %q", configPath)
+	}
+	return paths, nil
+}
+
+// mergeFiles merges the YAML files in order into a single document. Later
+// files override earlier ones: mappings are merged key by key, while scalars
+// and sequences are replaced as a whole. An explicit null removes the key, so
+// the setting falls back to its default.
+func mergeFiles(paths []string) ([]byte, error) {
+	merged := make(map[string]any)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		var doc map[string]any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		mergeMaps(merged, doc)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	if err := enc.Encode(merged); err != nil {
+		return nil, fmt.Errorf("failed to encode merged config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode merged config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeMaps deep-merges src into dst.
+func mergeMaps(dst, src map[string]any) {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+
+		srcMap, srcIsMap := value.(map[string]any)
+		dstMap, dstIsMap := dst[key].(map[string]any)
+		if srcIsMap && dstIsMap {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMergeMaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		dst, src string
+		want     string
+	}{
+		{
+			name: "nested maps merge key by key",
+			dst:  "sender: {url: http://a, token: t1, retry: {max_attempts: 5, initial_delay: 1s}}",
+			src:  "sender: {token: t2, retry: {max_attempts: 3}}",
+			want: "sender: {url: http://a, token: t2, retry: {max_attempts: 3, initial_delay: 1s}}",
+		},
+		{
+			name: "sequences are replaced",
+			dst:  "health: {checks: [a, b, c]}",
+			src:  "health: {checks: [d]}",
+			want: "health: {checks: [d]}",
+		},
+		{
+			name: "scalar replaces map",
+			dst:  "tls: {cert: a.pem}",
+			src:  "tls: off",
+			want: "tls: off",
+		},
+		{
+			name: "map replaces scalar",
+			dst:  "tls: off",
+			src:  "tls: {cert: a.pem}",
+			want: "tls: {cert: a.pem}",
+		},
+		{
+			name: "null removes key",
+			dst:  "sender: {url: http://a, token: t1}",
+			src:  "sender: {token: null}",
+			want: "sender: {url: http://a}",
+		},
+		{
+			name: "null removes section",
+			dst:  "env: prod\nsender: {url: http://a}",
+			src:  "sender: ~",
+			want: "env: prod",
+		},
+		{
+			name: "new keys are added",
+			dst:  "env: prod",
+			src:  "buffer: {path: /tmp/b.db}",
+			want: "env: prod\nbuffer: {path: /tmp/b.db}",
+		},
+		{
+			name: "empty source keeps destination",
+			dst:  "env: prod",
+			src:  "{}",
+			want: "env: prod",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst, src, want map[string]any
+			for i, v := range []*map[string]any{&dst, &src, &want} {
+				doc := []string{tt.dst, tt.src, tt.want}[i]
+				if err := yaml.Unmarshal([]byte(doc), v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			mergeMaps(dst, src)
+			if !reflect.DeepEqual(dst, want) {
+				t.Fatalf("merged = %v, want %v", dst, want)
+			}
+		})
+	}
+}
+
+func TestMergeFilesOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "00-base.yaml", "env: prod\nsender: {url: http://base, token: base}\n")
+	writeFile(t, dir, "10-site.yml", "sender: {url: http://site}\n")
+	writeFile(t, dir, "20-secrets.yaml", "sender: {token: secret}\n")
+	writeFile(t, dir, "notes.txt", "sender: {url: ignored}\n")
+	extra := writeFile(t, t.TempDir(), "override.yaml", "env: staging\n")
+
+	paths, err := ResolvePaths(dir + ", " + extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPaths := []string{
+		filepath.Join(dir, "00-base.yaml"),
+		filepath.Join(dir, "10-site.yml"),
+		filepath.Join(dir, "20-secrets.yaml"),
+		extra,
+	}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Fatalf("paths = %v, want %v", paths, wantPaths)
+	}
+
+	data, err := mergeFiles(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"env":    "staging",
+		"sender": map[string]any{"url": "http://site", "token": "secret"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged = %v, want %v", got, want)
+	}
+}
+
+func TestResolvePathsErrors(t *testing.T) {
+	empty := t.TempDir()
+	writeFile(t, empty, "readme.md", "")
+
+	for _, path := range []string{"", " , ", filepath.Join(empty, "missing.yaml"), empty} {
+		if paths, err := ResolvePaths(path); err == nil {
+			t.Fatalf("ResolvePaths(%q) = %v, want error", path, paths)
+		}
+	}
+}
+
+func TestMergeFilesInvalidYAML(t *testing.T) {
+	dir := t.TempDir()
+	good := writeFile(t, dir, "a.yaml", "env: prod\n")
+	bad := writeFile(t, dir, "b.yaml", "env: [prod\n")
+	if _, err := mergeFiles([]string{good, bad}); err == nil {
+		t.Fatal("mergeFiles accepted invalid YAML")
+	}
+}
@@ -1,57 +1,729 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
 	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/shopspring/decimal"
+	"github.com/speedwagon-io/asutp/internal/lib/redirect"
+	"github.com/speedwagon-io/asutp/internal/model"
+	"gopkg.in/yaml.v3"
 )
 
+// StationConfig describes a station and its devices. Field severities are
+// normalized at load to info, warning, alarm or critical; SeverityMap maps
+// legacy labels onto those, and AllowCustomSeverity keeps unknown labels
+// instead of rejecting the config. GroupFieldPrefixes sets the FieldPrefix of
+// devices in a group that do not set their own.
 type StationConfig struct {
-	StationID   string           `yaml:"station_id"`
-	StationName string           `yaml:"station_name"`
-	Connection  ConnectionConfig `yaml:"connection"`
-	Polling     PollingConfig    `yaml:"polling"`
-	Devices     []DeviceConfig   `yaml:"devices"`
+	StationID   string                      `yaml:"station_id"`
+	StationName string                      `yaml:"station_name"`
+	Connection  ConnectionConfig            `yaml:"connection"`
+	Connections map[string]ConnectionConfig `yaml:"connections"`
+	Polling     PollingConfig               `yaml:"polling"`
+	Devices     []DeviceConfig              `yaml:"devices"`
+	Templates   []DeviceTemplate            `yaml:"device_templates"`
+
+	SeverityMap         map[string]string `yaml:"severity_map"`
+	AllowCustomSeverity bool              `yaml:"allow_custom_severity"`
+
+	GroupFieldPrefixes map[string]string `yaml:"group_field_prefixes"`
+}
+
+// DeviceTemplate expands into one DeviceConfig per instance. Each instance is
+// a set of variables substituted as {name} into the template's ID, name and
+// endpoint.
+type DeviceTemplate struct {
+	Template  DeviceConfig        `yaml:"template"`
+	Instances []map[string]string `yaml:"instances"`
 }
 
+// ConnectionConfig describes how to reach the station API. LenientJSON
+// accepts bare NaN and Infinity literals, turning them into bad-quality
+// points instead of failing the whole response. Redirects is the redirect
+// policy of the HTTP client: "preserve", "follow", "resend" or "none" (see
+// package redirect). Serial configures the bus of the "modbus_rtu" adapter.
 type ConnectionConfig struct {
-	BaseURL string        `yaml:"base_url"`
-	Adapter string        `yaml:"adapter" env-default:"energy_api"`
-	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+	BaseURL     string        `yaml:"base_url"`
+	Adapter     string        `yaml:"adapter" env-default:"energy_api"`
+	Timeout     time.Duration `yaml:"timeout" env-default:"10s"`
+	TLS         TLSConfig     `yaml:"tls"`
+	LenientJSON bool          `yaml:"lenient_json" env-default:"true"`
+	File        FileConfig    `yaml:"file"`
+	SSH         SSHConfig     `yaml:"ssh"`
+	Redirects   string        `yaml:"redirects" env-default:"preserve"`
+	Serial      SerialConfig  `yaml:"serial"`
+}
+
+// SerialConfig describes an RS-485 serial port shared by Modbus RTU slaves.
+// Parity is "N", "E" or "O".
+type SerialConfig struct {
+	Device   string `yaml:"device"`
+	BaudRate int    `yaml:"baud_rate" env-default:"9600"`
+	DataBits int    `yaml:"data_bits" env-default:"8"`
+	Parity   string `yaml:"parity" env-default:"N"`
+	StopBits int    `yaml:"stop_bits" env-default:"1"`
+}
+
+// SSHConfig configures an SSH jump host that adapter connections are dialed
+// through. Host is "host:port" of the jump host.
+type SSHConfig struct {
+	Enabled               bool          `yaml:"enabled" env-default:"false"`
+	Host                  string        `yaml:"host"`
+	User                  string        `yaml:"user"`
+	KeyFile               string        `yaml:"key_file"`
+	KnownHostsFile        string        `yaml:"known_hosts_file"`
+	InsecureIgnoreHostKey bool          `yaml:"insecure_ignore_host_key" env-default:"false"`
+	Timeout               time.Duration `yaml:"timeout" env-default:"10s"`
 }
 
+// FileConfig configures the file adapter. AfterRead is one of "keep",
+// "delete" or "archive"; archived files are moved to ArchiveDir.
+type FileConfig struct {
+	Dir        string `yaml:"dir"`
+	AfterRead  string `yaml:"after_read" env-default:"keep"`
+	ArchiveDir string `yaml:"archive_dir"`
+}
+
+// PollingConfig controls the collection schedule. OverlapPolicy decides what
+// happens when a tick fires while the previous cycle is still running: "skip"
+// drops the tick, "queue" runs one more cycle right after the current one.
+// InitialDelay postpones the first collection after startup.
 type PollingConfig struct {
-	Interval time.Duration `yaml:"interval" env-default:"10s"`
-	Timeout  time.Duration `yaml:"timeout" env-default:"5s"`
+	Interval      time.Duration `yaml:"interval" env-default:"10s"`
+	Timeout       time.Duration `yaml:"timeout" env-default:"5s"`
+	OverlapPolicy string        `yaml:"overlap_policy" env-default:"skip"`
+	InitialDelay  time.Duration `yaml:"initial_delay" env-default:"0s"`
 }
 
+// DeviceConfig describes a polled device.
 type DeviceConfig struct {
-	ID           string        `yaml:"id"`
-	Name         string        `yaml:"name"`
-	Group        string        `yaml:"group"`
-	Endpoint     string        `yaml:"endpoint"`
-	RequestParam string        `yaml:"request_param"`
-	Fields       []FieldConfig `yaml:"fields"`
+	ID           string `yaml:"id"`
+	Name         string `yaml:"name"`
+	Group        string `yaml:"group"`
+	Endpoint     string `yaml:"endpoint"`
+	RequestParam string `yaml:"request_param"`
+	// MinSendInterval limits sends to one per window; readings in between
+	// are coalesced to the latest.
+	MinSendInterval time.Duration `yaml:"min_send_interval"`
+	// MetadataFields maps envelope metadata keys to response fields, e.g.
+	// firmware version, kept apart from the data points.
+	MetadataFields map[string]string `yaml:"metadata_fields"`
+	// Sources holds per-connection endpoints for fields collected from other
+	// connections.
+	Sources map[string]DeviceSource `yaml:"sources"`
+	Fields  []FieldConfig           `yaml:"fields"`
+	// BooleanTarget turns a bare True/False response into a single data point
+	// with that name instead of skipping it.
+	BooleanTarget string `yaml:"boolean_target"`
+	// ReportFaults sends an all-bad envelope marked device_status=unreachable
+	// when collection fails, and marks devices with only bad points
+	// device_status=fault.
+	ReportFaults bool `yaml:"report_faults"`
+	// BodyEncoding sends RequestParam as a JSON object ("json", the default)
+	// or as a form field ("form").
+	BodyEncoding string `yaml:"body_encoding"`
+	// Priority orders collection, sending and buffer draining, highest first.
+	Priority int `yaml:"priority"`
+	// RawPassthrough attaches the unmodified response to the envelope; the
+	// device may then have no fields.
+	RawPassthrough bool `yaml:"raw_passthrough"`
+	// FieldPrefix names every data point prefix.name, e.g. breaker.status.
+	FieldPrefix string `yaml:"field_prefix"`
+	// HistoryEndpoint serves past readings for backfill, each record carrying
+	// its time in HistoryTimeField ("timestamp" by default).
+	HistoryEndpoint  string `yaml:"history_endpoint"`
+	HistoryTimeField string `yaml:"history_time_field"`
+	// Method is the HTTP method, POST by default.
+	Method string `yaml:"method"`
+	// ParamIn places RequestParam in the "body" (the default), as a last
+	// "path" segment or as a "query" parameter; GET needs path or query.
+	ParamIn string `yaml:"param_in"`
+	// SlaveID addresses the device on a Modbus RTU bus.
+	SlaveID uint8 `yaml:"slave_id"`
+
+	// pointNames maps field targets to their prefixed point names, built
+	// once at load so collection does not concatenate them every cycle.
+	pointNames map[string]string
+}
+
+// PointName returns the data point name of a field target: target itself,
+// or prefix.target when the device has a FieldPrefix.
+func (d *DeviceConfig) PointName(target string) string {
+	if d.FieldPrefix == "" {
+		return target
+	}
+	if name, ok := d.pointNames[target]; ok {
+		return name
+	}
+	return d.FieldPrefix + "." + target
 }
 
+// Request body encodings for DeviceConfig.BodyEncoding.
+const (
+	BodyJSON = "json"
+	BodyForm = "form"
+)
+
+// Request parameter placements for DeviceConfig.ParamIn.
+const (
+	ParamBody  = "body"
+	ParamPath  = "path"
+	ParamQuery = "query"
+)
+
+// DeviceSource overrides the endpoint and request parameter used when a
+// device's fields are collected through a named connection.
+type DeviceSource struct {
+	Endpoint     string `yaml:"endpoint"`
+	RequestParam string `yaml:"request_param"`
+}
+
+// FieldConfig maps a source field to a data point.
 type FieldConfig struct {
-	Source   string `yaml:"source"`
-	Target   string `yaml:"target"`
-	Unit     string `yaml:"unit,omitempty"`
+	// Connection names an entry of StationConfig.Connections to collect the
+	// field from; empty means the primary connection.
+	Connection string `yaml:"connection,omitempty"`
+	// Source is a name or a list of aliases tried in order, for firmware
+	// that names the same value differently.
+	Source SourceNames `yaml:"source"`
+	Target string      `yaml:"target"`
+	Unit   string      `yaml:"unit,omitempty"`
+	// Type is float (the default), int, bool, decimal or string. Decimal
+	// keeps the exact source digits and is sent as a JSON string.
 	Type     string `yaml:"type" env-default:"float"`
 	Severity string `yaml:"severity,omitempty"`
+	// Default is coerced to Type at load and sent with bad quality when the
+	// source is missing or fails to convert.
+	Default any `yaml:"default,omitempty"`
+	// QualitySource names a companion field whose value QualityMap maps to
+	// good, bad or uncertain; unmapped values yield uncertain.
+	QualitySource string            `yaml:"quality_source,omitempty"`
+	QualityMap    map[string]string `yaml:"quality_map,omitempty"`
+	// Normalize lists steps applied in order to string fields: trim, upper,
+	// lower, strip_nonprintable.
+	Normalize []string `yaml:"normalize,omitempty"`
+	// Expression computes the value from the source field (value) and the
+	// whole response (raw) before conversion; Source may then be empty.
+	Expression string `yaml:"expression,omitempty"`
+	// Quantity names the physical quantity (see quantityUnits) Unit is
+	// checked against.
+	Quantity string `yaml:"quantity,omitempty"`
+	// UnitSource names a response field supplying the unit when Unit is
+	// empty.
+	UnitSource string `yaml:"unit_source,omitempty"`
+	// KeepRaw attaches the source value even when it converted cleanly;
+	// points that are not good always carry it.
+	KeepRaw bool `yaml:"keep_raw,omitempty"`
+	// Event sends the point in a separate event envelope, only when its value
+	// or quality changes, e.g. a breaker trip.
+	Event bool `yaml:"event,omitempty"`
+
+	// Register is the address read by the modbus_rtu adapter, from a
+	// "holding" (default) or "input" RegisterType. RegisterFormat is uint16
+	// (default), int16, uint32, int32 or float32; 32-bit formats span two
+	// registers, high word first.
+	Register       *uint16 `yaml:"register,omitempty"`
+	RegisterType   string  `yaml:"register_type,omitempty"`
+	RegisterFormat string  `yaml:"register_format,omitempty"`
+
+	// RawMin, RawMax, EUMin and EUMax, set together on float or int fields,
+	// map the value linearly from the raw range to engineering units.
+	// ScaleClamp handles values outside the raw range: "none" extrapolates
+	// (the default), "clamp" limits to the EU range, "bad" marks the point
+	// bad with reason out_of_range.
+	RawMin     *float64 `yaml:"raw_min,omitempty"`
+	RawMax     *float64 `yaml:"raw_max,omitempty"`
+	EUMin      *float64 `yaml:"eu_min,omitempty"`
+	EUMax      *float64 `yaml:"eu_max,omitempty"`
+	ScaleClamp string   `yaml:"scale_clamp,omitempty"`
+
+	// defaultValue is Default converted to Type and program is the compiled
+	// Expression, both built once at load.
+	defaultValue model.Value
+	program      *vm.Program
+}
+
+// Program returns the compiled Expression, or nil when the field has none or
+// was not loaded through LoadStation.
+func (f *FieldConfig) Program() *vm.Program {
+	return f.program
+}
+
+// DefaultValue returns the field default converted to the field type, and
+// false when the field has none.
+func (f *FieldConfig) DefaultValue() (model.Value, bool) {
+	return f.defaultValue, f.Default != nil
+}
+
+// Scaled reports whether the field has a raw to engineering unit range.
+func (f *FieldConfig) Scaled() bool {
+	return f.RawMin != nil && f.RawMax != nil && f.EUMin != nil && f.EUMax != nil
+}
+
+// Out-of-range handling for FieldConfig.ScaleClamp.
+const (
+	ScaleClampNone  = "none"
+	ScaleClampLimit = "clamp"
+	ScaleClampBad   = "bad"
+)
+
+// Modbus register types and formats for FieldConfig.
+const (
+	RegisterHolding = "holding"
+	RegisterInput   = "input"
+
+	FormatUint16  = "uint16"
+	FormatInt16   = "int16"
+	FormatUint32  = "uint32"
+	FormatInt32   = "int32"
+	FormatFloat32 = "float32"
+)
+
+// SourceNames accepts either a scalar or a sequence in YAML.
+type SourceNames []string
+
+func (s *SourceNames) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = SourceNames{value.Value}
+		return nil
+	}
+	var names []string
+	if err := value.Decode(&names); err != nil {
+		return err
+	}
+	*s = names
+	return nil
+}
+
+func (s SourceNames) String() string {
+	return strings.Join(s, "|")
+}
+
+const (
+	NormalizeTrim              = "trim"
+	NormalizeUpper             = "upper"
+	NormalizeLower             = "lower"
+	NormalizeStripNonPrintable = "strip_nonprintable"
+)
+
+// NormalizeString applies the normalization steps in order.
+func NormalizeString(s string, steps []string) string {
+	for _, step := range steps {
+		switch step {
+		case NormalizeTrim:
+			s = strings.TrimSpace(s)
+		case NormalizeUpper:
+			s = strings.ToUpper(s)
+		case NormalizeLower:
+			s = strings.ToLower(s)
+		case NormalizeStripNonPrintable:
+			s = strings.Map(func(r rune) rune {
+				if unicode.IsPrint(r) {
+					return r
+				}
+				return -1
+			}, s)
+		}
+	}
+	return s
 }
 
 func MustLoadStation(configPath string) *StationConfig {
+	cfg, err := LoadStation(configPath)
+	if err != nil {
+		panic(err.Error())
+	}
+	return cfg
+}
+
+// LoadStation reads and validates a station config without panicking, so a
+// reload can reject an invalid file and keep the running config.
+func LoadStation(configPath string) (*StationConfig, error) {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		panic("station config file not found: " + configPath)
+		return nil, fmt.Errorf("station config file not found: %s", configPath)
 	}
 
 	var cfg StationConfig
 	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		panic("failed to read station config: " + err.Error())
+		return nil, fmt.Errorf("failed to read station config: %w", err)
+	}
+
+	cfg.expandTemplates()
+	if err := cfg.applyDefaults(); err != nil {
+		return nil, fmt.Errorf("invalid station config: %w", err)
+	}
+	cfg.applyGroupFieldPrefixes()
+
+	if err := cfg.validatePolling(); err != nil {
+		return nil, fmt.Errorf("invalid station config: %w", err)
+	}
+
+	if err := cfg.validateDeviceIDs(); err != nil {
+		return nil, fmt.Errorf("invalid station config: %w", err)
+	}
+
+	if err := cfg.validateRedirects(); err != nil {
+		return nil, fmt.Errorf("invalid station config: %w", err)
+	}
+
+	if err := cfg.validateFieldConnections(); err != nil {
+		return nil, fmt.Errorf("invalid station config: %w", err)
+	}
+
+	if err := cfg.validateFields(); err != nil {
+		return nil, fmt.Errorf("invalid station config: %w", err)
 	}
 
-	return &cfg
+	return &cfg, nil
+}
+
+// AddDeviceFile reads a single device definition from a YAML file, appends
+// it to the station's devices and validates it against the station, e.g.
+// for probing a device that is not yet in the station config.
+func (c *StationConfig) AddDeviceFile(path string) (*DeviceConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device file: %w", err)
+	}
+
+	var device DeviceConfig
+	if err := yaml.Unmarshal(data, &device); err != nil {
+		return nil, fmt.Errorf("failed to parse device file: %w", err)
+	}
+
+	c.Devices = append(c.Devices, device)
+	if err := c.applyDefaults(); err != nil {
+		return nil, fmt.Errorf("invalid device: %w", err)
+	}
+	c.applyGroupFieldPrefixes()
+
+	if err := c.validateDeviceIDs(); err != nil {
+		return nil, fmt.Errorf("invalid device: %w", err)
+	}
+	if err := c.validateFieldConnections(); err != nil {
+		return nil, fmt.Errorf("invalid device: %w", err)
+	}
+	if err := c.validateFields(); err != nil {
+		return nil, fmt.Errorf("invalid device: %w", err)
+	}
+
+	return &c.Devices[len(c.Devices)-1], nil
+}
+
+// applyDefaults fills in the env-default values cleanenv leaves unset inside
+// map values and slice elements: named connections and device fields,
+// including those expanded from templates.
+func (c *StationConfig) applyDefaults() error {
+	for name, conn := range c.Connections {
+		if err := cleanenv.ReadEnv(&conn); err != nil {
+			return fmt.Errorf("connection %s: %w", name, err)
+		}
+		c.Connections[name] = conn
+	}
+	for i := range c.Devices {
+		d := &c.Devices[i]
+		for j := range d.Fields {
+			if err := cleanenv.ReadEnv(&d.Fields[j]); err != nil {
+				return fmt.Errorf("device %s field %s: %w", d.ID, d.Fields[j].Target, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyGroupFieldPrefixes fills in the group prefix of devices without their
+// own FieldPrefix and precomputes the prefixed point names.
+func (c *StationConfig) applyGroupFieldPrefixes() {
+	for i := range c.Devices {
+		d := &c.Devices[i]
+		if d.FieldPrefix == "" {
+			d.FieldPrefix = c.GroupFieldPrefixes[d.Group]
+		}
+		if d.FieldPrefix == "" {
+			d.pointNames = nil
+			continue
+		}
+
+		d.pointNames = make(map[string]string, len(d.Fields)+1)
+		for _, f := range d.Fields {
+			d.pointNames[f.Target] = d.FieldPrefix + "." + f.Target
+		}
+		if d.BooleanTarget != "" {
+			d.pointNames[d.BooleanTarget] = d.FieldPrefix + "." + d.BooleanTarget
+		}
+	}
+}
+
+func (c *StationConfig) expandTemplates() {
+	for _, tmpl := range c.Templates {
+		for _, vars := range tmpl.Instances {
+			pairs := make([]string, 0, len(vars)*2)
+			for k, v := range vars {
+				pairs = append(pairs, "{"+k+"}", v)
+			}
+			r := strings.NewReplacer(pairs...)
+
+			device := tmpl.Template
+			device.ID = r.Replace(device.ID)
+			device.Name = r.Replace(device.Name)
+			device.Endpoint = r.Replace(device.Endpoint)
+			device.Fields = append([]FieldConfig(nil), tmpl.Template.Fields...)
+
+			c.Devices = append(c.Devices, device)
+		}
+	}
+}
+
+// validatePolling rejects an overlap policy other than "skip" or "queue".
+func (c *StationConfig) validatePolling() error {
+	switch c.Polling.OverlapPolicy {
+	case "skip", "queue":
+		return nil
+	default:
+		return fmt.Errorf("unknown polling overlap policy %q", c.Polling.OverlapPolicy)
+	}
+}
+
+// validateDeviceIDs ensures every device has a unique, non-empty ID, since
+// per-device state in the manager is keyed by it.
+func (c *StationConfig) validateDeviceIDs() error {
+	seen := make(map[string]struct{}, len(c.Devices))
+	for i, d := range c.Devices {
+		if d.ID == "" {
+			return fmt.Errorf("device #%d has no id", i+1)
+		}
+		if _, ok := seen[d.ID]; ok {
+			return fmt.Errorf("duplicate device id: %s", d.ID)
+		}
+		seen[d.ID] = struct{}{}
+	}
+	return nil
+}
+
+func (c *StationConfig) validateRedirects() error {
+	if !redirect.Valid(c.Connection.Redirects) {
+		return fmt.Errorf("unknown redirects policy %q", c.Connection.Redirects)
+	}
+	for name, conn := range c.Connections {
+		if !redirect.Valid(conn.Redirects) {
+			return fmt.Errorf("connection %s: unknown redirects policy %q", name, conn.Redirects)
+		}
+	}
+	return nil
+}
+
+func (c *StationConfig) validateFieldConnections() error {
+	for _, d := range c.Devices {
+		for _, f := range d.Fields {
+			if f.Connection == "" {
+				continue
+			}
+			if _, ok := c.Connections[f.Connection]; !ok {
+				return fmt.Errorf("device %s field %s: unknown connection %q", d.ID, f.Target, f.Connection)
+			}
+		}
+	}
+	return nil
+}
+
+// ExpressionEnv is the environment field expressions are evaluated in.
+type ExpressionEnv struct {
+	Value any            `expr:"value"`
+	Raw   map[string]any `expr:"raw"`
+}
+
+// CompileExpression compiles a field expression. Expressions see the source
+// field as value and the whole response as raw, e.g. "raw.voltage * 0.1".
+func CompileExpression(source string) (*vm.Program, error) {
+	program, err := expr.Compile(source, expr.Env(ExpressionEnv{}))
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	return program, nil
+}
+
+func (c *StationConfig) validateFields() error {
+	for i := range c.Devices {
+		d := &c.Devices[i]
+		switch d.BodyEncoding {
+		case "", BodyJSON, BodyForm:
+		default:
+			return fmt.Errorf("device %s: unknown body encoding %q", d.ID, d.BodyEncoding)
+		}
+		d.Method = strings.ToUpper(d.Method)
+		switch d.Method {
+		case "", http.MethodPost, http.MethodGet:
+		default:
+			return fmt.Errorf("device %s: unsupported method %q", d.ID, d.Method)
+		}
+		switch d.ParamIn {
+		case "", ParamBody:
+			if d.Method == http.MethodGet {
+				return fmt.Errorf("device %s: GET requests need param_in path or query", d.ID)
+			}
+		case ParamPath, ParamQuery:
+		default:
+			return fmt.Errorf("device %s: unknown param_in %q", d.ID, d.ParamIn)
+		}
+		for j := range d.Fields {
+			f := &d.Fields[j]
+			severity, err := model.NormalizeSeverity(f.Severity, c.SeverityMap, c.AllowCustomSeverity)
+			if err != nil {
+				return fmt.Errorf("device %s field %s: %w", d.ID, f.Target, err)
+			}
+			f.Severity = severity
+
+			if f.Expression != "" {
+				if f.program, err = CompileExpression(f.Expression); err != nil {
+					return fmt.Errorf("device %s field %s: %w", d.ID, f.Target, err)
+				}
+			}
+			for _, step := range f.Normalize {
+				switch step {
+				case NormalizeTrim, NormalizeUpper, NormalizeLower, NormalizeStripNonPrintable:
+				default:
+					return fmt.Errorf("device %s field %s: unknown normalize step %q", d.ID, f.Target, step)
+				}
+			}
+			if err := f.validateScale(); err != nil {
+				return fmt.Errorf("device %s field %s: %w", d.ID, f.Target, err)
+			}
+			if err := f.convertDefault(); err != nil {
+				return fmt.Errorf("device %s field %s: %w", d.ID, f.Target, err)
+			}
+			switch f.RegisterType {
+			case "", RegisterHolding, RegisterInput:
+			default:
+				return fmt.Errorf("device %s field %s: unknown register type %q", d.ID, f.Target, f.RegisterType)
+			}
+			switch f.RegisterFormat {
+			case "", FormatUint16, FormatInt16, FormatUint32, FormatInt32, FormatFloat32:
+			default:
+				return fmt.Errorf("device %s field %s: unknown register format %q", d.ID, f.Target, f.RegisterFormat)
+			}
+			for raw, quality := range f.QualityMap {
+				switch quality {
+				case "good", "bad", "uncertain":
+				default:
+					return fmt.Errorf("device %s field %s: invalid quality %q for %q", d.ID, f.Target, quality, raw)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// convertDefault converts Default to the field type, so a default that does
+// not fit the type rejects the config instead of failing on every poll.
+func (f *FieldConfig) convertDefault() error {
+	if f.Default == nil {
+		return nil
+	}
+
+	v := f.Default
+	var err error
+	switch f.Type {
+	case "float":
+		switch v := v.(type) {
+		case int:
+			f.defaultValue = model.FloatValue(float64(v))
+		case float64:
+			f.defaultValue = model.FloatValue(v)
+		case string:
+			var n float64
+			n, err = strconv.ParseFloat(v, 64)
+			f.defaultValue = model.FloatValue(n)
+		default:
+			err = fmt.Errorf("unsupported type %T", v)
+		}
+	case "int":
+		switch v := v.(type) {
+		case int:
+			f.defaultValue = model.IntValue(int64(v))
+		case float64:
+			f.defaultValue = model.IntValue(int64(v))
+		case string:
+			var n int64
+			n, err = strconv.ParseInt(v, 10, 64)
+			f.defaultValue = model.IntValue(n)
+		default:
+			err = fmt.Errorf("unsupported type %T", v)
+		}
+	case "bool":
+		switch v := v.(type) {
+		case bool:
+			f.defaultValue = model.BoolValue(v)
+		case int:
+			f.defaultValue = model.BoolValue(v != 0)
+		case float64:
+			f.defaultValue = model.BoolValue(v != 0)
+		case string:
+			var b bool
+			b, err = strconv.ParseBool(v)
+			f.defaultValue = model.BoolValue(b)
+		default:
+			err = fmt.Errorf("unsupported type %T", v)
+		}
+	case "decimal":
+		var d decimal.Decimal
+		switch v := v.(type) {
+		case int:
+			d = decimal.NewFromInt(int64(v))
+		case float64:
+			d = decimal.NewFromFloat(v)
+		case string:
+			d, err = decimal.NewFromString(strings.TrimSpace(v))
+		default:
+			err = fmt.Errorf("unsupported type %T", v)
+		}
+		f.defaultValue = model.DecimalValue(d.String())
+	case "string":
+		f.defaultValue = model.StringValue(NormalizeString(fmt.Sprintf("%v", v), f.Normalize))
+	default:
+		f.defaultValue = model.ValueOf(v)
+	}
+	if err != nil {
+		return fmt.Errorf("default %v does not convert to %s: %w", f.Default, f.Type, err)
+	}
+	return nil
+}
+
+func (f *FieldConfig) validateScale() error {
+	set := 0
+	for _, bound := range []*float64{f.RawMin, f.RawMax, f.EUMin, f.EUMax} {
+		if bound != nil {
+			set++
+		}
+	}
+	if set == 0 {
+		if f.ScaleClamp != "" {
+			return errors.New("scale_clamp needs raw_min, raw_max, eu_min and eu_max")
+		}
+		return nil
+	}
+	if set != 4 {
+		return errors.New("raw_min, raw_max, eu_min and eu_max must be set together")
+	}
+	if *f.RawMin == *f.RawMax {
+		return errors.New("raw_min and raw_max must differ")
+	}
+	if f.Type != "" && f.Type != "float" && f.Type != "int" {
+		return fmt.Errorf("scaling needs a float or int type, got %q", f.Type)
+	}
+	switch f.ScaleClamp {
+	case "", ScaleClampNone, ScaleClampLimit, ScaleClampBad:
+	default:
+		return fmt.Errorf("unknown scale_clamp %q", f.ScaleClamp)
+	}
+	return nil
 }
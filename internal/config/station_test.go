@@ -0,0 +1,122 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadStationAppliesNestedDefaults(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "station.yaml", `
+station_id: st1
+connections:
+  spool:
+    file:
+      dir: /var/spool/asutp
+device_templates:
+  - template:
+      id: "meter{n}"
+      fields:
+        - source: p
+          target: p
+    instances:
+      - {n: "1"}
+`)
+
+	cfg, err := LoadStation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := cfg.Connections["spool"]
+	if conn.Adapter != "energy_api" || conn.Timeout != 10*time.Second || conn.File.AfterRead != "keep" {
+		t.Fatalf("connection defaults not applied: adapter %q, timeout %s, after_read %q",
+			conn.Adapter, conn.Timeout, conn.File.AfterRead)
+	}
+	if len(cfg.Devices) != 1 || cfg.Devices[0].Fields[0].Type != "float" {
+		t.Fatalf("template field defaults not applied: %+v", cfg.Devices)
+	}
+}
+
+func TestLoadStationRejectsUnknownOverlapPolicy(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "station.yaml", `
+station_id: st1
+polling:
+  overlap_policy: wait
+`)
+
+	if _, err := LoadStation(path); err == nil || !strings.Contains(err.Error(), "overlap policy") {
+		t.Fatalf("LoadStation error = %v, want an overlap policy error", err)
+	}
+}
+
+func TestLoadStationConvertsFieldDefaults(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "station.yaml", `
+station_id: st1
+devices:
+  - id: meter1
+    fields:
+      - source: p
+        target: p
+        default: "1.5"
+`)
+
+	cfg, err := LoadStation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ok := cfg.Devices[0].Fields[0].DefaultValue()
+	if f, isFloat := value.Float(); !ok || !isFloat || f != 1.5 {
+		t.Fatalf("DefaultValue() = %v, %t, want 1.5", value, ok)
+	}
+}
+
+func TestLoadStationRejectsUnconvertibleDefault(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "station.yaml", `
+station_id: st1
+devices:
+  - id: meter1
+    fields:
+      - source: p
+        target: p
+        type: int
+        default: n/a
+`)
+
+	if _, err := LoadStation(path); err == nil || !strings.Contains(err.Error(), "default") {
+		t.Fatalf("LoadStation error = %v, want a default conversion error", err)
+	}
+}
+
+func TestLoadStationCompilesExpressions(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "station.yaml", `
+station_id: st1
+devices:
+  - id: meter1
+    fields:
+      - source: p
+        target: p
+        expression: value * 2
+`)
+
+	cfg, err := LoadStation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Devices[0].Fields[0].Program() == nil {
+		t.Fatal("expression was not compiled at load")
+	}
+
+	bad := writeFile(t, t.TempDir(), "station.yaml", `
+station_id: st1
+devices:
+  - id: meter1
+    fields:
+      - source: p
+        target: p
+        expression: value *
+`)
+	if _, err := LoadStation(bad); err == nil {
+		t.Fatal("LoadStation accepted an expression with a syntax error")
+	}
+}
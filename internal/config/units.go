@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// quantityUnits lists the units accepted for each physical quantity.
+var quantityUnits = map[string][]string{
+	"voltage":         {"V", "kV", "mV"},
+	"current":         {"A", "kA", "mA"},
+	"active_power":    {"W", "kW", "MW"},
+	"reactive_power":  {"var", "kvar", "Mvar"},
+	"apparent_power":  {"VA", "kVA", "MVA"},
+	"energy":          {"Wh", "kWh", "MWh", "GWh"},
+	"reactive_energy": {"varh", "kvarh", "Mvarh"},
+	"frequency":       {"Hz"},
+	"temperature":     {"°C", "C", "K"},
+	"power_factor":    {""},
+	"pressure":        {"Pa", "kPa", "MPa", "bar"},
+	"flow":            {"m3/s", "m3/h", "l/s"},
+	"level":           {"m", "cm", "mm"},
+	"speed":           {"rpm"},
+}
+
+// UnitWarnings reports fields whose unit does not fit their declared quantity.
+// They are warnings rather than errors since upstream units vary by vendor.
+func (c *StationConfig) UnitWarnings() []string {
+	var warnings []string
+	for _, d := range c.Devices {
+		for _, f := range d.Fields {
+			if f.Quantity == "" {
+				continue
+			}
+			units, ok := quantityUnits[f.Quantity]
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("device %s field %s: unknown quantity %q", d.ID, f.Target, f.Quantity))
+				continue
+			}
+			if f.Unit == "" && f.UnitSource != "" {
+				continue
+			}
+			if !slices.Contains(units, f.Unit) {
+				warnings = append(warnings, fmt.Sprintf("device %s field %s: unit %q is not a unit of %s", d.ID, f.Target, f.Unit, f.Quantity))
+			}
+		}
+	}
+	return warnings
+}
+
+// UnitFits reports whether unit is plausible for quantity. Unknown or empty
+// quantities accept any unit.
+func UnitFits(quantity, unit string) bool {
+	units, ok := quantityUnits[quantity]
+	return !ok || slices.Contains(units, unit)
+}
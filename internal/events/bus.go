@@ -0,0 +1,120 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+type Level string
+
+const (
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warn"
+	LevelError Level = "error"
+)
+
+// Kinds of events published by the collector.
+const (
+	KindCollectFailed = "collect_failed"
+	KindSendFailed    = "send_failed"
+	KindBufferFailed  = "buffer_failed"
+	KindBufferEvicted = "buffer_evicted"
+	KindWatchdog      = "watchdog"
+	KindBackfill      = "backfill"
+)
+
+type Event struct {
+	Time     time.Time `json:"time"`
+	Level    Level     `json:"level"`
+	Kind     string    `json:"kind"`
+	DeviceID string    `json:"device_id,omitempty"`
+	Message  string    `json:"message"`
+}
+
+// Bus keeps a bounded ring of recent events and fans them out to
+// subscribers. A nil *Bus is valid and drops all events, so components can
+// publish unconditionally.
+type Bus struct {
+	mu          sync.RWMutex
+	size        int
+	events      []Event
+	subscribers []func(Event)
+}
+
+func NewBus(size int) *Bus {
+	return &Bus{
+		size:   size,
+		events: make([]Event, 0, size),
+	}
+}
+
+// Subscribe registers fn to be called synchronously for every published
+// event. fn must not block.
+func (b *Bus) Subscribe(fn func(Event)) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+func (b *Bus) Publish(level Level, kind, deviceID, message string) {
+	if b == nil {
+		return
+	}
+
+	e := Event{
+		Time:     time.Now().UTC(),
+		Level:    level,
+		Kind:     kind,
+		DeviceID: deviceID,
+		Message:  message,
+	}
+
+	b.mu.Lock()
+	if b.size > 0 {
+		if len(b.events) >= b.size {
+			b.events = append(b.events[:0], b.events[1:]...)
+		}
+		b.events = append(b.events, e)
+	}
+	subscribers := b.subscribers
+	b.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(e)
+	}
+}
+
+// Recent returns events newer than since with at least the given level,
+// oldest first. An empty level matches all events.
+func (b *Bus) Recent(since time.Time, level Level) []Event {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	min := severity(level)
+	out := make([]Event, 0, len(b.events))
+	for _, e := range b.events {
+		if e.Time.Before(since) || severity(e.Level) < min {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func severity(level Level) int {
+	switch level {
+	case LevelWarn:
+		return 1
+	case LevelError:
+		return 2
+	default:
+		return 0
+	}
+}
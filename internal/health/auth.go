@@ -0,0 +1,88 @@
+package health
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const unauthorizedLogInterval = 10 * time.Second
+
+// authenticator checks bearer token or basic auth credentials and logs
+// rejected requests at most once per unauthorizedLogInterval.
+type authenticator struct {
+	log      *slog.Logger
+	token    string
+	username string
+	password string
+
+	mu         sync.Mutex
+	lastLog    time.Time
+	suppressed int
+}
+
+func (a *authenticator) enabled() bool {
+	return a.token != "" || a.username != ""
+}
+
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.enabled() || a.authorized(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		a.logRejected(r)
+
+		if a.username != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="asutp"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func (a *authenticator) authorized(r *http.Request) bool {
+	if a.token != "" {
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			if subtle.ConstantTimeCompare([]byte(bearer), []byte(a.token)) == 1 {
+				return true
+			}
+		}
+	}
+
+	if a.username != "" {
+		if user, pass, ok := r.BasicAuth(); ok {
+			userOK := subtle.ConstantTimeCompare([]byte(user), []byte(a.username)) == 1
+			passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(a.password)) == 1
+			if userOK && passOK {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (a *authenticator) logRejected(r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(a.lastLog) < unauthorizedLogInterval {
+		a.suppressed++
+		return
+	}
+
+	a.log.Warn("unauthorized request",
+		slog.String("path", r.URL.Path),
+		slog.String("remote_addr", r.RemoteAddr),
+		slog.Int("suppressed", a.suppressed),
+	)
+	a.lastLog = now
+	a.suppressed = 0
+}
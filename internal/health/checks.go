@@ -0,0 +1,75 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type checkResult struct {
+	status  Status
+	message string
+	latency time.Duration
+}
+
+// runChecks runs all checkers concurrently, each with its own timeout, and
+// returns results in checker order.
+func (s *Server) runChecks(ctx context.Context, checkers []HealthChecker) []checkResult {
+	results := make([]checkResult, len(checkers))
+
+	var wg sync.WaitGroup
+	for i, checker := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started := time.Now()
+			results[i] = s.runCheck(ctx, checker)
+			results[i].latency = time.Since(started)
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runCheck runs a single checker with its timeout. A timeout is reported as
+// degraded and a panic as unhealthy.
+func (s *Server) runCheck(ctx context.Context, checker HealthChecker) checkResult {
+	timeout := s.checkTimeout(checker.Name())
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan checkResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.log.Error("health checker panicked",
+					slog.String("checker", checker.Name()),
+					slog.Any("panic", r),
+				)
+				done <- checkResult{status: StatusUnhealthy, message: fmt.Sprintf("check panicked: %v", r)}
+			}
+		}()
+		status, message := checker.Check(ctx)
+		done <- checkResult{status: status, message: message}
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		return checkResult{status: StatusDegraded, message: "check timed out"}
+	}
+}
+
+func (s *Server) checkTimeout(name string) time.Duration {
+	if timeout, ok := s.cfg.CheckTimeouts[name]; ok && timeout > 0 {
+		return timeout
+	}
+	if s.cfg.CheckTimeout > 0 {
+		return s.cfg.CheckTimeout
+	}
+	return 2 * time.Second
+}
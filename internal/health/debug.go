@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type runtimeStats struct {
+	Uptime       string    `json:"uptime"`
+	StartedAt    time.Time `json:"started_at"`
+	Goroutines   int       `json:"goroutines"`
+	HeapAlloc    uint64    `json:"heap_alloc_bytes"`
+	HeapInuse    uint64    `json:"heap_inuse_bytes"`
+	HeapObjects  uint64    `json:"heap_objects"`
+	Sys          uint64    `json:"sys_bytes"`
+	NumGC        uint32    `json:"num_gc"`
+	LastGCPause  string    `json:"last_gc_pause"`
+	TotalGCPause string    `json:"total_gc_pause"`
+	GOMAXPROCS   int       `json:"gomaxprocs"`
+	GoVersion    string    `json:"go_version"`
+}
+
+func (s *Server) mountDebug(r chi.Router) {
+	r.Get("/debug/runtime", s.handleRuntime)
+
+	r.HandleFunc("/debug/pprof/", pprof.Index)
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", sampling(pprof.Profile, 30))
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", sampling(pprof.Trace, 1))
+	r.Handle("/debug/pprof/{profile}", http.HandlerFunc(pprof.Index))
+}
+
+// maxSampleSeconds caps the duration of CPU profiles and traces.
+const maxSampleSeconds = 60
+
+// sampling wraps a pprof handler that records for the "seconds" query
+// parameter, defaultSeconds when absent. The duration is capped at
+// maxSampleSeconds and the write deadline extended past it, since the
+// server's write timeout is shorter than a typical profile.
+func sampling(h http.HandlerFunc, defaultSeconds int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+		if err != nil || seconds <= 0 {
+			seconds = defaultSeconds
+		}
+		if seconds > maxSampleSeconds {
+			seconds = maxSampleSeconds
+			query := r.URL.Query()
+			query.Set("seconds", strconv.Itoa(seconds))
+			r.URL.RawQuery = query.Encode()
+		}
+
+		deadline := time.Now().Add(time.Duration(seconds)*time.Second + writeTimeout)
+		if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+			http.Error(w, "cannot extend write deadline: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) handleRuntime(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var lastPause time.Duration
+	if mem.NumGC > 0 {
+		lastPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+	}
+
+	stats := runtimeStats{
+		Uptime:       time.Since(s.startedAt).Round(time.Second).String(),
+		StartedAt:    s.startedAt.UTC(),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    mem.HeapAlloc,
+		HeapInuse:    mem.HeapInuse,
+		HeapObjects:  mem.HeapObjects,
+		Sys:          mem.Sys,
+		NumGC:        mem.NumGC,
+		LastGCPause:  lastPause.String(),
+		TotalGCPause: time.Duration(mem.PauseTotalNs).String(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		GoVersion:    runtime.Version(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GoroutineHealthChecker degrades when the goroutine count exceeds a ceiling,
+// making leaks visible before they exhaust memory.
+type GoroutineHealthChecker struct {
+	ceiling int
+}
+
+func NewGoroutineHealthChecker(ceiling int) *GoroutineHealthChecker {
+	return &GoroutineHealthChecker{ceiling: ceiling}
+}
+
+func (c *GoroutineHealthChecker) Name() string {
+	return "goroutines"
+}
+
+func (c *GoroutineHealthChecker) Check(ctx context.Context) (Status, string) {
+	count := runtime.NumGoroutine()
+	if count > c.ceiling {
+		return StatusDegraded, fmt.Sprintf("goroutine count %d exceeds %d", count, c.ceiling)
+	}
+	return StatusHealthy, ""
+}
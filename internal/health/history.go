@@ -0,0 +1,107 @@
+package health
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type Transition struct {
+	Timestamp time.Time `json:"timestamp"`
+	Component string    `json:"component"`
+	From      Status    `json:"from"`
+	To        Status    `json:"to"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// history keeps a bounded ring of component state transitions.
+type history struct {
+	log        *slog.Logger
+	size       int
+	retention  time.Duration
+	mu         sync.Mutex
+	entries    []Transition
+	last       map[string]Status
+	lastChange map[string]time.Time
+}
+
+func newHistory(log *slog.Logger, size int, retention time.Duration) *history {
+	return &history{
+		log:        log,
+		size:       size,
+		retention:  retention,
+		entries:    make([]Transition, 0, size),
+		last:       make(map[string]Status),
+		lastChange: make(map[string]time.Time),
+	}
+}
+
+// observe records the component status and returns the time of its last
+// transition. The first observation of a component is not a transition.
+func (h *history) observe(component string, status Status, message string, now time.Time) time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	prev, seen := h.last[component]
+	if !seen {
+		h.last[component] = status
+		h.lastChange[component] = now
+		return now
+	}
+
+	if prev == status {
+		return h.lastChange[component]
+	}
+
+	h.last[component] = status
+	h.lastChange[component] = now
+
+	h.log.Info("health state changed",
+		slog.String("component", component),
+		slog.String("from", string(prev)),
+		slog.String("to", string(status)),
+		slog.String("message", message),
+	)
+
+	if h.size <= 0 {
+		return now
+	}
+
+	if len(h.entries) >= h.size {
+		h.entries = append(h.entries[:0], h.entries[1:]...)
+	}
+	h.entries = append(h.entries, Transition{
+		Timestamp: now,
+		Component: component,
+		From:      prev,
+		To:        status,
+		Message:   message,
+	})
+	h.prune(now)
+
+	return now
+}
+
+func (h *history) list(now time.Time) []Transition {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.prune(now)
+	out := make([]Transition, len(h.entries))
+	copy(out, h.entries)
+	return out
+}
+
+func (h *history) prune(now time.Time) {
+	if h.retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-h.retention)
+	i := 0
+	for i < len(h.entries) && h.entries[i].Timestamp.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		h.entries = append(h.entries[:0], h.entries[i:]...)
+	}
+}
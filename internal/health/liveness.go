@@ -0,0 +1,102 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Heartbeat is the last recorded progress of an internal loop.
+type Heartbeat struct {
+	Name   string
+	Last   time.Time
+	MaxAge time.Duration
+}
+
+type heartbeatStatus struct {
+	Name      string    `json:"name"`
+	Last      time.Time `json:"last"`
+	Staleness string    `json:"staleness"`
+	MaxAge    string    `json:"max_age"`
+	Stale     bool      `json:"stale"`
+}
+
+type livenessResponse struct {
+	Alive bool              `json:"alive"`
+	Loops []heartbeatStatus `json:"loops"`
+}
+
+// SetHeartbeatFunc registers the source of loop heartbeats checked by /live.
+func (s *Server) SetHeartbeatFunc(heartbeats func() []Heartbeat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeats = heartbeats
+}
+
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	heartbeats := s.heartbeats
+	s.mu.RUnlock()
+
+	if heartbeats == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+		return
+	}
+
+	now := time.Now()
+	response := livenessResponse{Alive: true}
+	for _, hb := range heartbeats() {
+		staleness := now.Sub(hb.Last)
+		stale := staleness > hb.MaxAge
+		if stale {
+			response.Alive = false
+		}
+		response.Loops = append(response.Loops, heartbeatStatus{
+			Name:      hb.Name,
+			Last:      hb.Last.UTC(),
+			Staleness: staleness.Round(time.Millisecond).String(),
+			MaxAge:    hb.MaxAge.String(),
+			Stale:     stale,
+		})
+	}
+
+	statusCode := http.StatusOK
+	if !response.Alive {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// WatchdogHealthChecker reports how long ago the last successful collection
+// was and how many times the watchdog intervened.
+type WatchdogHealthChecker struct {
+	statusFunc func() (lastSuccess time.Time, threshold time.Duration, resets int64)
+}
+
+func NewWatchdogHealthChecker(statusFunc func() (lastSuccess time.Time, threshold time.Duration, resets int64)) *WatchdogHealthChecker {
+	return &WatchdogHealthChecker{statusFunc: statusFunc}
+}
+
+func (c *WatchdogHealthChecker) Name() string {
+	return "watchdog"
+}
+
+func (c *WatchdogHealthChecker) Check(ctx context.Context) (Status, string) {
+	last, threshold, resets := c.statusFunc()
+	age := time.Since(last).Round(time.Second)
+
+	message := fmt.Sprintf("last success %s ago, resets=%d", age, resets)
+	switch {
+	case age > threshold:
+		return StatusUnhealthy, message
+	case age > threshold/2:
+		return StatusDegraded, message
+	}
+	return StatusHealthy, ""
+}
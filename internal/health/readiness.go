@@ -0,0 +1,56 @@
+package health
+
+import (
+	"sync"
+)
+
+const (
+	ReadinessConfig  = "config"
+	ReadinessCollect = "collect"
+	ReadinessSender  = "sender"
+)
+
+// Readiness tracks which readiness criteria have been satisfied. Once all
+// required criteria are met the service stays ready unless marked stalled.
+type Readiness struct {
+	mu        sync.RWMutex
+	required  []string
+	satisfied map[string]bool
+	stalled   bool
+}
+
+func NewReadiness(required []string) *Readiness {
+	return &Readiness{
+		required:  required,
+		satisfied: make(map[string]bool, len(required)),
+	}
+}
+
+func (r *Readiness) Mark(criterion string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.satisfied[criterion] = true
+}
+
+// SetStalled marks the service not ready while collection is stalled, even
+// once all criteria are met.
+func (r *Readiness) SetStalled(stalled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stalled = stalled
+}
+
+// Status reports whether the service is ready and which criteria are still
+// pending.
+func (r *Readiness) Status() (bool, []string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var pending []string
+	for _, c := range r.required {
+		if !r.satisfied[c] {
+			pending = append(pending, c)
+		}
+	}
+	return len(pending) == 0 && !r.stalled, pending
+}
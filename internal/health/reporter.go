@@ -0,0 +1,163 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/lib/tlsutil"
+)
+
+const (
+	reportMaxAttempts = 3
+	reportRetryDelay  = 2 * time.Second
+)
+
+type report struct {
+	StationID string         `json:"station_id"`
+	Health    HealthResponse `json:"health"`
+	Devices   any            `json:"devices,omitempty"`
+}
+
+// Reporter periodically pushes the health snapshot to the central platform.
+// It uses its own HTTP client and goroutine so it never competes with data
+// sending.
+type Reporter struct {
+	log       *slog.Logger
+	server    *Server
+	url       string
+	token     func() string
+	stationID string
+	interval  time.Duration
+	stats     func() any
+	client    *http.Client
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewReporter creates a reporter posting to cfg.URL. tlsCfg, when set, carries
+// the CA bundle configured for the platform. token is called for every report,
+// so a token rotated through the sender's token file is picked up.
+func NewReporter(log *slog.Logger, server *Server, cfg *config.HealthReportConfig, tlsCfg *tls.Config, token func() string, stationID string, stats func() any) *Reporter {
+	return &Reporter{
+		log:       log,
+		server:    server,
+		url:       cfg.URL,
+		token:     token,
+		stationID: stationID,
+		interval:  cfg.Interval,
+		stats:     stats,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: tlsutil.NewTransport(tlsCfg),
+		},
+		stopCh: make(chan struct{}),
+	}
+}
+
+func (r *Reporter) Start() {
+	r.log.Info("starting health reporter",
+		slog.String("url", r.url),
+		slog.Duration("interval", r.interval),
+	)
+
+	r.wg.Add(1)
+	go r.run()
+}
+
+func (r *Reporter) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+	r.client.CloseIdleConnections()
+}
+
+func (r *Reporter) run() {
+	defer r.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-r.stopCh
+		cancel()
+	}()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.report(ctx)
+		}
+	}
+}
+
+func (r *Reporter) report(ctx context.Context) {
+	payload := report{
+		StationID: r.stationID,
+		Health:    r.server.Snapshot(ctx),
+	}
+	if r.stats != nil {
+		payload.Devices = r.stats()
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		r.log.Error("failed to marshal health report", sl.Err(err))
+		return
+	}
+
+	for attempt := 1; attempt <= reportMaxAttempts; attempt++ {
+		err = r.post(ctx, data)
+		if err == nil {
+			return
+		}
+
+		if attempt < reportMaxAttempts {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reportRetryDelay):
+			}
+		}
+	}
+
+	r.log.Warn("failed to push health report", slog.Int("attempts", reportMaxAttempts), sl.Err(err))
+}
+
+func (r *Reporter) post(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if token := r.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+}
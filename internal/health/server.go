@@ -2,13 +2,20 @@ package health
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/events"
 	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
 )
 
@@ -21,9 +28,11 @@ const (
 )
 
 type ComponentHealth struct {
-	Name    string `json:"name"`
-	Status  Status `json:"status"`
-	Message string `json:"message,omitempty"`
+	Name           string    `json:"name"`
+	Status         Status    `json:"status"`
+	Message        string    `json:"message,omitempty"`
+	Latency        string    `json:"latency"`
+	LastTransition time.Time `json:"last_transition"`
 }
 
 type HealthResponse struct {
@@ -32,24 +41,74 @@ type HealthResponse struct {
 	Timestamp  time.Time         `json:"timestamp"`
 }
 
+const (
+	readTimeout  = 5 * time.Second
+	writeTimeout = 10 * time.Second
+
+	// handlerTimeout bounds synchronous admin work, so its response is
+	// written before the write timeout cuts the connection.
+	handlerTimeout = writeTimeout - time.Second
+)
+
+// ErrBind is returned by Start when a health server address cannot be
+// bound, e.g. because the port is already in use.
+var ErrBind = errors.New("failed to bind health server")
+
 type HealthChecker interface {
 	Name() string
 	Check(ctx context.Context) (Status, string)
 }
 
 type Server struct {
-	log      *slog.Logger
-	address  string
-	server   *http.Server
-	checkers []HealthChecker
-	mu       sync.RWMutex
+	log        *slog.Logger
+	address    string
+	cfg        *config.HealthConfig
+	auth       *authenticator
+	servers    []*http.Server
+	checkers   []HealthChecker
+	history    *history
+	ready      *Readiness
+	flush      func(ctx context.Context) (int, error)
+	drain      func(ctx context.Context) (int, error)
+	heartbeats func() []Heartbeat
+	collect    CollectFunc
+	selfTest   SelfTestFunc
+	info       any
+	stats      func() any
+	events     *events.Bus
+	startedAt  time.Time
+	draining   atomic.Bool
+	drainBusy  atomic.Bool
+	mu         sync.RWMutex
+
+	// background outlives requests for work answered with 202, and is
+	// cancelled by Stop.
+	background       context.Context
+	cancelBackground context.CancelFunc
+
+	snapshotMu sync.Mutex
+	cached     *HealthResponse
+	cachedAt   time.Time
 }
 
-func NewServer(log *slog.Logger, address string) *Server {
+func NewServer(log *slog.Logger, cfg *config.HealthConfig) *Server {
+	background, cancel := context.WithCancel(context.Background())
 	return &Server{
-		log:      log,
-		address:  address,
-		checkers: make([]HealthChecker, 0),
+		log:     log,
+		address: cfg.Address,
+		cfg:     cfg,
+		auth: &authenticator{
+			log:      log,
+			token:    cfg.Auth.Token,
+			username: cfg.Auth.Username,
+			password: cfg.Auth.Password,
+		},
+		checkers:  make([]HealthChecker, 0),
+		startedAt: time.Now(),
+		history:   newHistory(log, cfg.HistorySize, cfg.HistoryRetention),
+
+		background:       background,
+		cancelBackground: cancel,
 	}
 }
 
@@ -59,25 +118,177 @@ func (s *Server) AddChecker(checker HealthChecker) {
 	s.checkers = append(s.checkers, checker)
 }
 
+func (s *Server) SetReadiness(ready *Readiness) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = ready
+}
+
+// SetFlushFunc registers the function invoked by POST /flush.
+func (s *Server) SetFlushFunc(flush func(ctx context.Context) (int, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush = flush
+}
+
+// SetDrainFunc registers the function invoked by POST /drain.
+func (s *Server) SetDrainFunc(drain func(ctx context.Context) (int, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drain = drain
+}
+
+// SetEventBus registers the event bus served at GET /events, an admin route.
+func (s *Server) SetEventBus(bus *events.Bus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = bus
+}
+
+// SetInfo registers the build and station identity served at GET /info.
+func (s *Server) SetInfo(info any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.info = info
+}
+
+// CollectFunc collects a single device on demand. found is false when the
+// device is not configured.
+type CollectFunc func(ctx context.Context, deviceID string) (result any, found bool, err error)
+
+// SetCollectFunc registers the function invoked by GET /collect/{device_id}.
+func (s *Server) SetCollectFunc(collect CollectFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collect = collect
+}
+
 func (s *Server) Start() error {
-	r := chi.NewRouter()
+	var tlsCfg *tls.Config
+	if s.cfg.TLS.CertFile != "" || s.cfg.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load health server certificate: %w", err)
+		}
+		tlsCfg = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	public := chi.NewRouter()
+	s.mountPublic(public)
+
+	shared := s.cfg.AdminAddress == "" || s.cfg.AdminAddress == s.address
+	adminAddress := s.cfg.AdminAddress
+	if shared {
+		adminAddress = s.address
+	}
+
+	// Without auth the admin routes are only served on a loopback address.
+	if !s.auth.enabled() && !isLoopback(adminAddress) {
+		s.log.Warn("health server auth is not configured, admin routes are disabled; configure auth or bind admin_address to localhost",
+			slog.String("admin_address", adminAddress),
+		)
+		return s.listen(s.address, public, tlsCfg)
+	}
+
+	if shared {
+		public.Group(s.mountAdmin)
+		return s.listen(s.address, public, tlsCfg)
+	}
+
+	admin := chi.NewRouter()
+	admin.Group(s.mountAdmin)
+
+	if err := s.listen(s.address, public, tlsCfg); err != nil {
+		return err
+	}
+	if err := s.listen(s.cfg.AdminAddress, admin, tlsCfg); err != nil {
+		s.Stop(context.Background())
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) mountPublic(r chi.Router) {
+	if s.cfg.Auth.PublicLive {
+		r.Get("/live", s.handleLive)
+	}
+
+	r.Group(func(r chi.Router) {
+		if s.cfg.Auth.ProtectReadOnly {
+			r.Use(s.auth.middleware)
+		}
+		r.Get("/health", s.handleHealth)
+		r.Get("/health/history", s.handleHistory)
+		r.Get("/ready", s.handleReady)
+		r.Get("/info", s.handleInfo)
+		if !s.cfg.Auth.PublicLive {
+			r.Get("/live", s.handleLive)
+		}
+	})
+}
+
+func (s *Server) mountAdmin(r chi.Router) {
+	r.Use(s.auth.middleware)
+	r.Get("/stats", s.handleStats)
+	r.Get("/events", s.handleEvents)
+	r.Post("/flush", s.handleFlush)
+	r.Post("/drain", s.handleDrain)
+	r.Get("/collect/{device_id}", s.handleCollect)
+	r.Post("/selftest", s.handleSelfTest)
+
+	if s.cfg.DebugEnabled {
+		s.mountDebug(r)
+	}
+}
+
+// isLoopback reports whether address binds only a loopback interface.
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
 
-	r.Get("/health", s.handleHealth)
-	r.Get("/ready", s.handleReady)
-	r.Get("/live", s.handleLive)
+// listen binds address before serving in the background, so a port already
+// in use is reported to the caller instead of only being logged.
+func (s *Server) listen(address string, handler http.Handler, tlsCfg *tls.Config) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrBind, address, err)
+	}
 
-	s.server = &http.Server{
-		Addr:         s.address,
-		Handler:      r,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	server := &http.Server{
+		Addr:         address,
+		Handler:      handler,
+		TLSConfig:    tlsCfg,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
 	}
+	s.servers = append(s.servers, server)
 
-	s.log.Info("starting health server", slog.String("address", s.address))
+	s.log.Info("starting health server",
+		slog.String("address", address),
+		slog.Bool("tls", tlsCfg != nil),
+	)
 
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			s.log.Error("health server error", sl.Err(err))
+		var err error
+		if tlsCfg != nil {
+			err = server.ServeTLS(ln, "", "")
+		} else {
+			err = server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			s.log.Error("health server error", slog.String("address", address), sl.Err(err))
 		}
 	}()
 
@@ -85,33 +296,70 @@ func (s *Server) Start() error {
 }
 
 func (s *Server) Stop(ctx context.Context) error {
-	if s.server == nil {
-		return nil
+	s.cancelBackground()
+	var errs []error
+	for _, server := range s.servers {
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return s.server.Shutdown(ctx)
+	return errors.Join(errs...)
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	response := s.Snapshot(r.Context())
+
+	statusCode := http.StatusOK
+	if response.Status == StatusUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Snapshot returns the aggregated checker results, reusing a result younger
+// than the configured cache TTL so frequent probes don't re-run every check.
+// Concurrent callers wait for a single in-flight evaluation.
+func (s *Server) Snapshot(ctx context.Context) HealthResponse {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	if s.cached != nil && s.cfg.CacheTTL > 0 && time.Since(s.cachedAt) < s.cfg.CacheTTL {
+		return *s.cached
+	}
+
+	response := s.evaluate(ctx)
+	s.cached = &response
+	s.cachedAt = time.Now()
+	return response
+}
+
+// evaluate runs all checkers and aggregates their results.
+func (s *Server) evaluate(ctx context.Context) HealthResponse {
 	s.mu.RLock()
 	checkers := make([]HealthChecker, len(s.checkers))
 	copy(checkers, s.checkers)
 	s.mu.RUnlock()
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
-
 	response := HealthResponse{
 		Status:     StatusHealthy,
 		Components: make([]ComponentHealth, 0, len(checkers)),
 		Timestamp:  time.Now().UTC(),
 	}
 
-	for _, checker := range checkers {
-		status, message := checker.Check(ctx)
+	results := s.runChecks(ctx, checkers)
+
+	for i, checker := range checkers {
+		status, message := results[i].status, results[i].message
+		lastTransition := s.history.observe(checker.Name(), status, message, time.Now().UTC())
 		response.Components = append(response.Components, ComponentHealth{
-			Name:    checker.Name(),
-			Status:  status,
-			Message: message,
+			Name:           checker.Name(),
+			Status:         status,
+			Message:        message,
+			Latency:        results[i].latency.Round(time.Microsecond).String(),
+			LastTransition: lastTransition,
 		})
 
 		if status == StatusUnhealthy {
@@ -121,51 +369,381 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	return response
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.history.list(time.Now().UTC()))
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	info := s.info
+	s.mu.RUnlock()
+
+	if info == nil {
+		http.Error(w, "info not available", http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// SetStatsFunc registers the provider of the /stats payload, an admin route
+// since it exposes device and sender details.
+func (s *Server) SetStatsFunc(stats func() any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = stats
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	stats := s.stats
+	s.mu.RUnlock()
+
+	if stats == nil {
+		http.Error(w, "stats not available", http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats())
+}
+
+// handleEvents returns recent events. since accepts an RFC3339 time or a
+// duration such as 1h; level filters to events at or above that level.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	bus := s.events
+	s.mu.RUnlock()
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			since = t
+		} else {
+			http.Error(w, "invalid since: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+
+	level := events.Level(r.URL.Query().Get("level"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bus.Recent(since, level))
+}
+
+func (s *Server) handleFlush(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	flush := s.flush
+	s.mu.RUnlock()
+
+	if flush == nil {
+		http.Error(w, "flush not available", http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), handlerTimeout)
+	defer cancel()
+
+	drained, err := flush(ctx)
+
+	response := map[string]any{"drained": drained}
 	statusCode := http.StatusOK
-	if response.Status == StatusUnhealthy {
-		statusCode = http.StatusServiceUnavailable
+	if err != nil {
+		response["error"] = err.Error()
+		statusCode = http.StatusInternalServerError
 	}
 
+	s.log.Info("buffer flush requested via http", slog.Int("drained", drained))
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(response)
 }
 
-func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+// handleDrain starts sending buffered data in the background until the
+// buffer is empty or the timeout, given as ?timeout=30s or defaulting to
+// DrainTimeout, expires. The drain outlives the write timeout, so it answers
+// 202 right away and logs the result; a second drain while one runs gets 409.
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	drain := s.drain
+	s.mu.RUnlock()
+
+	if drain == nil {
+		http.Error(w, "drain not available", http.StatusNotImplemented)
+		return
+	}
+
+	timeout := s.cfg.DrainTimeout
+	if raw := r.URL.Query().Get("timeout"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = parsed
+	}
+
+	if !s.drainBusy.CompareAndSwap(false, true) {
+		http.Error(w, "drain already running", http.StatusConflict)
+		return
+	}
+
+	s.log.Info("buffer drain requested via http", slog.Duration("timeout", timeout))
+
+	go func() {
+		defer s.drainBusy.Store(false)
+
+		ctx, cancel := context.WithTimeout(s.background, timeout)
+		defer cancel()
+
+		started := time.Now()
+		sent, err := drain(ctx)
+		attrs := []any{
+			slog.Int("sent", sent),
+			slog.Duration("elapsed", time.Since(started)),
+			slog.Bool("timed_out", errors.Is(err, context.DeadlineExceeded)),
+		}
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			s.log.Error("buffer drain failed", append(attrs, sl.Err(err))...)
+			return
+		}
+		s.log.Info("buffer drain finished", attrs...)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{"started": true, "timeout": timeout.String()})
 }
 
-func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleCollect(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	collect := s.collect
+	s.mu.RUnlock()
+
+	if collect == nil {
+		http.Error(w, "collect not available", http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), handlerTimeout)
+	defer cancel()
+
+	deviceID := chi.URLParam(r, "device_id")
+	result, found, err := collect(ctx, deviceID)
+	if !found {
+		http.Error(w, "device not found: "+deviceID, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// SelfTestFunc runs a pipeline self-test over the given devices, all when
+// empty, optionally exercising the buffer.
+type SelfTestFunc func(ctx context.Context, deviceIDs []string, checkBuffer bool) (report any, ok bool, err error)
+
+// SetSelfTestFunc registers the function invoked by POST /selftest.
+func (s *Server) SetSelfTestFunc(selfTest SelfTestFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.selfTest = selfTest
+}
+
+// handleSelfTest runs the self-test. The optional JSON body selects devices
+// and the buffer check: {"devices": ["id"], "buffer": true}.
+func (s *Server) handleSelfTest(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	selfTest := s.selfTest
+	s.mu.RUnlock()
+
+	if selfTest == nil {
+		http.Error(w, "selftest not available", http.StatusNotImplemented)
+		return
+	}
+
+	var req struct {
+		Devices []string `json:"devices"`
+		Buffer  bool     `json:"buffer"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), handlerTimeout)
+	defer cancel()
+
+	report, ok, err := selfTest(ctx, req.Devices, req.Buffer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// SetDraining marks the collector as shutting down: /ready starts failing so
+// load balancers stop routing to it, while /health and /live keep answering
+// until Stop.
+func (s *Server) SetDraining() {
+	if !s.draining.Swap(true) {
+		s.log.Info("health server draining")
+	}
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.mu.RLock()
+	ready := s.ready
+	s.mu.RUnlock()
+
+	if ready != nil {
+		if ok, pending := ready.Status(); !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]any{
+				"ready":   false,
+				"pending": pending,
+			})
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
+// SenderHealthChecker reports the sender probe result. healthFunc returns the
+// age of a cached probe result, 0 for a fresh probe.
 type SenderHealthChecker struct {
-	healthFunc func(ctx context.Context) error
+	name       string
+	healthFunc func(ctx context.Context) (time.Duration, error)
 }
 
-func NewSenderHealthChecker(healthFunc func(ctx context.Context) error) *SenderHealthChecker {
-	return &SenderHealthChecker{healthFunc: healthFunc}
+func NewSenderHealthChecker(name string, healthFunc func(ctx context.Context) (time.Duration, error)) *SenderHealthChecker {
+	return &SenderHealthChecker{name: name, healthFunc: healthFunc}
 }
 
 func (c *SenderHealthChecker) Name() string {
-	return "sender"
+	return c.name
 }
 
 func (c *SenderHealthChecker) Check(ctx context.Context) (Status, string) {
-	if err := c.healthFunc(ctx); err != nil {
+	age, err := c.healthFunc(ctx)
+
+	var cached string
+	if age > 0 {
+		cached = fmt.Sprintf("cached %s ago", age.Round(time.Second))
+	}
+
+	if err != nil {
+		if cached != "" {
+			return StatusDegraded, fmt.Sprintf("%s (%s)", err, cached)
+		}
 		return StatusDegraded, err.Error()
 	}
+	return StatusHealthy, cached
+}
+
+// AdapterHealthChecker reports whether a collector can reach its source.
+type AdapterHealthChecker struct {
+	name      string
+	probeFunc func(ctx context.Context) error
+}
+
+func NewAdapterHealthChecker(name string, probeFunc func(ctx context.Context) error) *AdapterHealthChecker {
+	return &AdapterHealthChecker{name: name, probeFunc: probeFunc}
+}
+
+func (c *AdapterHealthChecker) Name() string {
+	return c.name
+}
+
+func (c *AdapterHealthChecker) Check(ctx context.Context) (Status, string) {
+	if err := c.probeFunc(ctx); err != nil {
+		return StatusUnhealthy, err.Error()
+	}
 	return StatusHealthy, ""
 }
 
+// CollectRatioHealthChecker judges adapter connectivity from the last
+// cycle's device collection results for adapters that cannot be probed: all
+// devices failing is unhealthy, some failing is degraded.
+type CollectRatioHealthChecker struct {
+	ratioFunc func() (succeeded, attempted int64)
+}
+
+func NewCollectRatioHealthChecker(ratioFunc func() (succeeded, attempted int64)) *CollectRatioHealthChecker {
+	return &CollectRatioHealthChecker{ratioFunc: ratioFunc}
+}
+
+func (c *CollectRatioHealthChecker) Name() string {
+	return "collection"
+}
+
+func (c *CollectRatioHealthChecker) Check(ctx context.Context) (Status, string) {
+	succeeded, attempted := c.ratioFunc()
+	if attempted == 0 {
+		return StatusHealthy, ""
+	}
+
+	message := fmt.Sprintf("%d of %d devices collected", succeeded, attempted)
+	switch {
+	case succeeded == 0:
+		return StatusUnhealthy, message
+	case succeeded < attempted:
+		return StatusDegraded, message
+	}
+	return StatusHealthy, ""
+}
+
+// BufferHealthChecker degrades when the buffer holds too many pending
+// envelopes or the oldest one exceeds the degraded age, and reports unhealthy
+// past the unhealthy age.
 type BufferHealthChecker struct {
-	countFunc func(ctx context.Context) (int64, error)
+	countFunc    func(ctx context.Context) (int64, error)
+	ageFunc      func(ctx context.Context) (time.Duration, error)
+	maxCount     int64
+	degradedAge  time.Duration
+	unhealthyAge time.Duration
 }
 
-func NewBufferHealthChecker(countFunc func(ctx context.Context) (int64, error)) *BufferHealthChecker {
-	return &BufferHealthChecker{countFunc: countFunc}
+func NewBufferHealthChecker(
+	countFunc func(ctx context.Context) (int64, error),
+	ageFunc func(ctx context.Context) (time.Duration, error),
+	cfg *config.BufferConfig,
+) *BufferHealthChecker {
+	return &BufferHealthChecker{
+		countFunc:    countFunc,
+		ageFunc:      ageFunc,
+		maxCount:     cfg.HealthMaxCount,
+		degradedAge:  cfg.HealthDegradedAge,
+		unhealthyAge: cfg.HealthUnhealthyAge,
+	}
 }
 
 func (c *BufferHealthChecker) Name() string {
@@ -178,8 +756,20 @@ func (c *BufferHealthChecker) Check(ctx context.Context) (Status, string) {
 		return StatusUnhealthy, err.Error()
 	}
 
-	if count > 1000 {
-		return StatusDegraded, "high buffer count"
+	age, err := c.ageFunc(ctx)
+	if err != nil {
+		return StatusUnhealthy, err.Error()
+	}
+
+	message := fmt.Sprintf("pending=%d oldest_age=%s", count, age.Round(time.Second))
+
+	switch {
+	case c.unhealthyAge > 0 && age > c.unhealthyAge:
+		return StatusUnhealthy, "oldest pending envelope too old: " + message
+	case c.degradedAge > 0 && age > c.degradedAge:
+		return StatusDegraded, "oldest pending envelope aging: " + message
+	case c.maxCount > 0 && count > c.maxCount:
+		return StatusDegraded, "high buffer count: " + message
 	}
 
 	return StatusHealthy, ""
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+)
+
+// SystemStats is a point-in-time view of host resources.
+type SystemStats struct {
+	DiskPath        string  `json:"disk_path"`
+	DiskTotalBytes  uint64  `json:"disk_total_bytes"`
+	DiskFreeBytes   uint64  `json:"disk_free_bytes"`
+	MemTotalBytes   uint64  `json:"mem_total_bytes"`
+	MemAvailBytes   uint64  `json:"mem_available_bytes"`
+	Load1           float64 `json:"load1"`
+	DiskFreePercent float64 `json:"disk_free_percent"`
+	MemFreePercent  float64 `json:"mem_free_percent"`
+}
+
+// SystemHealthChecker watches free disk space on the filesystem holding path,
+// free memory and, optionally, the 1-minute load average.
+type SystemHealthChecker struct {
+	path string
+	cfg  *config.SystemHealthConfig
+}
+
+func NewSystemHealthChecker(path string, cfg *config.SystemHealthConfig) *SystemHealthChecker {
+	return &SystemHealthChecker{path: path, cfg: cfg}
+}
+
+func (c *SystemHealthChecker) Name() string {
+	return "system"
+}
+
+// Stats reads the current host resource usage.
+func (c *SystemHealthChecker) Stats() (SystemStats, error) {
+	stats, err := readSystemStats(c.path)
+	if err != nil {
+		return stats, err
+	}
+	if stats.DiskTotalBytes > 0 {
+		stats.DiskFreePercent = 100 * float64(stats.DiskFreeBytes) / float64(stats.DiskTotalBytes)
+	}
+	if stats.MemTotalBytes > 0 {
+		stats.MemFreePercent = 100 * float64(stats.MemAvailBytes) / float64(stats.MemTotalBytes)
+	}
+	return stats, nil
+}
+
+func (c *SystemHealthChecker) Check(ctx context.Context) (Status, string) {
+	stats, err := c.Stats()
+	if err != nil {
+		return StatusDegraded, err.Error()
+	}
+
+	status := StatusHealthy
+	var problems []string
+	raise := func(s Status, problem string) {
+		problems = append(problems, problem)
+		if s == StatusUnhealthy || status == StatusHealthy {
+			status = s
+		}
+	}
+
+	disk := fmt.Sprintf("disk free %.1f%% on %s", stats.DiskFreePercent, stats.DiskPath)
+	switch {
+	case stats.DiskFreePercent < c.cfg.DiskUnhealthyPercent:
+		raise(StatusUnhealthy, disk)
+	case stats.DiskFreePercent < c.cfg.DiskDegradedPercent:
+		raise(StatusDegraded, disk)
+	}
+
+	mem := fmt.Sprintf("memory free %.1f%%", stats.MemFreePercent)
+	switch {
+	case stats.MemFreePercent < c.cfg.MemoryUnhealthyPercent:
+		raise(StatusUnhealthy, mem)
+	case stats.MemFreePercent < c.cfg.MemoryDegradedPercent:
+		raise(StatusDegraded, mem)
+	}
+
+	if c.cfg.LoadDegraded > 0 && stats.Load1 > c.cfg.LoadDegraded {
+		raise(StatusDegraded, fmt.Sprintf("load average %.2f", stats.Load1))
+	}
+
+	return status, strings.Join(problems, "; ")
+}
@@ -0,0 +1,82 @@
+package health
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// SystemStatsSupported reports whether the host resources can be read here.
+const SystemStatsSupported = true
+
+func readSystemStats(path string) (SystemStats, error) {
+	stats := SystemStats{DiskPath: path}
+
+	var fs unix.Statfs_t
+	if err := unix.Statfs(path, &fs); err != nil {
+		return stats, fmt.Errorf("failed to statfs %s: %w", path, err)
+	}
+	stats.DiskTotalBytes = fs.Blocks * uint64(fs.Bsize)
+	stats.DiskFreeBytes = fs.Bavail * uint64(fs.Bsize)
+
+	total, avail, err := readMeminfo()
+	if err != nil {
+		return stats, err
+	}
+	stats.MemTotalBytes = total
+	stats.MemAvailBytes = avail
+
+	load, err := readLoadavg()
+	if err != nil {
+		return stats, err
+	}
+	stats.Load1 = load
+
+	return stats, nil
+}
+
+func readMeminfo() (total, avail uint64, err error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read meminfo: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+		case "MemAvailable:":
+			avail = kb * 1024
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to read meminfo: %w", err)
+	}
+	return total, avail, nil
+}
+
+func readLoadavg() (float64, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read loadavg: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("failed to parse loadavg: %q", data)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package health
+
+import "errors"
+
+// SystemStatsSupported reports whether the host resources can be read here.
+const SystemStatsSupported = false
+
+func readSystemStats(path string) (SystemStats, error) {
+	return SystemStats{DiskPath: path}, errors.New("system stats are only supported on linux")
+}
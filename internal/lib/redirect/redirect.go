@@ -0,0 +1,92 @@
+package redirect
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Redirect policies.
+//
+// A redirect to another host drops the Authorization header, as in net/http.
+// Preserve and Resend refuse such a redirect of an authorized request instead
+// of sending it on unauthenticated; Follow sends it without the header.
+const (
+	// Follow follows redirects like net/http, which turns a POST into a
+	// body-less GET on 301, 302 and 303.
+	Follow = "follow"
+	// Preserve follows only redirects that keep the request method, so
+	// 307 and 308 are followed and a POST is never silently downgraded.
+	Preserve = "preserve"
+	// Resend follows every redirect with the original method and body, so a
+	// POST answered with 301 or 302 is posted again to the new location.
+	Resend = "resend"
+	// None never follows redirects; the 3xx response is returned as is.
+	None = "none"
+)
+
+// Valid reports whether policy is a known redirect policy. Empty means
+// Preserve.
+func Valid(policy string) bool {
+	switch policy {
+	case "", Follow, Preserve, Resend, None:
+		return true
+	}
+	return false
+}
+
+// CheckRedirect returns an http.Client CheckRedirect function for policy.
+func CheckRedirect(policy string) func(req *http.Request, via []*http.Request) error {
+	switch policy {
+	case Follow:
+		return nil
+	case None:
+		return func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		orig := via[0]
+		if orig.Header.Get("Authorization") != "" && req.Header.Get("Authorization") == "" {
+			return fmt.Errorf("redirect to %s would drop the Authorization header", req.URL.Redacted())
+		}
+		if policy == Resend {
+			return resend(req, orig)
+		}
+		if req.Method != orig.Method {
+			return fmt.Errorf("redirect to %s would change method %s to %s", req.URL.Redacted(), orig.Method, req.Method)
+		}
+		return nil
+	}
+}
+
+// resend turns the upcoming redirect request back into a copy of orig,
+// restoring the method, body and body headers net/http drops on 301, 302
+// and 303.
+func resend(req, orig *http.Request) error {
+	req.Method = orig.Method
+	if orig.GetBody == nil {
+		if orig.Body != nil && orig.Body != http.NoBody {
+			return fmt.Errorf("redirect to %s cannot resend the request body", req.URL.Redacted())
+		}
+		return nil
+	}
+
+	body, err := orig.GetBody()
+	if err != nil {
+		return fmt.Errorf("failed to rewind request body: %w", err)
+	}
+	req.Body = body
+	req.GetBody = orig.GetBody
+	req.ContentLength = orig.ContentLength
+	for _, key := range []string{"Content-Type", "Content-Encoding"} {
+		if value := orig.Header.Get(key); value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	return nil
+}
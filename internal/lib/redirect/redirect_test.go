@@ -0,0 +1,81 @@
+package redirect
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// redirectingServer answers every request to / with code, pointing at the
+// /target path of target, and records what reached /target.
+func redirectingServer(t *testing.T, code int, target func() string) (srv *httptest.Server, got *http.Request, body *string) {
+	t.Helper()
+	got, body = new(http.Request), new(string)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/target" {
+			b, _ := io.ReadAll(r.Body)
+			*got, *body = *r, string(b)
+			return
+		}
+		http.Redirect(w, r, target()+"/target", code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got, body
+}
+
+func post(t *testing.T, policy, url string) (*http.Response, error) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: CheckRedirect(policy)}
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"p":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestResendKeepsMethodAndBody(t *testing.T) {
+	var srv *httptest.Server
+	srv, got, body := redirectingServer(t, http.StatusFound, func() string { return srv.URL })
+
+	if _, err := post(t, Resend, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != http.MethodPost || *body != `{"p":1}` {
+		t.Fatalf("redirected request = %s %q, want POST with the body", got.Method, *body)
+	}
+	if got.Header.Get("Content-Type") != "application/json" || got.Header.Get("Authorization") == "" {
+		t.Fatalf("redirected request lost headers: %v", got.Header)
+	}
+}
+
+func TestPreserveRefusesMethodChange(t *testing.T) {
+	var srv *httptest.Server
+	srv, _, _ = redirectingServer(t, http.StatusFound, func() string { return srv.URL })
+
+	if _, err := post(t, Preserve, srv.URL); err == nil {
+		t.Fatal("preserve followed a 302 that turns POST into GET")
+	}
+}
+
+func TestCrossHostRedirectKeepsAuthorizationOrFails(t *testing.T) {
+	var srv *httptest.Server
+	srv, _, _ = redirectingServer(t, http.StatusTemporaryRedirect, func() string {
+		// Same server under another host name, so net/http drops the
+		// Authorization header.
+		return strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	})
+
+	for _, policy := range []string{Preserve, Resend} {
+		if _, err := post(t, policy, srv.URL); err == nil || !strings.Contains(err.Error(), "Authorization") {
+			t.Fatalf("%s: err = %v, want refusal to drop Authorization", policy, err)
+		}
+	}
+}
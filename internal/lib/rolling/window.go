@@ -0,0 +1,63 @@
+package rolling
+
+import (
+	"sync"
+	"time"
+)
+
+// Window counts events in one-second buckets over a rolling span.
+type Window struct {
+	mu      sync.Mutex
+	counts  []int64
+	seconds []int64
+}
+
+func NewWindow(span time.Duration) *Window {
+	size := max(int(span/time.Second), 1)
+	return &Window{
+		counts:  make([]int64, size),
+		seconds: make([]int64, size),
+	}
+}
+
+// Add records n events at the current time.
+func (w *Window) Add(n int64) {
+	now := time.Now().Unix()
+	i := int(now % int64(len(w.counts)))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.seconds[i] != now {
+		w.seconds[i] = now
+		w.counts[i] = 0
+	}
+	w.counts[i] += n
+}
+
+// Sum returns the number of events recorded within the span.
+func (w *Window) Sum() int64 {
+	now := time.Now().Unix()
+	oldest := now - int64(len(w.counts)) + 1
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var sum int64
+	for i, sec := range w.seconds {
+		if sec >= oldest && sec <= now {
+			sum += w.counts[i]
+		}
+	}
+	return sum
+}
+
+// Rate returns the average number of events per second over the span.
+func (w *Window) Rate() float64 {
+	return float64(w.Sum()) / float64(len(w.counts))
+}
+
+// Span returns the window length.
+func (w *Window) Span() time.Duration {
+	return time.Duration(len(w.counts)) * time.Second
+}
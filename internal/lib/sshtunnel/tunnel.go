@@ -0,0 +1,172 @@
+package sshtunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type Config struct {
+	Host                  string
+	User                  string
+	KeyFile               string
+	KnownHostsFile        string
+	InsecureIgnoreHostKey bool
+	Timeout               time.Duration
+}
+
+// Tunnel dials TCP connections through an SSH jump host. The SSH connection
+// is established lazily and re-established when it drops.
+type Tunnel struct {
+	log       *slog.Logger
+	host      string
+	sshConfig *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+func New(log *slog.Logger, cfg Config) (*Tunnel, error) {
+	key, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ssh key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh key: %w", err)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case cfg.KnownHostsFile != "":
+		hostKeyCallback, err = knownhosts.New(cfg.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known hosts: %w", err)
+		}
+	case cfg.InsecureIgnoreHostKey:
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, errors.New("ssh known_hosts_file is required unless insecure_ignore_host_key is set")
+	}
+
+	return &Tunnel{
+		log:  log,
+		host: cfg.Host,
+		sshConfig: &ssh.ClientConfig{
+			User:            cfg.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         cfg.Timeout,
+		},
+	}, nil
+}
+
+// DialContext opens a connection to addr through the jump host. If the dial
+// fails on an existing SSH connection, the connection is re-established once.
+func (t *Tunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialWithContext(ctx, client, network, addr)
+	if err == nil {
+		return conn, nil
+	}
+
+	t.log.Warn("ssh tunnel dial failed, reconnecting",
+		slog.String("jump_host", t.host),
+		slog.String("addr", addr),
+		sl.Err(err),
+	)
+	t.reset(client)
+
+	client, err = t.connect()
+	if err != nil {
+		return nil, err
+	}
+	return dialWithContext(ctx, client, network, addr)
+}
+
+func (t *Tunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == nil {
+		return nil
+	}
+	err := t.client.Close()
+	t.client = nil
+	return err
+}
+
+func (t *Tunnel) connect() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	client, err := ssh.Dial("tcp", t.host, t.sshConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh jump host: %w", err)
+	}
+
+	t.log.Info("ssh tunnel established", slog.String("jump_host", t.host))
+	t.client = client
+
+	go func() {
+		err := client.Wait()
+		t.log.Warn("ssh tunnel closed", slog.String("jump_host", t.host), slog.Any("reason", err))
+		t.reset(client)
+	}()
+
+	return client, nil
+}
+
+// reset drops the cached client if it is still the given one.
+func (t *Tunnel) reset(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == client {
+		t.client.Close()
+		t.client = nil
+	}
+}
+
+func dialWithContext(ctx context.Context, client *ssh.Client, network, addr string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		conn, err := client.Dial(network, addr)
+		done <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,51 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// ClientConfig builds a client TLS config that trusts the CA bundle at caFile.
+// The bundle is appended to the system roots unless replaceSystemRoots is set.
+// Returns nil when caFile is empty, meaning the default TLS settings apply.
+func ClientConfig(caFile string, replaceSystemRoots bool) (*tls.Config, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if replaceSystemRoots {
+		pool = x509.NewCertPool()
+	} else {
+		pool, err = x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system cert pool: %w", err)
+		}
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no valid certificates found in CA bundle: %s", caFile)
+	}
+
+	return &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// NewTransport returns a copy of the default HTTP transport using tlsCfg.
+func NewTransport(tlsCfg *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsCfg != nil {
+		transport.TLSClientConfig = tlsCfg
+	}
+	return transport
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// EnvelopeBatch is the compact batch form: the station header is sent once
+// and each device payload carries only its own fields.
+type EnvelopeBatch struct {
+	StationID     string          `json:"station_id"`
+	StationName   string          `json:"station_name"`
+	SchemaVersion string          `json:"schema_version,omitempty"`
+	Devices       []DevicePayload `json:"devices"`
+}
+
+// DevicePayload is an envelope without the station header.
+type DevicePayload struct {
+	ID          string      `json:"id"`
+	Timestamp   time.Time   `json:"timestamp"`
+	DeviceID    string      `json:"device_id"`
+	DeviceName  string      `json:"device_name"`
+	DeviceGroup string      `json:"device_group"`
+	Values      []DataPoint `json:"values"`
+
+	CollectorVersion string            `json:"collector_version,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	Test             bool              `json:"test,omitempty"`
+	Meta             map[string]string `json:"meta,omitempty"`
+	Sequence         uint64            `json:"sequence,omitempty"`
+	Raw              json.RawMessage   `json:"raw,omitempty"`
+	CorrelationID    string            `json:"correlation_id,omitempty"`
+}
+
+var errMixedStations = errors.New("envelopes belong to different stations")
+
+// NewEnvelopeBatch builds a batch from envelopes of a single station.
+func NewEnvelopeBatch(envelopes []*Envelope) (*EnvelopeBatch, error) {
+	if len(envelopes) == 0 {
+		return nil, errors.New("no envelopes")
+	}
+
+	first := envelopes[0]
+	batch := &EnvelopeBatch{
+		StationID:     first.StationID,
+		StationName:   first.StationName,
+		SchemaVersion: first.SchemaVersion,
+		Devices:       make([]DevicePayload, 0, len(envelopes)),
+	}
+	for _, e := range envelopes {
+		if e.StationID != batch.StationID {
+			return nil, errMixedStations
+		}
+		batch.Devices = append(batch.Devices, DevicePayload{
+			ID:               e.ID,
+			Timestamp:        e.Timestamp,
+			DeviceID:         e.DeviceID,
+			DeviceName:       e.DeviceName,
+			DeviceGroup:      e.DeviceGroup,
+			Values:           e.Values,
+			CollectorVersion: e.CollectorVersion,
+			Metadata:         e.Metadata,
+			Test:             e.Test,
+			Meta:             e.Meta,
+			Sequence:         e.Sequence,
+			Raw:              e.Raw,
+			CorrelationID:    e.CorrelationID,
+		})
+	}
+	return batch, nil
+}
+
+// Envelopes splits the batch back into individual envelopes.
+func (b *EnvelopeBatch) Envelopes() []*Envelope {
+	envelopes := make([]*Envelope, 0, len(b.Devices))
+	for _, d := range b.Devices {
+		envelopes = append(envelopes, &Envelope{
+			ID:               d.ID,
+			StationID:        b.StationID,
+			StationName:      b.StationName,
+			Timestamp:        d.Timestamp,
+			DeviceID:         d.DeviceID,
+			DeviceName:       d.DeviceName,
+			DeviceGroup:      d.DeviceGroup,
+			Values:           d.Values,
+			CollectorVersion: d.CollectorVersion,
+			Metadata:         d.Metadata,
+			Test:             d.Test,
+			SchemaVersion:    b.SchemaVersion,
+			Meta:             d.Meta,
+			Sequence:         d.Sequence,
+			Raw:              d.Raw,
+			CorrelationID:    d.CorrelationID,
+		})
+	}
+	return envelopes
+}
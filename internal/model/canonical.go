@@ -0,0 +1,59 @@
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// CanonicalJSON returns a deterministic encoding of the envelope for signing,
+// deduplication and storage keys: object keys sorted at every level,
+// timestamps in UTC and numbers as encoding/json formats them. The correlation
+// ID identifies a send rather than the reading and is left out. It is not the
+// wire format; use ToJSON for sending.
+func (e *Envelope) CanonicalJSON() ([]byte, error) {
+	c := *e
+	c.CorrelationID = ""
+	c.Timestamp = c.Timestamp.UTC()
+	c.Values = make([]DataPoint, len(e.Values))
+	for i, dp := range e.Values {
+		if !dp.Timestamp.IsZero() {
+			dp.Timestamp = dp.Timestamp.UTC()
+		}
+		c.Values[i] = dp
+	}
+
+	data, err := json.Marshal(&c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	// Decoding into generic maps and encoding again sorts struct fields as
+	// well as map keys, so the output does not depend on field order.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, fmt.Errorf("failed to decode envelope: %w", err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(generic); err != nil {
+		return nil, fmt.Errorf("failed to encode canonical envelope: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Hash returns the hex SHA-256 of the canonical JSON.
+func (e *Envelope) Hash() (string, error) {
+	data, err := e.CanonicalJSON()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
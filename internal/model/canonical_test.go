@@ -0,0 +1,60 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func canonicalEnvelope() *Envelope {
+	tz := time.FixedZone("UZT", 5*60*60)
+	return &Envelope{
+		ID:          "st1/meter1/42",
+		StationID:   "st1",
+		StationName: "Station <1> & Co",
+		Timestamp:   time.Date(2024, 3, 1, 17, 0, 0, 250000000, tz),
+		DeviceID:    "meter1",
+		DeviceName:  "Meter 1",
+		DeviceGroup: "meters",
+		Values: []DataPoint{
+			{Name: "active_power", Value: FloatValue(12.5), Unit: "kW", Quality: QualityGood},
+			{Name: "counter", Value: IntValue(9007199254740993), Quality: QualityGood},
+			{
+				Name:      "breaker",
+				Value:     BoolValue(false),
+				Quality:   QualityBad,
+				Timestamp: time.Date(2024, 3, 1, 16, 59, 59, 0, tz),
+			},
+		},
+		Metadata:      map[string]string{"zeta": "1", "alpha": "2"},
+		SchemaVersion: SchemaVersion,
+		Meta:          map[string]string{"part": "1/2", "config_checksum": "abc"},
+		Sequence:      42,
+	}
+}
+
+func TestCanonicalJSONGolden(t *testing.T) {
+	got, err := canonicalEnvelope().CanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "envelope_canonical.golden.json", got)
+}
+
+func TestCanonicalJSONIgnoresTimeZone(t *testing.T) {
+	e := canonicalEnvelope()
+	utc := canonicalEnvelope()
+	utc.Timestamp = utc.Timestamp.UTC()
+	utc.Values[2].Timestamp = utc.Values[2].Timestamp.UTC()
+
+	a, err := e.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := utc.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatalf("hash depends on time zone: %s != %s", a, b)
+	}
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// ContentTypeCBOR is the media type of CBOR encoded envelopes.
+const ContentTypeCBOR = "application/cbor"
+
+// cborMode maps struct fields by their json tags, so CBOR payloads carry the
+// same keys as JSON, and writes timestamps as RFC 3339 text.
+var cborMode = func() cbor.EncMode {
+	mode, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return mode
+}()
+
+// cborDecMode decodes untyped maps, such as a point's raw source value, with
+// string keys so they can be re-encoded as JSON.
+var cborDecMode = func() cbor.DecMode {
+	mode, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return mode
+}()
+
+// MarshalCBOR encodes an envelope or a slice of envelopes as CBOR.
+func MarshalCBOR(v any) ([]byte, error) {
+	return cborMode.Marshal(v)
+}
+
+// EncodeCBOR writes v as CBOR to w.
+func EncodeCBOR(w io.Writer, v any) error {
+	return cborMode.NewEncoder(w).Encode(v)
+}
+
+func (e *Envelope) ToCBOR() ([]byte, error) {
+	return MarshalCBOR(e)
+}
+
+func EnvelopeFromCBOR(data []byte) (*Envelope, error) {
+	var e Envelope
+	if err := cborDecMode.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// MarshalCBOR encodes the plain value. Unlike JSON, floats stay floats even
+// without a fraction.
+func (v Value) MarshalCBOR() ([]byte, error) {
+	return cborMode.Marshal(v.Interface())
+}
+
+func (v *Value) UnmarshalCBOR(data []byte) error {
+	var raw any
+	if err := cbor.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch val := raw.(type) {
+	case nil, bool, string, int64:
+		*v = ValueOf(raw)
+		return nil
+	case float64:
+		// CBOR keeps the float kind, so unlike ValueOf a whole number
+		// stays a float.
+		*v = FloatValue(val)
+		return nil
+	case uint64:
+		if val > math.MaxInt64 {
+			*v = FloatValue(float64(val))
+			return nil
+		}
+		*v = IntValue(int64(val))
+		return nil
+	}
+	return fmt.Errorf("unsupported value type %T", raw)
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeJSONCBORRoundTrip(t *testing.T) {
+	e := NewEnvelope("st1", "Station 1", "meter1", "Meter 1", "meters", []DataPoint{
+		{Name: "active_power", Value: FloatValue(12.5), Unit: "kW", Quality: QualityGood},
+		{Name: "counter", Value: IntValue(9007199254740993), Quality: QualityGood},
+		{Name: "breaker", Value: BoolValue(true), Quality: QualityGood},
+		{Name: "mode", Value: StringValue("auto"), Quality: QualityGood},
+		{Name: "missing", Quality: QualityBad, QualityReason: ReasonMissingField},
+		{
+			Name:      "voltage",
+			Value:     IntValue(230),
+			Quality:   QualityGood,
+			Timestamp: time.Date(2024, 3, 1, 11, 59, 59, 500000000, time.UTC),
+			Raw:       map[string]any{"register": "40001"},
+		},
+	},
+		WithTimestamp(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)),
+		WithMetadata(map[string]string{"firmware": "2.1"}),
+		WithMeta(map[string]string{"config_checksum": "abc"}),
+		WithSequence(7),
+	)
+
+	want, err := e.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromJSON, err := EnvelopeFromJSON(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := fromJSON.ToCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromCBOR, err := EnvelopeFromCBOR(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fromCBOR.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("JSON -> CBOR -> JSON changed the envelope:\n got %s\nwant %s", got, want)
+	}
+	for i, dp := range fromCBOR.Values {
+		if dp.Value.Kind() != e.Values[i].Value.Kind() {
+			t.Fatalf("%s kind = %d, want %d", dp.Name, dp.Value.Kind(), e.Values[i].Value.Kind())
+		}
+	}
+}
+
+func TestValueCBORKeepsWholeFloats(t *testing.T) {
+	data, err := MarshalCBOR(FloatValue(230))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v Value
+	if err := v.UnmarshalCBOR(data); err != nil {
+		t.Fatal(err)
+	}
+	if v != FloatValue(230) {
+		t.Fatalf("CBOR round trip = %#v, want float 230", v)
+	}
+}
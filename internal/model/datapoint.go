@@ -1,15 +1,60 @@
 package model
 
+import (
+	"encoding/json"
+	"time"
+)
+
+// DataPoint is a single measured value. Timestamp is the source time of the
+// value; when zero the point shares the envelope timestamp and the field is
+// left out of the JSON. QualityReason tells why a point is bad.
 type DataPoint struct {
-	Name     string `json:"name"`
-	Value    any    `json:"value"`
-	Unit     string `json:"unit,omitempty"`
-	Quality  string `json:"quality"`
-	Severity string `json:"severity,omitempty"`
+	Name          string    `json:"name"`
+	Value         Value     `json:"value"`
+	Unit          string    `json:"unit,omitempty"`
+	Quality       string    `json:"quality"`
+	QualityReason string    `json:"quality_reason,omitempty"`
+	Severity      string    `json:"severity,omitempty"`
+	Substituted   bool      `json:"substituted,omitempty"`
+	Timestamp     time.Time `json:"timestamp,omitempty"`
+	Raw           any       `json:"raw,omitempty"`
 }
 
 const (
-	QualityGood    = "good"
-	QualityBad     = "bad"
-	QualityUnknown = "unknown"
+	QualityGood      = "good"
+	QualityBad       = "bad"
+	QualityUncertain = "uncertain"
+	QualityUnknown   = "unknown"
+)
+
+// Reasons for bad quality, set in DataPoint.QualityReason.
+const (
+	ReasonMissingField  = "missing_field"
+	ReasonParseError    = "parse_error"
+	ReasonTypeMismatch  = "type_mismatch"
+	ReasonOutOfRange    = "out_of_range"
+	ReasonStale         = "stale"
+	ReasonSourceInvalid = "source_invalid"
+	ReasonCollectError  = "collect_error"
 )
+
+// TimeOr returns the point's own timestamp, or fallback when it has none.
+func (dp DataPoint) TimeOr(fallback time.Time) time.Time {
+	if dp.Timestamp.IsZero() {
+		return fallback
+	}
+	return dp.Timestamp
+}
+
+// MarshalJSON omits a zero Timestamp, which omitempty does not do for
+// time.Time, so points without a source time serialize as before.
+func (dp DataPoint) MarshalJSON() ([]byte, error) {
+	type plain DataPoint
+	if !dp.Timestamp.IsZero() {
+		return json.Marshal(plain(dp))
+	}
+	return json.Marshal(struct {
+		plain
+		Timestamp *time.Time `json:"timestamp,omitempty"`
+	}{plain: plain(dp)})
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// golden compares got with testdata/name, rewriting the file with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s mismatch:\n got %s\nwant %s", name, got, want)
+	}
+}
+
+func TestDataPointMarshalJSONGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		point  DataPoint
+	}{
+		{
+			// Points without a source time keep the format that predates
+			// per-point timestamps.
+			golden: "datapoint_untimed.golden.json",
+			point: DataPoint{
+				Name:    "active_power",
+				Value:   FloatValue(12.5),
+				Unit:    "kW",
+				Quality: QualityGood,
+			},
+		},
+		{
+			golden: "datapoint_timed.golden.json",
+			point: DataPoint{
+				Name:          "voltage",
+				Value:         IntValue(230),
+				Unit:          "V",
+				Quality:       QualityBad,
+				QualityReason: ReasonOutOfRange,
+				Timestamp:     time.Date(2024, 3, 1, 12, 0, 0, 500000000, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got, err := json.Marshal(tt.point)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, tt.golden, got)
+
+			var back DataPoint
+			if err := json.Unmarshal(got, &back); err != nil {
+				t.Fatal(err)
+			}
+			if back != tt.point {
+				t.Fatalf("round trip = %+v, want %+v", back, tt.point)
+			}
+		})
+	}
+}
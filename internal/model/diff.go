@@ -0,0 +1,99 @@
+package model
+
+import "math"
+
+// Kinds of DataPointChange.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// DataPointChange describes how one point differs between two envelopes of
+// the same device. Old fields are empty for added points, New fields for
+// removed ones.
+type DataPointChange struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	OldValue   Value  `json:"old_value"`
+	NewValue   Value  `json:"new_value"`
+	OldQuality string `json:"old_quality,omitempty"`
+	NewQuality string `json:"new_quality,omitempty"`
+}
+
+// DiffEnvelopes returns the points added, removed or changed in curr compared
+// to prev, matched by name. Numeric values within epsilon of each other are
+// equal. Changes follow the point order of curr, then removed points in the
+// order of prev. A nil prev reports every point of curr as added.
+func DiffEnvelopes(prev, curr *Envelope, epsilon float64) []DataPointChange {
+	var prevValues, currValues []DataPoint
+	if prev != nil {
+		prevValues = prev.Values
+	}
+	if curr != nil {
+		currValues = curr.Values
+	}
+
+	before := make(map[string]DataPoint, len(prevValues))
+	for _, dp := range prevValues {
+		before[dp.Name] = dp
+	}
+
+	var changes []DataPointChange
+	seen := make(map[string]struct{}, len(currValues))
+	for _, dp := range currValues {
+		seen[dp.Name] = struct{}{}
+		old, ok := before[dp.Name]
+		switch {
+		case !ok:
+			changes = append(changes, DataPointChange{
+				Name:       dp.Name,
+				Kind:       ChangeAdded,
+				NewValue:   dp.Value,
+				NewQuality: dp.Quality,
+			})
+		case old.Quality != dp.Quality || !valuesEqual(old.Value, dp.Value, epsilon):
+			changes = append(changes, DataPointChange{
+				Name:       dp.Name,
+				Kind:       ChangeChanged,
+				OldValue:   old.Value,
+				NewValue:   dp.Value,
+				OldQuality: old.Quality,
+				NewQuality: dp.Quality,
+			})
+		}
+	}
+
+	for _, dp := range prevValues {
+		if _, ok := seen[dp.Name]; ok {
+			continue
+		}
+		changes = append(changes, DataPointChange{
+			Name:       dp.Name,
+			Kind:       ChangeRemoved,
+			OldValue:   dp.Value,
+			OldQuality: dp.Quality,
+		})
+	}
+
+	return changes
+}
+
+// valuesEqual compares numbers within epsilon and other values exactly.
+func valuesEqual(a, b Value, epsilon float64) bool {
+	if a == b {
+		return true
+	}
+	if a.Kind() == KindString || b.Kind() == KindString {
+		return false
+	}
+	fa, okA := a.Float()
+	fb, okB := b.Float()
+	if !okA || !okB {
+		return false
+	}
+	if math.IsNaN(fa) && math.IsNaN(fb) {
+		return true
+	}
+	return math.Abs(fa-fb) <= epsilon
+}
@@ -2,11 +2,14 @@ package model
 
 import (
 	"encoding/json"
+	"slices"
 	"time"
-
-	"github.com/google/uuid"
 )
 
+// SchemaVersion identifies the envelope payload layout. Envelopes without a
+// schema_version predate versioning.
+const SchemaVersion = "2"
+
 type Envelope struct {
 	ID          string      `json:"id"`
 	StationID   string      `json:"station_id"`
@@ -16,19 +19,106 @@ type Envelope struct {
 	DeviceName  string      `json:"device_name"`
 	DeviceGroup string      `json:"device_group"`
 	Values      []DataPoint `json:"values"`
+
+	CollectorVersion string            `json:"collector_version,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	Test             bool              `json:"test,omitempty"`
+	SchemaVersion    string            `json:"schema_version,omitempty"`
+	Meta             map[string]string `json:"meta,omitempty"`
+	Sequence         uint64            `json:"sequence,omitempty"`
+	Raw              json.RawMessage   `json:"raw,omitempty"`
+	// CorrelationID ties the envelope to its collection tick. A single send
+	// also carries it in the X-Correlation-ID header.
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// Priority orders buffer drain; it is local and not sent.
+	Priority int `json:"-"`
+
+	idStrategy string
+}
+
+type EnvelopeOption func(*Envelope)
+
+// WithTimestampPrecision truncates the envelope timestamp to the given
+// precision, e.g. time.Second. Zero keeps full precision.
+func WithTimestampPrecision(precision time.Duration) EnvelopeOption {
+	return func(e *Envelope) {
+		if precision > 0 {
+			e.Timestamp = e.Timestamp.Truncate(precision)
+		}
+	}
+}
+
+// WithTimestamp sets the envelope timestamp, e.g. for historical readings.
+// A zero t keeps the current time.
+func WithTimestamp(t time.Time) EnvelopeOption {
+	return func(e *Envelope) {
+		if !t.IsZero() {
+			e.Timestamp = t.UTC()
+		}
+	}
+}
+
+// WithMetadata attaches metadata such as device firmware version.
+func WithMetadata(metadata map[string]string) EnvelopeOption {
+	return func(e *Envelope) {
+		e.Metadata = metadata
+	}
 }
 
-func NewEnvelope(stationID, stationName, deviceID, deviceName, deviceGroup string, values []DataPoint) *Envelope {
-	return &Envelope{
-		ID:          uuid.New().String(),
+// WithRaw attaches the unmodified source response.
+func WithRaw(raw json.RawMessage) EnvelopeOption {
+	return func(e *Envelope) {
+		e.Raw = raw
+	}
+}
+
+// WithTest marks the envelope as self-test traffic that downstream consumers
+// must keep out of production series.
+func WithTest() EnvelopeOption {
+	return func(e *Envelope) {
+		e.Test = true
+	}
+}
+
+// WithMeta adds collector context such as the config checksum. Unlike
+// Metadata, which describes the device, Meta describes how the envelope was
+// produced.
+func WithMeta(meta map[string]string) EnvelopeOption {
+	return func(e *Envelope) {
+		for k, v := range meta {
+			e.SetMeta(k, v)
+		}
+	}
+}
+
+// SetMeta sets a single Meta entry, allocating the map if needed.
+func (e *Envelope) SetMeta(key, value string) {
+	if e.Meta == nil {
+		e.Meta = make(map[string]string)
+	}
+	e.Meta[key] = value
+}
+
+// NewEnvelope copies values, so the caller may reuse the slice once it
+// returns.
+func NewEnvelope(stationID, stationName, deviceID, deviceName, deviceGroup string, values []DataPoint, opts ...EnvelopeOption) *Envelope {
+	e := &Envelope{
 		StationID:   stationID,
 		StationName: stationName,
 		Timestamp:   time.Now().UTC(),
 		DeviceID:    deviceID,
 		DeviceName:  deviceName,
 		DeviceGroup: deviceGroup,
-		Values:      values,
+		Values:      slices.Clone(values),
+
+		SchemaVersion: SchemaVersion,
+	}
+	for _, opt := range opts {
+		opt(e)
 	}
+	e.ID = e.newID()
+	return e
 }
 
 func (e *Envelope) ToJSON() ([]byte, error) {
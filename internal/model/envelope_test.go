@@ -0,0 +1,50 @@
+package model
+
+import (
+	"strconv"
+	"testing"
+)
+
+func testPoints(n int) []DataPoint {
+	points := make([]DataPoint, n)
+	for i := range points {
+		points[i] = DataPoint{
+			Name:    "field_" + strconv.Itoa(i),
+			Value:   FloatValue(float64(i) * 1.5),
+			Unit:    "kW",
+			Quality: QualityGood,
+		}
+	}
+	return points
+}
+
+func TestNewEnvelopeCopiesValues(t *testing.T) {
+	points := testPoints(3)
+	e := NewEnvelope("st", "Station", "dev", "Device", "group", points)
+
+	clear(points)
+
+	if e.Values[0].Name != "field_0" || e.Values[2].Value != FloatValue(3) {
+		t.Fatalf("envelope values changed with the caller's slice: %+v", e.Values)
+	}
+}
+
+func BenchmarkNewEnvelope10k(b *testing.B) {
+	points := testPoints(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewEnvelope("st", "Station", "dev", "Device", "group", points)
+	}
+}
+
+func BenchmarkEnvelopeToJSON10k(b *testing.B) {
+	e := NewEnvelope("st", "Station", "dev", "Device", "group", testPoints(10000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.ToJSON(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
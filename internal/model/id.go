@@ -0,0 +1,73 @@
+package model
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// Envelope ID strategies for WithIDStrategy. IDRandom is a random UUID.
+// IDHash is a UUID derived from the station, device, timestamp and values,
+// so the same reading always gets the same ID and replays dedupe naturally.
+// IDSequence is "station/device/sequence", monotonic per device.
+const (
+	IDRandom   = "uuid"
+	IDHash     = "hash"
+	IDSequence = "sequence"
+)
+
+// idNamespace is the UUID namespace of hash-derived envelope IDs.
+var idNamespace = uuid.MustParse("5b0c7f3e-9a41-4d2e-8f6b-1c3a7e9d2b50")
+
+// WithIDStrategy selects how the envelope ID is generated. The ID is
+// computed after all other options, so it sees the final timestamp and
+// sequence. An empty strategy means IDRandom.
+func WithIDStrategy(strategy string) EnvelopeOption {
+	return func(e *Envelope) {
+		e.idStrategy = strategy
+	}
+}
+
+// WithSequence sets the per-device sequence number.
+func WithSequence(sequence uint64) EnvelopeOption {
+	return func(e *Envelope) {
+		e.Sequence = sequence
+	}
+}
+
+func (e *Envelope) newID() string {
+	switch e.idStrategy {
+	case IDHash:
+		return e.hashID()
+	case IDSequence:
+		return e.StationID + "/" + e.DeviceID + "/" + strconv.FormatUint(e.Sequence, 10)
+	}
+	return uuid.New().String()
+}
+
+func (e *Envelope) hashID() string {
+	values, err := json.Marshal(e.Values)
+	if err != nil {
+		return uuid.New().String()
+	}
+
+	data := make([]byte, 0, len(e.StationID)+len(e.DeviceID)+len(values)+10)
+	data = append(data, e.StationID...)
+	data = append(data, 0)
+	data = append(data, e.DeviceID...)
+	data = append(data, 0)
+	data = binary.BigEndian.AppendUint64(data, uint64(e.Timestamp.UnixNano()))
+	data = append(data, values...)
+	return uuid.NewSHA1(idNamespace, data).String()
+}
+
+// partID returns the ID of the index-th part (from 0) of a split envelope.
+// Sequence IDs are shared by all parts, so they get a ".n" suffix.
+func (e *Envelope) partID(part *Envelope, index int) string {
+	if e.idStrategy == IDSequence {
+		return e.ID + "." + strconv.Itoa(index+1)
+	}
+	return part.newID()
+}
@@ -0,0 +1,52 @@
+package model
+
+import "sync"
+
+// maxInterned bounds the intern table. Names and units come from config and
+// are few; the cap only guards against values that are not.
+const maxInterned = 8192
+
+var interned = struct {
+	sync.RWMutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// Intern returns a shared copy of s, so the many data points carrying the
+// same name or unit reference one string instead of one allocation each.
+// Once the table is full new strings are returned as is.
+func Intern(s string) string {
+	if s == "" {
+		return s
+	}
+
+	interned.RLock()
+	v, ok := interned.m[s]
+	interned.RUnlock()
+	if ok {
+		return v
+	}
+
+	interned.Lock()
+	defer interned.Unlock()
+	if v, ok := interned.m[s]; ok {
+		return v
+	}
+	if len(interned.m) >= maxInterned {
+		return s
+	}
+	interned.m[s] = s
+	return s
+}
+
+// InternPoints interns the names, units, qualities and severities of points,
+// e.g. after decoding them from the buffer.
+func InternPoints(points []DataPoint) {
+	for i := range points {
+		dp := &points[i]
+		dp.Name = Intern(dp.Name)
+		dp.Unit = Intern(dp.Unit)
+		dp.Quality = Intern(dp.Quality)
+		dp.QualityReason = Intern(dp.QualityReason)
+		dp.Severity = Intern(dp.Severity)
+	}
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func loadEnvelope(t *testing.T, name string) *Envelope {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := EnvelopeFromJSON(data)
+	if err != nil {
+		t.Fatalf("decode %s: %v", name, err)
+	}
+	return e
+}
+
+func checkCommonFields(t *testing.T, e *Envelope) {
+	t.Helper()
+	if e.StationID != "st1" || e.DeviceID != "meter1" || e.DeviceGroup != "meters" {
+		t.Fatalf("header = %q/%q/%q", e.StationID, e.DeviceID, e.DeviceGroup)
+	}
+	if !e.Timestamp.Equal(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("timestamp = %v", e.Timestamp)
+	}
+	if e.Metadata["firmware"] != "2.1" {
+		t.Fatalf("metadata = %v", e.Metadata)
+	}
+	if len(e.Values) != 3 {
+		t.Fatalf("got %d values, want 3", len(e.Values))
+	}
+	if e.Values[0].Value != FloatValue(12.5) {
+		t.Fatalf("active_power = %#v", e.Values[0].Value)
+	}
+	if e.Values[1].Value != IntValue(9007199254740993) {
+		t.Fatalf("counter = %#v, want exact int", e.Values[1].Value)
+	}
+	if e.Values[2].Value != BoolValue(true) {
+		t.Fatalf("breaker = %#v", e.Values[2].Value)
+	}
+}
+
+func TestDecodeUnversionedEnvelope(t *testing.T) {
+	e := loadEnvelope(t, "envelope_v1.json")
+	checkCommonFields(t, e)
+
+	if e.SchemaVersion != "" {
+		t.Fatalf("schema version = %q, want none", e.SchemaVersion)
+	}
+	if e.Meta != nil || e.Sequence != 0 {
+		t.Fatalf("meta = %v, sequence = %d, want none", e.Meta, e.Sequence)
+	}
+	if !e.Values[2].Timestamp.IsZero() {
+		t.Fatalf("point timestamp = %v, want none", e.Values[2].Timestamp)
+	}
+}
+
+func TestDecodeVersionedEnvelope(t *testing.T) {
+	e := loadEnvelope(t, "envelope_v2.json")
+	checkCommonFields(t, e)
+
+	if e.SchemaVersion != SchemaVersion {
+		t.Fatalf("schema version = %q, want %q", e.SchemaVersion, SchemaVersion)
+	}
+	if e.Meta["config_checksum"] != "abc123" || e.Meta[MetaPart] != "1/1" {
+		t.Fatalf("meta = %v", e.Meta)
+	}
+	if e.Sequence != 42 || e.ID != "st1/meter1/42" {
+		t.Fatalf("id = %q, sequence = %d", e.ID, e.Sequence)
+	}
+	if !e.Values[2].Timestamp.Equal(time.Date(2024, 3, 1, 11, 59, 59, 500000000, time.UTC)) {
+		t.Fatalf("point timestamp = %v", e.Values[2].Timestamp)
+	}
+}
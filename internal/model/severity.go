@@ -0,0 +1,51 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityAlarm    = "alarm"
+	SeverityCritical = "critical"
+)
+
+// severityAliases maps common spellings to the canonical severities.
+var severityAliases = map[string]string{
+	"info":        SeverityInfo,
+	"information": SeverityInfo,
+	"warning":     SeverityWarning,
+	"warn":        SeverityWarning,
+	"alarm":       SeverityAlarm,
+	"alert":       SeverityAlarm,
+	"critical":    SeverityCritical,
+	"crit":        SeverityCritical,
+}
+
+// NormalizeSeverity returns the canonical lowercase severity for label.
+// Legacy maps station-specific labels (matched case-insensitively) to
+// severities and is consulted first. Unknown labels are an error unless
+// allowCustom is set, in which case they are returned lowercased.
+func NormalizeSeverity(label string, legacy map[string]string, allowCustom bool) (string, error) {
+	key := strings.ToLower(strings.TrimSpace(label))
+	if key == "" {
+		return "", nil
+	}
+
+	for from, to := range legacy {
+		if strings.ToLower(from) == key {
+			key = strings.ToLower(strings.TrimSpace(to))
+			break
+		}
+	}
+
+	if severity, ok := severityAliases[key]; ok {
+		return severity, nil
+	}
+	if allowCustom {
+		return key, nil
+	}
+	return "", fmt.Errorf("unknown severity %q", label)
+}
@@ -0,0 +1,38 @@
+package model
+
+import "strconv"
+
+// MetaPart marks envelopes split from one reading as "index/total", e.g.
+// "2/3". Parts share the device, timestamp and sequence of the reading.
+const MetaPart = "part"
+
+// Split breaks an envelope with more than maxPoints values into standalone
+// envelopes of at most maxPoints values each, with their own IDs. The raw
+// response, if any, travels with the first part. An envelope within the
+// limit, or a maxPoints of 0, is returned as is.
+func (e *Envelope) Split(maxPoints int) []*Envelope {
+	if maxPoints <= 0 || len(e.Values) <= maxPoints {
+		return []*Envelope{e}
+	}
+
+	total := (len(e.Values) + maxPoints - 1) / maxPoints
+	parts := make([]*Envelope, 0, total)
+	for i := 0; i < total; i++ {
+		end := min((i+1)*maxPoints, len(e.Values))
+
+		part := *e
+		part.Values = e.Values[i*maxPoints : end : end]
+		part.ID = e.partID(&part, i)
+		if i > 0 {
+			part.Raw = nil
+		}
+		part.Meta = make(map[string]string, len(e.Meta)+1)
+		for k, v := range e.Meta {
+			part.Meta[k] = v
+		}
+		part.Meta[MetaPart] = strconv.Itoa(i+1) + "/" + strconv.Itoa(total)
+
+		parts = append(parts, &part)
+	}
+	return parts
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Validate reports envelopes that can never be delivered, so they are dropped
+// instead of being retried from the buffer forever.
+func (e *Envelope) Validate() error {
+	var errs []error
+	if e.ID == "" {
+		errs = append(errs, errors.New("missing id"))
+	}
+	if e.StationID == "" {
+		errs = append(errs, errors.New("missing station id"))
+	}
+	if e.DeviceID == "" {
+		errs = append(errs, errors.New("missing device id"))
+	}
+	if e.Timestamp.IsZero() {
+		errs = append(errs, errors.New("missing timestamp"))
+	}
+	if len(e.Values) == 0 && len(e.Raw) == 0 {
+		errs = append(errs, errors.New("no values"))
+	}
+	for _, dp := range e.Values {
+		if dp.Name == "" {
+			errs = append(errs, errors.New("value without name"))
+		}
+		if isNonFinite(dp.Value) {
+			errs = append(errs, fmt.Errorf("value %s is not finite", dp.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReplaceNonFinite turns NaN and infinite floats, which JSON cannot encode,
+// into null values with bad quality. It returns the number of points changed.
+func (e *Envelope) ReplaceNonFinite() int {
+	replaced := 0
+	for i := range e.Values {
+		if isNonFinite(e.Values[i].Value) {
+			e.Values[i].Value = Value{}
+			e.Values[i].Quality = QualityBad
+			e.Values[i].QualityReason = ReasonSourceInvalid
+			replaced++
+		}
+	}
+	return replaced
+}
+
+// MarkStale gives points whose own timestamp is more than maxAge older than
+// the envelope bad quality, so a fresh envelope does not pass old values off
+// as good. It returns the number of points changed.
+func (e *Envelope) MarkStale(maxAge time.Duration) int {
+	marked := 0
+	for i := range e.Values {
+		dp := &e.Values[i]
+		if dp.Timestamp.IsZero() || dp.Quality == QualityBad || e.Timestamp.Sub(dp.Timestamp) <= maxAge {
+			continue
+		}
+		dp.Quality = QualityBad
+		dp.QualityReason = ReasonStale
+		marked++
+	}
+	return marked
+}
+
+func isNonFinite(v Value) bool {
+	if v.Kind() != KindFloat {
+		return false
+	}
+	f, _ := v.Float()
+	return math.IsNaN(f) || math.IsInf(f, 0)
+}
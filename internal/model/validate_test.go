@@ -0,0 +1,32 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarkStale(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	e := &Envelope{
+		Timestamp: now,
+		Values: []DataPoint{
+			{Name: "untimed", Quality: QualityGood},
+			{Name: "fresh", Quality: QualityGood, Timestamp: now.Add(-time.Minute)},
+			{Name: "stale", Quality: QualityGood, Timestamp: now.Add(-time.Hour)},
+			{Name: "bad", Quality: QualityBad, QualityReason: ReasonParseError, Timestamp: now.Add(-time.Hour)},
+		},
+	}
+
+	if n := e.MarkStale(10 * time.Minute); n != 1 {
+		t.Fatalf("MarkStale = %d, want 1", n)
+	}
+	want := []string{"", "", ReasonStale, ReasonParseError}
+	for i, dp := range e.Values {
+		if dp.QualityReason != want[i] {
+			t.Fatalf("%s reason = %q, want %q", dp.Name, dp.QualityReason, want[i])
+		}
+	}
+	if e.Values[2].Quality != QualityBad {
+		t.Fatalf("stale quality = %q, want bad", e.Values[2].Quality)
+	}
+}
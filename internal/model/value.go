@@ -0,0 +1,165 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+type ValueKind uint8
+
+const (
+	KindNull ValueKind = iota
+	KindFloat
+	KindInt
+	KindBool
+	KindString
+	KindDecimal
+)
+
+// Value is a typed data point value. It serializes to the same JSON as the
+// plain Go value, except that integers are decoded back as integers instead
+// of float64, so they keep their precision across the buffer. As in JSON, a
+// float without a fraction reads back as an int. Decimals are written as
+// strings holding the exact digits. The zero Value is null.
+type Value struct {
+	kind ValueKind
+	f    float64
+	i    int64
+	b    bool
+	s    string
+}
+
+func FloatValue(f float64) Value { return Value{kind: KindFloat, f: f} }
+
+func IntValue(i int64) Value { return Value{kind: KindInt, i: i} }
+
+func BoolValue(b bool) Value { return Value{kind: KindBool, b: b} }
+
+func StringValue(s string) Value { return Value{kind: KindString, s: s} }
+
+// DecimalValue holds a fixed-point number given in its canonical string form.
+func DecimalValue(s string) Value { return Value{kind: KindDecimal, s: s} }
+
+// ValueOf wraps a plain decoded value. Numbers without a fraction become
+// ints; values of other types are kept in their formatted string form.
+func ValueOf(raw any) Value {
+	switch val := raw.(type) {
+	case nil:
+		return Value{}
+	case Value:
+		return val
+	case float64:
+		return floatOrInt(val)
+	case float32:
+		return floatOrInt(float64(val))
+	case int:
+		return IntValue(int64(val))
+	case int64:
+		return IntValue(val)
+	case bool:
+		return BoolValue(val)
+	case string:
+		return StringValue(val)
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return IntValue(i)
+		}
+		if f, err := val.Float64(); err == nil {
+			return FloatValue(f)
+		}
+		return StringValue(val.String())
+	default:
+		return StringValue(fmt.Sprintf("%v", val))
+	}
+}
+
+// floatOrInt returns f as an int when it has no fraction and fits int64,
+// which is how its JSON form decodes.
+func floatOrInt(f float64) Value {
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return IntValue(int64(f))
+	}
+	return FloatValue(f)
+}
+
+func (v Value) Kind() ValueKind { return v.kind }
+
+func (v Value) IsNull() bool { return v.kind == KindNull }
+
+// Float returns the value as float64; ints are converted.
+func (v Value) Float() (float64, bool) {
+	switch v.kind {
+	case KindFloat:
+		return v.f, true
+	case KindInt:
+		return float64(v.i), true
+	case KindDecimal:
+		f, err := strconv.ParseFloat(v.s, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (v Value) Int() (int64, bool) {
+	return v.i, v.kind == KindInt
+}
+
+func (v Value) Bool() (bool, bool) {
+	return v.b, v.kind == KindBool
+}
+
+// String returns the string or decimal digits.
+func (v Value) String() string {
+	switch v.kind {
+	case KindString, KindDecimal:
+		return v.s
+	case KindNull:
+		return ""
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// Interface returns the plain Go value: float64, int64, bool, string or nil.
+func (v Value) Interface() any {
+	switch v.kind {
+	case KindFloat:
+		return v.f
+	case KindInt:
+		return v.i
+	case KindBool:
+		return v.b
+	case KindString, KindDecimal:
+		return v.s
+	}
+	return nil
+}
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	switch v.kind {
+	case KindInt:
+		return strconv.AppendInt(nil, v.i, 10), nil
+	case KindNull:
+		return []byte("null"), nil
+	}
+	return json.Marshal(v.Interface())
+}
+
+func (v *Value) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var raw any
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	switch raw.(type) {
+	case nil, bool, string, json.Number:
+		*v = ValueOf(raw)
+		return nil
+	}
+	return fmt.Errorf("unsupported value type %T", raw)
+}
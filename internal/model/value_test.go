@@ -0,0 +1,62 @@
+package model
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestValueJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Value
+		want Value
+	}{
+		{"max int64", IntValue(math.MaxInt64), IntValue(math.MaxInt64)},
+		{"min int64", IntValue(math.MinInt64), IntValue(math.MinInt64)},
+		{"beyond float precision", IntValue(1<<53 + 1), IntValue(1<<53 + 1)},
+		{"float", FloatValue(1.25), FloatValue(1.25)},
+		{"whole float", FloatValue(230), IntValue(230)},
+		{"huge float", FloatValue(1e300), FloatValue(1e300)},
+		{"bool", BoolValue(true), BoolValue(true)},
+		{"string", StringValue("on"), StringValue("on")},
+		{"decimal", DecimalValue("12.3400"), StringValue("12.3400")},
+		{"null", Value{}, Value{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Value
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("round trip of %s = %#v, want %#v", data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueOfKeepsKindAcrossRoundTrip(t *testing.T) {
+	for _, raw := range []any{
+		float64(3), float64(-0.0), float64(2.5), float32(7), float64(1 << 62),
+		float64(1e19), int64(math.MaxInt64), json.Number("9007199254740993"),
+	} {
+		v := ValueOf(raw)
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal %v: %v", raw, err)
+		}
+		var back Value
+		if err := json.Unmarshal(data, &back); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		if back.Kind() != v.Kind() || back != v {
+			t.Fatalf("ValueOf(%v) = %#v, reads back as %#v", raw, v, back)
+		}
+	}
+}
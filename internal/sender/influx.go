@@ -0,0 +1,192 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/lib/redirect"
+	"github.com/speedwagon-io/asutp/internal/lib/tlsutil"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// InfluxSender writes data points to an InfluxDB v2 bucket in line protocol.
+// Each point becomes one line with the device group as measurement, station,
+// device and field as tags and the value in the "value" field.
+type InfluxSender struct {
+	log       *slog.Logger
+	writeURL  string
+	healthURL string
+	token     string
+	client    *http.Client
+}
+
+func NewInfluxSender(log *slog.Logger, cfg *config.SenderConfig, tlsCfg *tls.Config) (*InfluxSender, error) {
+	if cfg.Influx.URL == "" {
+		return nil, errors.New("influx url is not configured")
+	}
+	if cfg.Influx.Org == "" || cfg.Influx.Bucket == "" {
+		return nil, errors.New("influx org and bucket are required")
+	}
+
+	query := url.Values{}
+	query.Set("org", cfg.Influx.Org)
+	query.Set("bucket", cfg.Influx.Bucket)
+	query.Set("precision", "ns")
+
+	base := strings.TrimSuffix(cfg.Influx.URL, "/")
+	return &InfluxSender{
+		log:       log,
+		writeURL:  base + "/api/v2/write?" + query.Encode(),
+		healthURL: base + "/health",
+		token:     cfg.Influx.Token,
+		client: &http.Client{
+			Timeout:       cfg.Timeout,
+			Transport:     tlsutil.NewTransport(tlsCfg),
+			CheckRedirect: redirect.CheckRedirect(cfg.Redirects),
+		},
+	}, nil
+}
+
+func (s *InfluxSender) Send(ctx context.Context, envelope *model.Envelope) error {
+	return s.SendBatch(ctx, []*model.Envelope{envelope})
+}
+
+func (s *InfluxSender) SendBatch(ctx context.Context, envelopes []*model.Envelope) error {
+	var body bytes.Buffer
+	for _, envelope := range envelopes {
+		writeLines(&body, envelope)
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+
+	return s.write(ctx, body.Bytes())
+}
+
+// Health probes the InfluxDB /health endpoint. An empty write cannot serve
+// as a probe, since InfluxDB rejects it with 400.
+func (s *InfluxSender) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.healthURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health request: %w", err)
+	}
+	return s.do(req)
+}
+
+func (s *InfluxSender) write(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.writeURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return s.do(req)
+}
+
+// do sends req with the token and fails on a non-2xx status.
+func (s *InfluxSender) do(req *http.Request) error {
+	req.Header.Set("Authorization", "Token "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+}
+
+// writeLines appends one line per data point. Null and non-finite values are
+// skipped since line protocol cannot represent them; a point's raw source
+// value, when present, is written as a string field raw.
+func writeLines(buf *bytes.Buffer, envelope *model.Envelope) {
+	measurement := envelope.DeviceGroup
+	if measurement == "" {
+		measurement = "default"
+	}
+
+	for _, point := range envelope.Values {
+		field, ok := lineField(point.Value)
+		raw, hasRaw := rawField(point.Raw)
+		if !ok && !hasRaw {
+			continue
+		}
+
+		buf.WriteString(measurementEscaper.Replace(measurement))
+		buf.WriteString(",device=")
+		buf.WriteString(tagEscaper.Replace(envelope.DeviceID))
+		buf.WriteString(",field=")
+		buf.WriteString(tagEscaper.Replace(point.Name))
+		buf.WriteString(",station=")
+		buf.WriteString(tagEscaper.Replace(envelope.StationID))
+		sep := byte(' ')
+		if ok {
+			buf.WriteString(" value=")
+			buf.WriteString(field)
+			sep = ','
+		}
+		if hasRaw {
+			buf.WriteByte(sep)
+			buf.WriteString("raw=")
+			buf.WriteString(raw)
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(point.TimeOr(envelope.Timestamp).UnixNano(), 10))
+		buf.WriteByte('\n')
+	}
+}
+
+// lineField formats a value as a line protocol field value.
+func lineField(v model.Value) (string, bool) {
+	switch v.Kind() {
+	case model.KindInt:
+		i, _ := v.Int()
+		return strconv.FormatInt(i, 10) + "i", true
+	case model.KindFloat, model.KindDecimal:
+		f, ok := v.Float()
+		if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), true
+	case model.KindBool:
+		b, _ := v.Bool()
+		return strconv.FormatBool(b), true
+	case model.KindString:
+		return `"` + stringFieldEscaper.Replace(v.String()) + `"`, true
+	}
+	return "", false
+}
+
+// rawField formats a raw source value as a quoted JSON string field.
+func rawField(raw any) (string, bool) {
+	if raw == nil {
+		return "", false
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return "", false
+	}
+	return `"` + stringFieldEscaper.Replace(string(data)) + `"`, true
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringFieldEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
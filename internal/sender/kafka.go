@@ -0,0 +1,121 @@
+package sender
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// KafkaSender produces envelopes to a Kafka topic keyed by station and device
+// ID so that all data of one device lands in the same partition.
+type KafkaSender struct {
+	log     *slog.Logger
+	brokers []string
+	dialer  *kafka.Dialer
+	writer  *kafka.Writer
+}
+
+// NewKafkaSender creates the sender. tlsCfg, when set, makes it dial the
+// brokers over TLS with the CA bundle configured for the sender.
+func NewKafkaSender(log *slog.Logger, cfg *config.SenderConfig, tlsCfg *tls.Config) (*KafkaSender, error) {
+	if len(cfg.Kafka.Brokers) == 0 {
+		return nil, errors.New("kafka brokers are not configured")
+	}
+	if cfg.Kafka.Topic == "" {
+		return nil, errors.New("kafka topic is not configured")
+	}
+
+	compression, err := kafkaCompression(cfg.Kafka.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Kafka.Brokers...),
+		Topic:        cfg.Kafka.Topic,
+		Balancer:     &kafka.Hash{},
+		MaxAttempts:  cfg.Retry.MaxAttempts,
+		BatchTimeout: cfg.Kafka.BatchTimeout,
+		WriteTimeout: cfg.Timeout,
+		RequiredAcks: kafka.RequiredAcks(cfg.Kafka.RequiredAcks),
+		Compression:  compression,
+		Transport: &kafka.Transport{
+			ClientID: cfg.Kafka.ClientID,
+			TLS:      tlsCfg,
+		},
+	}
+
+	return &KafkaSender{
+		log:     log,
+		brokers: cfg.Kafka.Brokers,
+		dialer:  &kafka.Dialer{ClientID: cfg.Kafka.ClientID, TLS: tlsCfg},
+		writer:  writer,
+	}, nil
+}
+
+func kafkaCompression(name string) (kafka.Compression, error) {
+	switch name {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unknown kafka compression: %s", name)
+	}
+}
+
+func (s *KafkaSender) Send(ctx context.Context, envelope *model.Envelope) error {
+	return s.SendBatch(ctx, []*model.Envelope{envelope})
+}
+
+func (s *KafkaSender) SendBatch(ctx context.Context, envelopes []*model.Envelope) error {
+	messages := make([]kafka.Message, 0, len(envelopes))
+	for _, envelope := range envelopes {
+		data, err := json.Marshal(envelope)
+		if err != nil {
+			return fmt.Errorf("failed to marshal envelope: %w", err)
+		}
+		messages = append(messages, kafka.Message{
+			Key:   []byte(envelope.StationID + "/" + envelope.DeviceID),
+			Value: data,
+		})
+	}
+
+	if err := s.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("failed to write messages: %w", err)
+	}
+
+	return nil
+}
+
+// Health succeeds if at least one broker accepts a connection.
+func (s *KafkaSender) Health(ctx context.Context) error {
+	var lastErr error
+	for _, broker := range s.brokers {
+		conn, err := s.dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn.Close()
+		return nil
+	}
+	return fmt.Errorf("no kafka broker reachable: %w", lastErr)
+}
+
+func (s *KafkaSender) Close() error {
+	return s.writer.Close()
+}
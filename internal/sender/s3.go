@@ -0,0 +1,227 @@
+package sender
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/lib/tlsutil"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+// S3Sender archives envelopes as gzip-compressed NDJSON objects in an
+// S3-compatible bucket, keyed
+// <prefix>/station=<id>/date=<yyyy-mm-dd>/<unix nano>-<digest>.ndjson.gz,
+// where the time is that of the first envelope and the digest covers the
+// envelope IDs. A retried upload thus overwrites the objects it already
+// uploaded instead of duplicating them.
+//
+// Live sends are held in memory and uploaded together once flushSize
+// envelopes are pending, on every flush interval and on Close, so a device
+// reading does not cost an object and a request of its own.
+type S3Sender struct {
+	log       *slog.Logger
+	client    *minio.Client
+	bucket    string
+	prefix    string
+	timeout   time.Duration
+	flushSize int
+
+	mu      sync.Mutex
+	pending []*model.Envelope
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewS3Sender creates the sender and starts its flush loop. tlsCfg, when set,
+// carries the CA bundle configured for the sender.
+func NewS3Sender(log *slog.Logger, cfg *config.SenderConfig, tlsCfg *tls.Config) (*S3Sender, error) {
+	if cfg.S3.Endpoint == "" || cfg.S3.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+
+	client, err := minio.New(cfg.S3.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(cfg.S3.AccessKey, cfg.S3.SecretKey, ""),
+		Secure:    cfg.S3.UseTLS,
+		Region:    cfg.S3.Region,
+		Transport: tlsutil.NewTransport(tlsCfg),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	s := &S3Sender{
+		log:       log,
+		client:    client,
+		bucket:    cfg.S3.Bucket,
+		prefix:    cfg.S3.Prefix,
+		timeout:   cfg.Timeout,
+		flushSize: max(cfg.S3.FlushSize, 1),
+		stopCh:    make(chan struct{}),
+	}
+	if cfg.S3.FlushInterval > 0 {
+		s.wg.Add(1)
+		go s.flushLoop(cfg.S3.FlushInterval)
+	}
+	return s, nil
+}
+
+// Send queues the envelope for the next upload and uploads the pending
+// envelopes once there are flushSize of them. A failed upload keeps them
+// pending; while the queue is full and cannot be uploaded, Send returns the
+// error without taking the envelope, so the caller buffers it.
+func (s *S3Sender) Send(ctx context.Context, envelope *model.Envelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) >= s.flushSize {
+		if err := s.flushLocked(ctx); err != nil {
+			return err
+		}
+	}
+
+	s.pending = append(s.pending, envelope)
+	if len(s.pending) >= s.flushSize {
+		if err := s.flushLocked(ctx); err != nil {
+			s.log.Warn("failed to upload s3 batch, keeping it for the next flush",
+				slog.Int("count", len(s.pending)), sl.Err(err))
+		}
+	}
+	return nil
+}
+
+// Flush uploads the pending envelopes.
+func (s *S3Sender) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushLocked(ctx)
+}
+
+func (s *S3Sender) flushLocked(ctx context.Context) error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	if err := s.SendBatch(ctx, s.pending); err != nil {
+		return err
+	}
+	s.pending = nil
+	return nil
+}
+
+func (s *S3Sender) flushLoop(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+			if err := s.Flush(ctx); err != nil {
+				s.log.Warn("failed to upload s3 batch, keeping it for the next flush", sl.Err(err))
+			}
+			cancel()
+		}
+	}
+}
+
+// Close stops the flush loop and uploads the envelopes still pending.
+func (s *S3Sender) Close() error {
+	close(s.stopCh)
+	s.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.Flush(ctx)
+}
+
+// SendBatch uploads one object per station and day present in the batch.
+func (s *S3Sender) SendBatch(ctx context.Context, envelopes []*model.Envelope) error {
+	var keys []string
+	partitions := make(map[string][]*model.Envelope)
+	for _, envelope := range envelopes {
+		key := path.Join(s.prefix,
+			"station="+envelope.StationID,
+			"date="+envelope.Timestamp.UTC().Format(time.DateOnly),
+		)
+		if _, ok := partitions[key]; !ok {
+			keys = append(keys, key)
+		}
+		partitions[key] = append(partitions[key], envelope)
+	}
+
+	for _, key := range keys {
+		if err := s.upload(ctx, key, partitions[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3Sender) upload(ctx context.Context, dir string, envelopes []*model.Envelope) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for _, envelope := range envelopes {
+		if err := enc.Encode(envelope); err != nil {
+			return fmt.Errorf("failed to marshal envelope: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress envelopes: %w", err)
+	}
+
+	key := path.Join(dir, objectName(envelopes))
+	_, err := s.client.PutObject(ctx, s.bucket, key, &buf, int64(buf.Len()), minio.PutObjectOptions{
+		ContentType:     "application/x-ndjson",
+		ContentEncoding: "gzip",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+
+	s.log.Debug("envelopes archived", slog.String("key", key), slog.Int("count", len(envelopes)))
+	return nil
+}
+
+// objectName derives the object name from the envelopes, so the same batch
+// always maps to the same object.
+func objectName(envelopes []*model.Envelope) string {
+	h := sha256.New()
+	for _, envelope := range envelopes {
+		h.Write([]byte(envelope.ID))
+		h.Write([]byte{0})
+	}
+	digest := hex.EncodeToString(h.Sum(nil)[:8])
+	return fmt.Sprintf("%d-%s.ndjson.gz", envelopes[0].Timestamp.UnixNano(), digest)
+}
+
+// Health checks that the bucket exists and the credentials can reach it.
+func (s *S3Sender) Health(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("s3 unreachable: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("s3 bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package sender
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+func TestObjectNameStableAcrossRetries(t *testing.T) {
+	envelopes := []*model.Envelope{testEnvelope(1), testEnvelope(1)}
+
+	first := objectName(envelopes)
+	if again := objectName(envelopes); again != first {
+		t.Fatalf("retry object %q differs from %q", again, first)
+	}
+	if other := objectName(envelopes[:1]); other == first {
+		t.Fatalf("different batches share object %q", first)
+	}
+}
+
+func TestS3SendUploadsOneObjectPerFlush(t *testing.T) {
+	var puts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			puts.Add(1)
+			io.Copy(io.Discard, r.Body)
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := &config.SenderConfig{
+		Timeout: time.Second,
+		S3: config.S3Config{
+			Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+			Region:    "us-east-1",
+			Bucket:    "archive",
+			FlushSize: 3,
+		},
+	}
+	s, err := NewS3Sender(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 4 {
+		if err := s.Send(context.Background(), testEnvelope(1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := puts.Load(); got != 1 {
+		t.Fatalf("uploaded %d objects after a full batch, want 1", got)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := puts.Load(); got != 2 {
+		t.Fatalf("uploaded %d objects after Close, want 2", got)
+	}
+}
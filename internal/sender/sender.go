@@ -3,15 +3,23 @@ package sender
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/speedwagon-io/asutp/internal/config"
 	"github.com/speedwagon-io/asutp/internal/lib/logger/sl"
+	"github.com/speedwagon-io/asutp/internal/lib/redirect"
+	"github.com/speedwagon-io/asutp/internal/lib/tlsutil"
 	"github.com/speedwagon-io/asutp/internal/model"
 )
 
@@ -21,29 +29,107 @@ type Sender interface {
 	Health(ctx context.Context) error
 }
 
+// ReplaySender is implemented by senders that retry failed sends, so that
+// replays of buffered data can use a retry policy of their own, e.g. to fail
+// fast where the data is already durable.
+type ReplaySender interface {
+	SendWithRetry(ctx context.Context, envelope *model.Envelope, retry RetryConfig) error
+	SendBatchWithRetry(ctx context.Context, envelopes []*model.Envelope, retry RetryConfig) error
+}
+
+// EncodedBatchSender is implemented by senders that can reuse the JSON the
+// caller already encoded for each envelope, e.g. to size batches, instead of
+// encoding the envelopes again. encoded[i] holds envelopes[i].
+type EncodedBatchSender interface {
+	SendEncodedBatch(ctx context.Context, envelopes []*model.Envelope, encoded []json.RawMessage, retry RetryConfig) error
+}
+
+// BatchError reports a batch that was delivered only in part: the envelopes
+// in Sent reached their destination, the rest failed with Err.
+type BatchError struct {
+	Sent []*model.Envelope
+	Err  error
+}
+
+func (e *BatchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
 type HTTPSender struct {
 	log         *slog.Logger
 	baseURL     string
+	groupURLs   map[string]string
 	stationDBID int
-	token       string
+	tokens      TokenProvider
+	refreshAuth bool
 	client      *http.Client
 	retry       *RetryConfig
+	healthURL   string
+	healthTTL   time.Duration
+	throughput  *throughput
+	encode      func(buf *bytes.Buffer, v any) error
+	contentType string
+	compact     bool
+
+	healthMu  sync.Mutex
+	healthErr error
+	healthAt  time.Time
 }
 
+var errUnauthorized = errors.New("request unauthorized")
+
 type RetryConfig struct {
 	MaxAttempts  int
 	InitialDelay time.Duration
 	MaxDelay     time.Duration
 }
 
-func NewHTTPSender(log *slog.Logger, cfg *config.SenderConfig, stationDBID int) *HTTPSender {
+// CorrelationHeader carries the correlation ID of a single envelope send, or
+// an ID generated for a batch; batched envelopes carry their own IDs in the
+// body.
+const CorrelationHeader = "X-Correlation-ID"
+
+func NewHTTPSender(log *slog.Logger, cfg *config.SenderConfig, stationDBID int, tlsCfg *tls.Config) *HTTPSender {
+	healthURL := cfg.HealthURL
+	if healthURL == "" {
+		healthURL = fmt.Sprintf("%s/%d", cfg.URL, stationDBID)
+	}
+
+	if cfg.TLSServerName != "" {
+		if tlsCfg == nil {
+			tlsCfg = &tls.Config{MinVersion: tls.VersionTLS12}
+		} else {
+			tlsCfg = tlsCfg.Clone()
+		}
+		tlsCfg.ServerName = cfg.TLSServerName
+	}
+
+	encode, contentType := encodeJSON, "application/json"
+	if cfg.Format == "cbor" {
+		encode, contentType = encodeCBOR, model.ContentTypeCBOR
+	}
+
 	return &HTTPSender{
 		log:         log,
 		baseURL:     cfg.URL,
+		groupURLs:   cfg.GroupURLs,
 		stationDBID: stationDBID,
-		token:       cfg.Token,
+		tokens:      staticToken(cfg.Token),
+		refreshAuth: cfg.RefreshOnAuthError,
+		healthURL:   healthURL,
+		healthTTL:   cfg.HealthCacheTTL,
+		throughput:  newThroughput(),
+		encode:      encode,
+		contentType: contentType,
+		compact:     cfg.BatchFormat == "compact",
 		client: &http.Client{
-			Timeout: cfg.Timeout,
+			Timeout:       cfg.Timeout,
+			Transport:     tlsutil.NewTransport(tlsCfg),
+			CheckRedirect: redirect.CheckRedirect(cfg.Redirects),
 		},
 		retry: &RetryConfig{
 			MaxAttempts:  cfg.Retry.MaxAttempts,
@@ -53,30 +139,185 @@ func NewHTTPSender(log *slog.Logger, cfg *config.SenderConfig, stationDBID int)
 	}
 }
 
+// SetTokenProvider replaces the static configured token.
+func (s *HTTPSender) SetTokenProvider(tokens TokenProvider) {
+	s.tokens = tokens
+}
+
 func (s *HTTPSender) Send(ctx context.Context, envelope *model.Envelope) error {
-	data, err := json.Marshal(envelope)
-	if err != nil {
+	return s.SendWithRetry(ctx, envelope, *s.retry)
+}
+
+// SendWithRetry sends the envelope like Send, retrying according to retry
+// instead of the configured policy.
+func (s *HTTPSender) SendWithRetry(ctx context.Context, envelope *model.Envelope, retry RetryConfig) error {
+	var buf bytes.Buffer
+	if err := s.encode(&buf, envelope); err != nil {
 		return fmt.Errorf("failed to marshal envelope: %w", err)
 	}
 
-	return s.sendWithRetry(ctx, data)
+	return s.sendWithRetry(ctx, s.urlFor(envelope.DeviceGroup), buf.Bytes(), 1, envelope.CorrelationID, &retry)
+}
+
+// encodeJSON appends v to buf with the same bytes json.Marshal produces,
+// skipping the copy Marshal makes of its output. The body is still built in
+// full, since retries resend it.
+func encodeJSON(buf *bytes.Buffer, v any) error {
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	// Drop the newline json.Encoder terminates each value with.
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+func encodeCBOR(buf *bytes.Buffer, v any) error {
+	return model.EncodeCBOR(buf, v)
+}
+
+// Throughput returns send counters and rolling rates.
+func (s *HTTPSender) Throughput() ThroughputStats {
+	return s.throughput.stats()
 }
 
+// SendBatch groups envelopes by destination URL and sends one batch per
+// destination. A failed destination does not stop the others; when some
+// succeeded, the error is a *BatchError listing the envelopes sent.
 func (s *HTTPSender) SendBatch(ctx context.Context, envelopes []*model.Envelope) error {
-	data, err := json.Marshal(envelopes)
-	if err != nil {
+	return s.sendBatch(ctx, envelopes, nil, s.retry)
+}
+
+// SendBatchWithRetry sends the envelopes like SendBatch, retrying according
+// to retry instead of the configured policy.
+func (s *HTTPSender) SendBatchWithRetry(ctx context.Context, envelopes []*model.Envelope, retry RetryConfig) error {
+	return s.sendBatch(ctx, envelopes, nil, &retry)
+}
+
+// SendEncodedBatch sends the envelopes like SendBatchWithRetry, building a
+// JSON array body from encoded. Other payload formats encode the envelopes.
+func (s *HTTPSender) SendEncodedBatch(ctx context.Context, envelopes []*model.Envelope, encoded []json.RawMessage, retry RetryConfig) error {
+	unusable := len(encoded) != len(envelopes) || slices.ContainsFunc(encoded, func(raw json.RawMessage) bool {
+		return len(raw) == 0
+	})
+	if s.compact || s.contentType != "application/json" || unusable {
+		encoded = nil
+	}
+	return s.sendBatch(ctx, envelopes, encoded, &retry)
+}
+
+func (s *HTTPSender) sendBatch(ctx context.Context, envelopes []*model.Envelope, encoded []json.RawMessage, retry *RetryConfig) error {
+	var urls []string
+	byURL := make(map[string][]int)
+	for i, envelope := range envelopes {
+		url := s.urlFor(envelope.DeviceGroup)
+		if _, ok := byURL[url]; !ok {
+			urls = append(urls, url)
+		}
+		byURL[url] = append(byURL[url], i)
+	}
+
+	var (
+		sent []*model.Envelope
+		errs []error
+	)
+	for _, url := range urls {
+		batch := make([]*model.Envelope, len(byURL[url]))
+		for j, i := range byURL[url] {
+			batch[j] = envelopes[i]
+		}
+
+		var buf bytes.Buffer
+		if encoded != nil {
+			buf.WriteByte('[')
+			for j, i := range byURL[url] {
+				if j > 0 {
+					buf.WriteByte(',')
+				}
+				buf.Write(encoded[i])
+			}
+			buf.WriteByte(']')
+		} else if err := s.encodeBatch(&buf, batch); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		batchID := uuid.NewString()
+		s.log.Debug("sending batch",
+			slog.String("url", url),
+			slog.String("correlation_id", batchID),
+			slog.Int("envelopes", len(batch)),
+		)
+		if err := s.sendWithRetry(ctx, url, buf.Bytes(), len(batch), batchID, retry); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sent = append(sent, batch...)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	err := errors.Join(errs...)
+	if len(sent) > 0 {
+		return &BatchError{Sent: sent, Err: err}
+	}
+	return err
+}
+
+// encodeBatch encodes envelopes as an array or, in compact mode, as a
+// model.EnvelopeBatch sharing one station header.
+func (s *HTTPSender) encodeBatch(buf *bytes.Buffer, envelopes []*model.Envelope) error {
+	var payload any = envelopes
+	if s.compact {
+		batch, err := model.NewEnvelopeBatch(envelopes)
+		if err != nil {
+			return fmt.Errorf("failed to build envelope batch: %w", err)
+		}
+		payload = batch
+	}
+
+	if err := s.encode(buf, payload); err != nil {
 		return fmt.Errorf("failed to marshal envelopes: %w", err)
 	}
+	return nil
+}
 
-	return s.sendWithRetry(ctx, data)
+// urlFor returns the destination URL for a device group, falling back to the
+// default URL for unmapped groups.
+func (s *HTTPSender) urlFor(group string) string {
+	base := s.baseURL
+	if groupURL, ok := s.groupURLs[group]; ok {
+		base = groupURL
+	}
+	return fmt.Sprintf("%s/%d", base, s.stationDBID)
 }
 
-func (s *HTTPSender) sendWithRetry(ctx context.Context, data []byte) error {
-	var lastErr error
-	delay := s.retry.InitialDelay
+// sendWithRetry posts data carrying count envelopes, retrying with backoff.
+// correlationID, when set, is sent in the CorrelationHeader.
+func (s *HTTPSender) sendWithRetry(ctx context.Context, url string, data []byte, count int, correlationID string, retry *RetryConfig) error {
+	err := s.retrySend(ctx, url, data, correlationID, retry)
+	if err != nil {
+		s.throughput.recordFailed(count)
+		return err
+	}
+	s.throughput.recordSent(count, len(data))
+	return nil
+}
 
-	for attempt := 1; attempt <= s.retry.MaxAttempts; attempt++ {
-		err := s.doSend(ctx, data)
+// retrySend makes up to retry.MaxAttempts attempts, and always at least one.
+func (s *HTTPSender) retrySend(ctx context.Context, url string, data []byte, correlationID string, retry *RetryConfig) error {
+	var lastErr error
+	attempts := max(retry.MaxAttempts, 1)
+	delay := retry.InitialDelay
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err := s.doSend(ctx, url, data, correlationID)
+		if errors.Is(err, errUnauthorized) {
+			err = s.retryWithRefreshedToken(ctx, url, data, correlationID, err)
+			if errors.Is(err, errUnauthorized) {
+				return err
+			}
+		}
 		if err == nil {
 			return nil
 		}
@@ -84,33 +325,64 @@ func (s *HTTPSender) sendWithRetry(ctx context.Context, data []byte) error {
 		lastErr = err
 		s.log.Warn("send attempt failed",
 			slog.Int("attempt", attempt),
-			slog.Int("max_attempts", s.retry.MaxAttempts),
+			slog.Int("max_attempts", attempts),
 			sl.Err(err),
 		)
 
-		if attempt < s.retry.MaxAttempts {
+		if attempt < attempts {
+			wait := delay
+			var throttled *retryAfterError
+			if errors.As(err, &throttled) {
+				wait = min(throttled.delay, retry.MaxDelay)
+				s.log.Info("server requested retry delay", slog.Duration("retry_after", wait))
+			}
+
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
-			case <-time.After(delay):
+			case <-time.After(wait):
 			}
 
-			delay = s.nextDelay(delay)
+			delay = nextDelay(delay, retry.MaxDelay)
 		}
 	}
 
-	return fmt.Errorf("all %d attempts failed: %w", s.retry.MaxAttempts, lastErr)
+	return fmt.Errorf("all %d attempts failed: %w", attempts, lastErr)
+}
+
+// retryWithRefreshedToken refreshes the token after an auth rejection and
+// resends once. It returns the original error when refreshing is disabled or
+// yields the same token.
+func (s *HTTPSender) retryWithRefreshedToken(ctx context.Context, url string, data []byte, correlationID string, authErr error) error {
+	if !s.refreshAuth {
+		return authErr
+	}
+
+	old := s.tokens.Token()
+	token, err := s.tokens.Refresh(ctx)
+	if err != nil {
+		s.log.Error("failed to refresh sender token", sl.Err(err))
+		return authErr
+	}
+	if token == old {
+		return authErr
+	}
+
+	s.log.Info("sender token refreshed, retrying")
+	return s.doSend(ctx, url, data, correlationID)
 }
 
-func (s *HTTPSender) doSend(ctx context.Context, data []byte) error {
-	url := fmt.Sprintf("%s/%d", s.baseURL, s.stationDBID)
+func (s *HTTPSender) doSend(ctx context.Context, url string, data []byte, correlationID string) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", s.contentType)
+	s.authorize(req)
+	if correlationID != "" {
+		req.Header.Set(CorrelationHeader, correlationID)
+	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -123,25 +395,96 @@ func (s *HTTPSender) doSend(ctx context.Context, data []byte) error {
 	}
 
 	body, _ := io.ReadAll(resp.Body)
-	return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: status %d: %s", errUnauthorized, resp.StatusCode, string(body))
+	}
+	err = fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return &retryAfterError{err: err, delay: delay}
+		}
+	}
+	return err
+}
+
+// authorize sets the bearer token on req, leaving the header out when no
+// token is configured.
+func (s *HTTPSender) authorize(req *http.Request) {
+	if token := s.tokens.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// retryAfterError carries the delay a throttling server asked for.
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
 }
 
-func (s *HTTPSender) nextDelay(current time.Duration) time.Duration {
+// parseRetryAfter parses a Retry-After header given either as delay seconds
+// or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+func nextDelay(current, maxDelay time.Duration) time.Duration {
 	next := current * 2
-	if next > s.retry.MaxDelay {
-		return s.retry.MaxDelay
+	if next > maxDelay {
+		return maxDelay
 	}
 	return next
 }
 
 func (s *HTTPSender) Health(ctx context.Context) error {
-	url := fmt.Sprintf("%s/%d", s.baseURL, s.stationDBID)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	_, err := s.CachedHealth(ctx)
+	return err
+}
+
+// CachedHealth returns the last probe result and its age while it is younger
+// than the health cache TTL, probing the health URL otherwise. Concurrent
+// callers share a single probe.
+func (s *HTTPSender) CachedHealth(ctx context.Context) (time.Duration, error) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	if !s.healthAt.IsZero() && s.healthTTL > 0 {
+		if age := time.Since(s.healthAt); age < s.healthTTL {
+			return age, s.healthErr
+		}
+	}
+
+	s.healthErr = s.probe(ctx)
+	s.healthAt = time.Now()
+	return 0, s.healthErr
+}
+
+func (s *HTTPSender) probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.healthURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create health request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+s.token)
+	s.authorize(req)
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -159,13 +502,34 @@ func (s *HTTPSender) Health(ctx context.Context) error {
 // LogSender logs envelopes instead of sending them (for testing)
 type LogSender struct {
 	log *slog.Logger
+
+	diffs   bool
+	epsilon float64
+	mu      sync.Mutex
+	prev    map[string]*model.Envelope
 }
 
+// metaEvent mirrors collector.MetaEvent, which cannot be imported here.
+const metaEvent = "event"
+
 func NewLogSender(log *slog.Logger) *LogSender {
 	return &LogSender{log: log}
 }
 
+// SetLogDiffs makes Send log only the changes since the previous envelope of
+// the same device, split part and kind (reading or event). Numbers within
+// epsilon are treated as unchanged.
+func (s *LogSender) SetLogDiffs(enabled bool, epsilon float64) {
+	s.diffs = enabled
+	s.epsilon = epsilon
+	s.prev = make(map[string]*model.Envelope)
+}
+
 func (s *LogSender) Send(ctx context.Context, envelope *model.Envelope) error {
+	if s.diffs {
+		return s.logDiff(envelope)
+	}
+
 	data, err := json.MarshalIndent(envelope, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal envelope: %w", err)
@@ -179,6 +543,45 @@ func (s *LogSender) Send(ctx context.Context, envelope *model.Envelope) error {
 		slog.String("payload", string(data)),
 	)
 
+	// Points carrying a raw value usually failed conversion; call them out
+	// so they are not lost in the payload.
+	for _, point := range envelope.Values {
+		if point.Raw == nil {
+			continue
+		}
+		s.log.Warn("RAW",
+			slog.String("device_id", envelope.DeviceID),
+			slog.String("name", point.Name),
+			slog.String("quality", point.Quality),
+			slog.Any("raw", point.Raw),
+		)
+	}
+
+	return nil
+}
+
+func (s *LogSender) logDiff(envelope *model.Envelope) error {
+	// The values may live in a pooled slice that is reused once the send
+	// returns, so the baseline keeps its own copy.
+	key := envelope.DeviceID + "\x00" + envelope.Meta[model.MetaPart] + "\x00" + envelope.Meta[metaEvent]
+	s.mu.Lock()
+	prev := s.prev[key]
+	s.prev[key] = &model.Envelope{Values: slices.Clone(envelope.Values)}
+	s.mu.Unlock()
+
+	changes := model.DiffEnvelopes(prev, envelope, s.epsilon)
+	data, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal diff: %w", err)
+	}
+
+	s.log.Info("SEND",
+		slog.String("device_id", envelope.DeviceID),
+		slog.String("device_name", envelope.DeviceName),
+		slog.Int("values_count", len(envelope.Values)),
+		slog.Int("changes", len(changes)),
+		slog.String("diff", string(data)),
+	)
 	return nil
 }
 
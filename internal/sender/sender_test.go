@@ -0,0 +1,211 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/config"
+	"github.com/speedwagon-io/asutp/internal/model"
+)
+
+func testEnvelope(n int) *model.Envelope {
+	points := make([]model.DataPoint, n)
+	for i := range points {
+		points[i] = model.DataPoint{
+			Name:    "field_" + strconv.Itoa(i),
+			Value:   model.FloatValue(float64(i) * 1.5),
+			Unit:    "kW",
+			Quality: model.QualityGood,
+		}
+	}
+	return model.NewEnvelope("st", "Station", "dev", "Device", "group", points)
+}
+
+func TestEncodeJSONMatchesMarshal(t *testing.T) {
+	envelope := testEnvelope(3)
+	envelope.Values[0].Name = "<html>&"
+
+	want, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, envelope); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("encodeJSON differs from json.Marshal:\n got %s\nwant %s", buf.Bytes(), want)
+	}
+}
+
+func BenchmarkEncodeJSON10k(b *testing.B) {
+	envelope := testEnvelope(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := encodeJSON(&buf, envelope); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeCBOR10k(b *testing.B) {
+	envelope := testEnvelope(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := encodeCBOR(&buf, envelope); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSendBatchCorrelationIDs(t *testing.T) {
+	var (
+		header string
+		body   []*model.Envelope
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(CorrelationHeader)
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	cfg := &config.SenderConfig{URL: srv.URL, Token: "token", Retry: config.RetryConfig{MaxAttempts: 1}}
+	s := NewHTTPSender(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, 1, nil)
+
+	envelopes := []*model.Envelope{testEnvelope(1), testEnvelope(1)}
+	envelopes[0].CorrelationID = "tick/meter1"
+	envelopes[1].CorrelationID = "tick/meter2"
+	if err := s.SendBatch(context.Background(), envelopes); err != nil {
+		t.Fatal(err)
+	}
+
+	if header == "" || strings.Contains(header, ",") {
+		t.Fatalf("%s = %q, want a single batch ID", CorrelationHeader, header)
+	}
+	if len(body) != 2 || body[0].CorrelationID != "tick/meter1" || body[1].CorrelationID != "tick/meter2" {
+		t.Fatalf("batch body lost the envelope correlation IDs: %+v", body)
+	}
+}
+
+func TestSendWithRetryOverridesPolicy(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := &config.SenderConfig{URL: srv.URL, Retry: config.RetryConfig{MaxAttempts: 5, InitialDelay: time.Hour}}
+	s := NewHTTPSender(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, 1, nil)
+
+	for _, attempts := range []int{2, 0} {
+		requests.Store(0)
+		err := s.SendWithRetry(context.Background(), testEnvelope(1), RetryConfig{MaxAttempts: attempts})
+		if err == nil || strings.Contains(err.Error(), "%!") {
+			t.Fatalf("MaxAttempts %d: got error %v", attempts, err)
+		}
+		if want := max(attempts, 1); int(requests.Load()) != want {
+			t.Errorf("MaxAttempts %d: made %d requests, want %d", attempts, requests.Load(), want)
+		}
+	}
+}
+
+func TestSendBatchReportsPartialDelivery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/down/") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &config.SenderConfig{
+		URL:       srv.URL,
+		GroupURLs: map[string]string{"down": srv.URL + "/down"},
+		Retry:     config.RetryConfig{MaxAttempts: 1},
+	}
+	s := NewHTTPSender(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, 1, nil)
+
+	up, down := testEnvelope(1), testEnvelope(1)
+	down.DeviceGroup = "down"
+	err := s.SendBatch(context.Background(), []*model.Envelope{down, up})
+
+	var partial *BatchError
+	if !errors.As(err, &partial) {
+		t.Fatalf("SendBatch error = %v, want a *BatchError", err)
+	}
+	if len(partial.Sent) != 1 || partial.Sent[0] != up {
+		t.Fatalf("BatchError.Sent = %v, want only the envelope of the healthy URL", partial.Sent)
+	}
+}
+
+func TestSendEncodedBatchMatchesSendBatch(t *testing.T) {
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, body)
+	}))
+	defer srv.Close()
+
+	cfg := &config.SenderConfig{URL: srv.URL, Retry: config.RetryConfig{MaxAttempts: 1}}
+	s := NewHTTPSender(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, 1, nil)
+
+	envelopes := []*model.Envelope{testEnvelope(2), testEnvelope(3)}
+	var encoded []json.RawMessage
+	for _, envelope := range envelopes {
+		data, err := json.Marshal(envelope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded = append(encoded, data)
+	}
+
+	if err := s.SendBatch(context.Background(), envelopes); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SendEncodedBatch(context.Background(), envelopes, encoded, RetryConfig{MaxAttempts: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || !bytes.Equal(bodies[0], bodies[1]) {
+		t.Fatalf("encoded batch body differs:\n%s\n%s", bodies[0], bodies[1])
+	}
+}
+
+func TestInfluxHealthProbesHealthEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Authorization") != "Token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := &config.SenderConfig{Influx: config.InfluxConfig{URL: srv.URL + "/", Org: "o", Bucket: "b", Token: "secret"}}
+	s, err := NewInfluxSender(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Health(context.Background()); err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package sender
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/speedwagon-io/asutp/internal/lib/rolling"
+)
+
+const throughputWindow = time.Minute
+
+// ThroughputStats reports totals since start and rates over the last minute.
+type ThroughputStats struct {
+	Window          string  `json:"window"`
+	EnvelopesSent   int64   `json:"envelopes_sent"`
+	EnvelopesFailed int64   `json:"envelopes_failed"`
+	BytesSent       int64   `json:"bytes_sent"`
+	EnvelopesPerSec float64 `json:"envelopes_per_sec"`
+	FailuresPerSec  float64 `json:"failures_per_sec"`
+	BytesPerSec     float64 `json:"bytes_per_sec"`
+}
+
+type throughput struct {
+	sent, failed, bytes          atomic.Int64
+	sentRate, failedRate, byRate *rolling.Window
+}
+
+func newThroughput() *throughput {
+	return &throughput{
+		sentRate:   rolling.NewWindow(throughputWindow),
+		failedRate: rolling.NewWindow(throughputWindow),
+		byRate:     rolling.NewWindow(throughputWindow),
+	}
+}
+
+func (t *throughput) recordSent(envelopes, bytes int) {
+	t.sent.Add(int64(envelopes))
+	t.bytes.Add(int64(bytes))
+	t.sentRate.Add(int64(envelopes))
+	t.byRate.Add(int64(bytes))
+}
+
+func (t *throughput) recordFailed(envelopes int) {
+	t.failed.Add(int64(envelopes))
+	t.failedRate.Add(int64(envelopes))
+}
+
+func (t *throughput) stats() ThroughputStats {
+	return ThroughputStats{
+		Window:          throughputWindow.String(),
+		EnvelopesSent:   t.sent.Load(),
+		EnvelopesFailed: t.failed.Load(),
+		BytesSent:       t.bytes.Load(),
+		EnvelopesPerSec: t.sentRate.Rate(),
+		FailuresPerSec:  t.failedRate.Rate(),
+		BytesPerSec:     t.byRate.Rate(),
+	}
+}
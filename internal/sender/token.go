@@ -0,0 +1,65 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TokenProvider supplies the bearer token for outgoing requests. Refresh is
+// called after the server rejects the current token.
+type TokenProvider interface {
+	Token() string
+	Refresh(ctx context.Context) (string, error)
+}
+
+type staticToken string
+
+func (t staticToken) Token() string {
+	return string(t)
+}
+
+func (t staticToken) Refresh(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// FileTokenProvider reads the token from a file and re-reads it on refresh,
+// so an external agent can rotate it without restarting the collector.
+type FileTokenProvider struct {
+	path  string
+	mu    sync.RWMutex
+	token string
+}
+
+func NewFileTokenProvider(path string) (*FileTokenProvider, error) {
+	p := &FileTokenProvider{path: path}
+	if _, err := p.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileTokenProvider) Token() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.token
+}
+
+func (p *FileTokenProvider) Refresh(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file is empty: %s", p.path)
+	}
+
+	p.mu.Lock()
+	p.token = token
+	p.mu.Unlock()
+	return token, nil
+}